@@ -78,6 +78,64 @@ func (c *ReaperClient) ListRunningReapers() ([]string, error) {
 	return runningReapers, nil
 }
 
+// GetDryRunReport returns the resources the reaper with the given UUID would have deleted on
+// its last dry run.
+func (c *ReaperClient) GetDryRunReport(uuid string) (*reaperconfig.DryRunReport, error) {
+	return c.client.GetDryRunReport(c.ctx, &reaperconfig.Reaper{Uuid: uuid})
+}
+
+// OverrideDeletionLimits allows the next sweep of the tripped reaper with the given UUID to
+// proceed regardless of its deletion limits.
+func (c *ReaperClient) OverrideDeletionLimits(uuid string) error {
+	_, err := c.client.OverrideDeletionLimits(c.ctx, &reaperconfig.Reaper{Uuid: uuid})
+	return err
+}
+
+// RunReaper runs the reaper with the given UUID right away, and returns the summary of its sweep.
+func (c *ReaperClient) RunReaper(uuid string) (*reaperconfig.SweepSummary, error) {
+	return c.client.RunReaper(c.ctx, &reaperconfig.Reaper{Uuid: uuid})
+}
+
+// PauseReaper pauses the reaper with the given UUID.
+func (c *ReaperClient) PauseReaper(uuid string) error {
+	_, err := c.client.PauseReaper(c.ctx, &reaperconfig.Reaper{Uuid: uuid})
+	return err
+}
+
+// ResumeReaper resumes the paused reaper with the given UUID.
+func (c *ReaperClient) ResumeReaper(uuid string) error {
+	_, err := c.client.ResumeReaper(c.ctx, &reaperconfig.Reaper{Uuid: uuid})
+	return err
+}
+
+// PauseManager pauses all reapers.
+func (c *ReaperClient) PauseManager() error {
+	_, err := c.client.PauseManager(c.ctx, new(empty.Empty))
+	return err
+}
+
+// ResumeManager resumes all reapers that are not paused on their own.
+func (c *ReaperClient) ResumeManager() error {
+	_, err := c.client.ResumeManager(c.ctx, new(empty.Empty))
+	return err
+}
+
+// GetReaper returns the config and status of the reaper with the given UUID.
+func (c *ReaperClient) GetReaper(uuid string) (*reaperconfig.ReaperStatus, error) {
+	return c.client.GetReaper(c.ctx, &reaperconfig.Reaper{Uuid: uuid})
+}
+
+// GetWatchlist returns the resources watched by one or all reapers, filtered and sorted as
+// given in the request.
+func (c *ReaperClient) GetWatchlist(req *reaperconfig.WatchlistRequest) (*reaperconfig.Watchlist, error) {
+	return c.client.GetWatchlist(c.ctx, req)
+}
+
+// ListDeletions returns the page of the deletion history that matches the request.
+func (c *ReaperClient) ListDeletions(req *reaperconfig.ListDeletionsRequest) (*reaperconfig.ListDeletionsResponse, error) {
+	return c.client.ListDeletions(c.ctx, req)
+}
+
 // StartManager starts running the reaper manager. Note this is different from starting the gRPC
 // server.
 func (c *ReaperClient) StartManager() error {
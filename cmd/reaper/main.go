@@ -21,9 +21,16 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
 
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/client"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/history"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/reaper"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
 )
@@ -32,8 +39,48 @@ func main() {
 	deleteCmd := flag.NewFlagSet("delete", flag.ExitOnError)
 	deleteUUID := deleteCmd.String("uuid", "", "UUID of the reaper")
 
+	dryRunCmd := flag.NewFlagSet("dryrun", flag.ExitOnError)
+	dryRunUUID := dryRunCmd.String("uuid", "", "UUID of the reaper")
+
+	overrideCmd := flag.NewFlagSet("override", flag.ExitOnError)
+	overrideUUID := overrideCmd.String("uuid", "", "UUID of the reaper")
+
+	runCmd := flag.NewFlagSet("run", flag.ExitOnError)
+	runUUID := runCmd.String("uuid", "", "UUID of the reaper")
+
+	reportCmd := flag.NewFlagSet("report", flag.ExitOnError)
+	reportUUID := reportCmd.String("uuid", "", "UUID of the reaper, or all reapers if not set")
+	reportTypes := reportCmd.String("types", "", "comma separated resource types to show, such as GCE_VM,GCS_OBJECT")
+	reportProject := reportCmd.String("project", "", "project to show resources of")
+	reportZone := reportCmd.String("zone", "", "zone, or bucket for GCS objects, to show resources of")
+	reportName := reportCmd.String("name", "", "regex the names of shown resources must match")
+	reportWithin := reportCmd.Duration("within", 0, "only show resources that will be deleted within this duration, such as 24h")
+	reportSort := reportCmd.String("sort", "deletion", "field to sort by: deletion, created, name, type or zone")
+	reportDescending := reportCmd.Bool("desc", false, "sort in descending order")
+
+	deletionsCmd := flag.NewFlagSet("deletions", flag.ExitOnError)
+	deletionsUUID := deletionsCmd.String("uuid", "", "UUID of the reaper, or all reapers if not set")
+	deletionsProject := deletionsCmd.String("project", "", "project to show deletions in")
+	deletionsName := deletionsCmd.String("name", "", "name of the resource to show deletions of")
+	deletionsFrom := deletionsCmd.String("from", "", "only show deletions at or after this RFC 3339 time")
+	deletionsTo := deletionsCmd.String("to", "", "only show deletions before this RFC 3339 time")
+	deletionsPageSize := deletionsCmd.Uint("page-size", 0, "number of deletions to show per page")
+	deletionsPageToken := deletionsCmd.String("page-token", "", "token of the page to show")
+	deletionsExport := deletionsCmd.String("export", "", "export all matching deletions to stdout in csv or json format")
+
+	describeCmd := flag.NewFlagSet("describe", flag.ExitOnError)
+	describeUUID := describeCmd.String("uuid", "", "UUID of the reaper")
+
+	pauseCmd := flag.NewFlagSet("pause", flag.ExitOnError)
+	pauseUUID := pauseCmd.String("uuid", "", "UUID of the reaper")
+	pauseAll := pauseCmd.Bool("all", false, "pause all reapers")
+
+	resumeCmd := flag.NewFlagSet("resume", flag.ExitOnError)
+	resumeUUID := resumeCmd.String("uuid", "", "UUID of the reaper")
+	resumeAll := resumeCmd.Bool("all", false, "resume all reapers")
+
 	if len(os.Args) < 2 {
-		fmt.Println("expected 'create', 'update', 'list', 'delete', 'start', or 'shutdown' commands")
+		fmt.Println(usage)
 		os.Exit(1)
 	}
 
@@ -75,17 +122,55 @@ func main() {
 		}
 		fmt.Println("Running Reaper UUIDs: ", strings.Join(reapers, ", "))
 
+	case "report":
+		reportCmd.Parse(os.Args[2:])
+		req, err := watchlistRequest(*reportUUID, *reportTypes, *reportProject, *reportZone, *reportName, *reportWithin, *reportSort, *reportDescending)
+		if err != nil {
+			fmt.Println("Creating report request failed with the following error: ", err.Error())
+			os.Exit(1)
+		}
+		watchlist, err := reaperClient.GetWatchlist(req)
+		if err != nil {
+			fmt.Println("Get watchlist failed with following error: ", err.Error())
+			os.Exit(1)
+		}
+		printWatchlist(watchlist)
+
+	case "deletions":
+		deletionsCmd.Parse(os.Args[2:])
+		req, err := listDeletionsRequest(*deletionsUUID, *deletionsProject, *deletionsName, *deletionsFrom, *deletionsTo)
+		if err != nil {
+			fmt.Println("Creating deletions request failed with the following error: ", err.Error())
+			os.Exit(1)
+		}
+		req.PageSize = uint32(*deletionsPageSize)
+		req.PageToken = *deletionsPageToken
+		if len(*deletionsExport) > 0 {
+			err = exportDeletions(reaperClient, req, *deletionsExport)
+		} else {
+			err = printDeletions(reaperClient, req)
+		}
+		if err != nil {
+			fmt.Println("List deletions failed with following error: ", err.Error())
+			os.Exit(1)
+		}
+
+	case "describe":
+		describeCmd.Parse(os.Args[2:])
+		if len(*describeUUID) == 0 {
+			*describeUUID = uuidPrompt()
+		}
+		status, err := reaperClient.GetReaper(*describeUUID)
+		if err != nil {
+			fmt.Println("Describe reaper failed with following error: ", err.Error())
+			os.Exit(1)
+		}
+		printReaperStatus(status)
+
 	case "delete":
 		deleteCmd.Parse(os.Args[2:])
 		if len(*deleteUUID) == 0 {
-			var err error
-			reader := bufio.NewReader(os.Stdin)
-			fmt.Print("Reaper UUID: ")
-			*deleteUUID, err = reader.ReadString('\n')
-			if err != nil {
-				log.Fatal(err)
-			}
-			*deleteUUID = strings.TrimSuffix(*deleteUUID, "\n")
+			*deleteUUID = uuidPrompt()
 		}
 		err := reaperClient.DeleteReaper(*deleteUUID)
 		if err != nil {
@@ -94,6 +179,80 @@ func main() {
 		}
 		fmt.Printf("Reaper with UUID %s successfully deleted\n", *deleteUUID)
 
+	case "dryrun":
+		dryRunCmd.Parse(os.Args[2:])
+		if len(*dryRunUUID) == 0 {
+			*dryRunUUID = uuidPrompt()
+		}
+		report, err := reaperClient.GetDryRunReport(*dryRunUUID)
+		if err != nil {
+			fmt.Println("Get dry run report failed with following error: ", err.Error())
+			os.Exit(1)
+		}
+		printDryRunReport(report)
+
+	case "override":
+		overrideCmd.Parse(os.Args[2:])
+		if len(*overrideUUID) == 0 {
+			*overrideUUID = uuidPrompt()
+		}
+		err := reaperClient.OverrideDeletionLimits(*overrideUUID)
+		if err != nil {
+			fmt.Println("Override deletion limits failed with following error: ", err.Error())
+			os.Exit(1)
+		}
+		fmt.Printf("Reaper with UUID %s will ignore its deletion limits on its next sweep\n", *overrideUUID)
+
+	case "run":
+		runCmd.Parse(os.Args[2:])
+		if len(*runUUID) == 0 {
+			*runUUID = uuidPrompt()
+		}
+		summary, err := reaperClient.RunReaper(*runUUID)
+		if err != nil {
+			fmt.Println("Run reaper failed with following error: ", err.Error())
+			os.Exit(1)
+		}
+		printSweepSummary(summary)
+
+	case "pause":
+		pauseCmd.Parse(os.Args[2:])
+		if *pauseAll {
+			if err := reaperClient.PauseManager(); err != nil {
+				fmt.Println("Pause reapers failed with following error: ", err.Error())
+				os.Exit(1)
+			}
+			fmt.Println("All reapers paused")
+			break
+		}
+		if len(*pauseUUID) == 0 {
+			*pauseUUID = uuidPrompt()
+		}
+		if err := reaperClient.PauseReaper(*pauseUUID); err != nil {
+			fmt.Println("Pause reaper failed with following error: ", err.Error())
+			os.Exit(1)
+		}
+		fmt.Printf("Reaper with UUID %s paused\n", *pauseUUID)
+
+	case "resume":
+		resumeCmd.Parse(os.Args[2:])
+		if *resumeAll {
+			if err := reaperClient.ResumeManager(); err != nil {
+				fmt.Println("Resume reapers failed with following error: ", err.Error())
+				os.Exit(1)
+			}
+			fmt.Println("All reapers resumed, other than reapers paused on their own")
+			break
+		}
+		if len(*resumeUUID) == 0 {
+			*resumeUUID = uuidPrompt()
+		}
+		if err := reaperClient.ResumeReaper(*resumeUUID); err != nil {
+			fmt.Println("Resume reaper failed with following error: ", err.Error())
+			os.Exit(1)
+		}
+		fmt.Printf("Reaper with UUID %s resumed\n", *resumeUUID)
+
 	case "start":
 		err := reaperClient.StartManager()
 		if err != nil {
@@ -109,11 +268,274 @@ func main() {
 		fmt.Println("Reaper manager shutdown")
 
 	default:
-		fmt.Println("expected 'create', 'update', 'list', 'delete', 'start', or 'shutdown' commands")
+		fmt.Println(usage)
 		os.Exit(1)
 	}
 }
 
+const usage = "expected 'create', 'update', 'list', 'report', 'deletions', 'describe', 'delete', 'dryrun', 'override', 'run', 'pause', 'resume', 'start', or 'shutdown' commands"
+
+// uuidPrompt is a command line prompt that asks the user for a reaper UUID.
+func uuidPrompt() string {
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Print("Reaper UUID: ")
+	uuid, err := reader.ReadString('\n')
+	if err != nil {
+		log.Fatal(err)
+	}
+	return strings.TrimSuffix(uuid, "\n")
+}
+
+// printDryRunReport prints the resources a reaper would have deleted on its last dry run.
+func printDryRunReport(report *reaperconfig.DryRunReport) {
+	if report.GetRunTime() == nil {
+		fmt.Printf("Reaper with UUID %s has not done a dry run\n", report.GetUuid())
+		return
+	}
+	runTime, _ := ptypes.Timestamp(report.GetRunTime())
+	fmt.Printf("Reaper with UUID %s would have deleted %d resources on %s\n", report.GetUuid(), len(report.GetResources()), runTime.Format(time.RFC3339))
+	for _, resource := range report.GetResources() {
+		fmt.Printf("  %s %s in %s\n", resource.GetResourceType().String(), resource.GetName(), resource.GetZone())
+	}
+}
+
+// listDeletionsRequest creates a request for the deletions that pass the given filters, and
+// were attempted between the given RFC 3339 times.
+func listDeletionsRequest(uuid, projectID, name, from, to string) (*reaperconfig.ListDeletionsRequest, error) {
+	req := &reaperconfig.ListDeletionsRequest{Uuid: uuid, ProjectId: projectID, Name: name}
+	if len(from) > 0 {
+		startTime, err := parseTimestamp(from)
+		if err != nil {
+			return nil, err
+		}
+		req.StartTime = startTime
+	}
+	if len(to) > 0 {
+		endTime, err := parseTimestamp(to)
+		if err != nil {
+			return nil, err
+		}
+		req.EndTime = endTime
+	}
+	return req, nil
+}
+
+// parseTimestamp parses an RFC 3339 time into a timestamp.
+func parseTimestamp(value string) (*timestamp.Timestamp, error) {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time %s, expected RFC 3339 format such as 2020-06-01T12:00:00Z", value)
+	}
+	return ptypes.TimestampProto(parsed)
+}
+
+// printDeletions prints a page of the deletion history as a table, followed by the token
+// of the next page.
+func printDeletions(reaperClient *client.ReaperClient, req *reaperconfig.ListDeletionsRequest) error {
+	response, err := reaperClient.ListDeletions(req)
+	if err != nil {
+		return err
+	}
+	if len(response.GetRecords()) == 0 {
+		fmt.Println("No deletions")
+		return nil
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "TIME\tREAPER\tOUTCOME\tTYPE\tPROJECT\tZONE\tNAME\tTTL\tERROR")
+	for _, record := range response.GetRecords() {
+		resource := record.GetResource()
+		attemptTime, _ := ptypes.Timestamp(record.GetAttemptTime())
+		fmt.Fprintf(
+			writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			attemptTime.Format(time.RFC3339), record.GetReaperUuid(), record.GetOutcome().String(), resource.GetResourceType().String(),
+			resource.GetProjectId(), resource.GetZone(), resource.GetName(), resource.GetTtl(), record.GetError(),
+		)
+	}
+	writer.Flush()
+	if len(response.GetNextPageToken()) > 0 {
+		fmt.Printf("Next page token: %s\n", response.GetNextPageToken())
+	}
+	return nil
+}
+
+// exportDeletions writes every page of the deletion history matching the request to stdout,
+// in csv or json format.
+func exportDeletions(reaperClient *client.ReaperClient, req *reaperconfig.ListDeletionsRequest, format string) error {
+	if format != "csv" && format != "json" {
+		return fmt.Errorf("invalid export format %s, expected csv or json", format)
+	}
+	for page := 0; ; page++ {
+		response, err := reaperClient.ListDeletions(req)
+		if err != nil {
+			return err
+		}
+		if format == "csv" {
+			err = history.WriteCSV(os.Stdout, response.GetRecords(), page == 0)
+		} else {
+			err = history.WriteJSON(os.Stdout, response.GetRecords())
+		}
+		if err != nil {
+			return err
+		}
+		if len(response.GetNextPageToken()) == 0 {
+			return nil
+		}
+		req.PageToken = response.GetNextPageToken()
+	}
+}
+
+// watchlistRequest creates a request for the watched resources that pass the given filters,
+// sorted by the given field.
+func watchlistRequest(uuid, types, projectID, zone, nameFilter string, within time.Duration, sortBy string, descending bool) (*reaperconfig.WatchlistRequest, error) {
+	req := &reaperconfig.WatchlistRequest{
+		Uuid:       uuid,
+		ProjectId:  projectID,
+		Zone:       zone,
+		NameFilter: nameFilter,
+		Descending: descending,
+	}
+	if len(types) > 0 {
+		for _, resourceType := range strings.Split(types, ",") {
+			parsedType, isValid := reaperconfig.ResourceType_value[strings.ToUpper(strings.TrimSpace(resourceType))]
+			if !isValid {
+				return nil, fmt.Errorf("invalid resource type %s", resourceType)
+			}
+			req.ResourceTypes = append(req.ResourceTypes, reaperconfig.ResourceType(parsedType))
+		}
+	}
+	if within > 0 {
+		deletedBefore, err := ptypes.TimestampProto(time.Now().Add(within))
+		if err != nil {
+			return nil, err
+		}
+		req.DeletedBefore = deletedBefore
+	}
+	switch sortBy {
+	case "deletion":
+		req.SortBy = reaperconfig.WatchlistSortField_DELETION_TIME
+	case "created":
+		req.SortBy = reaperconfig.WatchlistSortField_TIME_CREATED
+	case "name":
+		req.SortBy = reaperconfig.WatchlistSortField_NAME
+	case "type":
+		req.SortBy = reaperconfig.WatchlistSortField_TYPE
+	case "zone":
+		req.SortBy = reaperconfig.WatchlistSortField_ZONE
+	default:
+		return nil, fmt.Errorf("invalid sort field %s", sortBy)
+	}
+	return req, nil
+}
+
+// printWatchlist prints the watched resources as a table.
+func printWatchlist(watchlist *reaperconfig.Watchlist) {
+	if len(watchlist.GetEntries()) == 0 {
+		fmt.Println("No watched resources")
+		return
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "REAPER\tTYPE\tPROJECT\tZONE\tNAME\tCREATED\tTTL\tDELETION TIME")
+	for _, entry := range watchlist.GetEntries() {
+		resource := entry.GetResource()
+		created, _ := ptypes.Timestamp(resource.GetTimeCreated())
+		deletionTime := "invalid TTL"
+		if resource.GetDeletionTime() != nil {
+			parsedDeletionTime, _ := ptypes.Timestamp(resource.GetDeletionTime())
+			deletionTime = parsedDeletionTime.Format(time.RFC3339)
+		}
+		fmt.Fprintf(
+			writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			entry.GetReaperUuid(), resource.GetResourceType().String(), resource.GetProjectId(), resource.GetZone(),
+			resource.GetName(), created.Format(time.RFC3339), resource.GetTtl(), deletionTime,
+		)
+	}
+	writer.Flush()
+}
+
+// printReaperStatus prints the config and status of a reaper.
+func printReaperStatus(status *reaperconfig.ReaperStatus) {
+	fmt.Printf("Reaper with UUID %s\n", status.GetConfig().GetUuid())
+	fmt.Println(proto.MarshalTextString(status.GetConfig()))
+	if status.GetNextRun() != nil {
+		nextRun, _ := ptypes.Timestamp(status.GetNextRun())
+		fmt.Printf("Next run:  %s\n", nextRun.Format(time.RFC3339))
+	}
+	if status.GetLastRun() == nil {
+		fmt.Println("Last run:  never")
+	} else {
+		lastRun, _ := ptypes.Timestamp(status.GetLastRun())
+		lastSweep := status.GetLastSweep()
+		fmt.Printf("Last run:  %s\n", lastRun.Format(time.RFC3339))
+		fmt.Printf(
+			"Last sweep: %d listed, %d deleted, %d marked, %d failed, %d skipped\n",
+			lastSweep.GetListed(), lastSweep.GetDeleted(), lastSweep.GetMarked(), lastSweep.GetFailed(), lastSweep.GetSkipped(),
+		)
+		printProjectSweeps(lastSweep)
+		printListingErrors(lastSweep)
+	}
+	fmt.Printf("Watching:  %d resources\n", status.GetWatchlistSize())
+	if status.GetPaused() {
+		fmt.Println("The reaper is paused")
+	}
+	if status.GetTripped() {
+		fmt.Println("The reaper exceeded its deletion limits, and is not deleting until they are overridden")
+	}
+	for _, drift := range status.GetLifecycleDrift() {
+		fmt.Printf("Lifecycle rule drift in bucket %s\n", drift.GetBucket())
+		for _, rule := range drift.GetMissing() {
+			fmt.Printf("  missing: %s\n", lifecycleRuleString(rule))
+		}
+		for _, rule := range drift.GetExtra() {
+			fmt.Printf("  extra:   %s\n", lifecycleRuleString(rule))
+		}
+	}
+}
+
+// lifecycleRuleString returns a readable description of a lifecycle rule.
+func lifecycleRuleString(rule *reaperconfig.LifecycleRule) string {
+	return fmt.Sprintf("delete after %d days (prefixes: %v, suffixes: %v)", rule.GetAgeDays(), rule.GetPrefixes(), rule.GetSuffixes())
+}
+
+// printSweepSummary prints what happened to the resources a reaper watched during a run.
+func printSweepSummary(summary *reaperconfig.SweepSummary) {
+	runTime, _ := ptypes.Timestamp(summary.GetRunTime())
+	fmt.Printf("Reaper with UUID %s ran on %s\n", summary.GetUuid(), runTime.Format(time.RFC3339))
+	if summary.GetPaused() {
+		fmt.Println("  The reaper is paused, so nothing was deleted. Run dryrun to view what would have been deleted.")
+	}
+	fmt.Printf("  Listed:  %d\n", summary.GetListed())
+	fmt.Printf("  Deleted: %d\n", summary.GetDeleted())
+	fmt.Printf("  Marked:  %d\n", summary.GetMarked())
+	fmt.Printf("  Failed:  %d\n", summary.GetFailed())
+	fmt.Printf("  Skipped: %d\n", summary.GetSkipped())
+	printProjectSweeps(summary)
+	printListingErrors(summary)
+}
+
+// printProjectSweeps prints what happened to the resources of each project during a run.
+func printProjectSweeps(summary *reaperconfig.SweepSummary) {
+	for _, project := range summary.GetProjects() {
+		fmt.Printf(
+			"  Project %s: %d deleted, %d marked, %d failed, %d skipped\n",
+			project.GetProjectId(), project.GetDeleted(), project.GetMarked(), project.GetFailed(), project.GetSkipped(),
+		)
+	}
+}
+
+// printListingErrors prints the errors listing a reaper's resources before a run.
+func printListingErrors(summary *reaperconfig.SweepSummary) {
+	for _, listingErr := range summary.GetListingErrors() {
+		if len(listingErr.GetProjectParent()) > 0 {
+			fmt.Printf("  Failed to list the projects under %s: %s\n", listingErr.GetProjectParent(), listingErr.GetError())
+			continue
+		}
+		fmt.Printf(
+			"  Failed to list %s resources in zone %s of project %s: %s\n",
+			listingErr.GetResourceType().String(), listingErr.GetZone(), listingErr.GetProjectId(), listingErr.GetError(),
+		)
+	}
+}
+
 // createReaperConfigPrompt is a command line prompt that walks the user through creating
 // a new reaper config.
 func createReaperConfigPrompt() (*reaperconfig.ReaperConfig, error) {
@@ -134,6 +556,47 @@ func createReaperConfigPrompt() (*reaperconfig.ReaperConfig, error) {
 	}
 	projectID = strings.TrimSuffix(projectID, "\n")
 
+	fmt.Print("Additional project IDs (comma separated list, blank for none): ")
+	projectIDsString, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	var projectIDs []string
+	if projectIDsString = strings.TrimSuffix(projectIDsString, "\n"); len(projectIDsString) > 0 {
+		projectIDs = strings.Split(projectIDsString, ",")
+	}
+
+	fmt.Print("Watch all projects under a folder or organization, such as folders/123 (blank for none): ")
+	projectParent, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	projectParent = strings.TrimSuffix(projectParent, "\n")
+
+	fmt.Print("Credentials file on the server (blank for the server's credentials): ")
+	credentialsFile, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	credentialsFile = strings.TrimSuffix(credentialsFile, "\n")
+
+	fmt.Print("Service account to impersonate (blank for none): ")
+	serviceAccount, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	serviceAccount = strings.TrimSuffix(serviceAccount, "\n")
+
+	fmt.Print("OAuth scopes (comma separated list, blank for cloud-platform): ")
+	scopesString, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	var scopes []string
+	if scopesString = strings.TrimSuffix(scopesString, "\n"); len(scopesString) > 0 {
+		scopes = strings.Split(scopesString, ",")
+	}
+
 	fmt.Print("Reaper run schedule (in cron time string format): ")
 	schedule, err := reader.ReadString('\n')
 	if err != nil {
@@ -141,6 +604,46 @@ func createReaperConfigPrompt() (*reaperconfig.ReaperConfig, error) {
 	}
 	schedule = strings.TrimSuffix(schedule, "\n")
 
+	fmt.Print("Dry run, reporting resources instead of deleting them? (y/n): ")
+	dryRunResponse, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	dryRun := len(dryRunResponse) > 1 && dryRunResponse[0] == 'y'
+
+	fmt.Print("Max deletions per sweep (blank for no limit): ")
+	maxDeletionsString, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	var maxDeletions uint64
+	if maxDeletionsString = strings.TrimSuffix(maxDeletionsString, "\n"); len(maxDeletionsString) > 0 {
+		maxDeletions, err = strconv.ParseUint(maxDeletionsString, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid max deletions per sweep %s", maxDeletionsString)
+		}
+	}
+
+	fmt.Print("Max fraction of watched resources deleted per sweep (blank for no limit): ")
+	maxFractionString, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	var maxFraction float64
+	if maxFractionString = strings.TrimSuffix(maxFractionString, "\n"); len(maxFractionString) > 0 {
+		maxFraction, err = strconv.ParseFloat(maxFractionString, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid max deletion fraction %s", maxFractionString)
+		}
+	}
+
+	fmt.Print("Grace period between marking and deleting resources (blank to delete without marking): ")
+	gracePeriod, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	gracePeriod = strings.TrimSuffix(gracePeriod, "\n")
+
 	var resources []*reaperconfig.ResourceConfig
 	for {
 		fmt.Print("Add another resource? (y/n): ")
@@ -167,11 +670,17 @@ func createReaperConfigPrompt() (*reaperconfig.ReaperConfig, error) {
 			resourceType = reaperconfig.ResourceType_GCS_BUCKET
 		case "GCS_Object":
 			resourceType = reaperconfig.ResourceType_GCS_OBJECT
+		case "Project":
+			resourceType = reaperconfig.ResourceType_PROJECT
 		default:
 			return nil, fmt.Errorf("Invalid resource type %s", resourceTypeString)
 		}
 
-		fmt.Print("Zones (comma separated list): ")
+		if resourceType == reaperconfig.ResourceType_PROJECT {
+			fmt.Print("Folders (comma separated list, such as folders/123): ")
+		} else {
+			fmt.Print("Zones (comma separated list): ")
+		}
 		zonesString, err := reader.ReadString('\n')
 		if err != nil {
 			return nil, err
@@ -193,19 +702,71 @@ func createReaperConfigPrompt() (*reaperconfig.ReaperConfig, error) {
 		}
 		skipFilter = strings.TrimSuffix(skipFilter, "\n")
 
-		fmt.Print("TTL (in cron time string format): ")
+		fmt.Print("TTL (duration such as 6h or P2D, or cron time string): ")
 		ttl, err := reader.ReadString('\n')
 		if err != nil {
 			return nil, err
 		}
 		ttl = strings.TrimSuffix(ttl, "\n")
 
-		resources = append(
-			resources,
-			reaper.NewResourceConfig(resourceType, zones, nameFilter, skipFilter, ttl),
-		)
+		resourceConfig := reaper.NewResourceConfig(resourceType, zones, nameFilter, skipFilter, ttl)
+		if resourceType == reaperconfig.ResourceType_GCS_BUCKET {
+			fmt.Print("Force delete buckets along with all of their objects? (y/n): ")
+			forceResponse, err := reader.ReadString('\n')
+			if err != nil {
+				return nil, err
+			}
+			resourceConfig.ForceDelete = len(forceResponse) > 1 && forceResponse[0] == 'y'
+		}
+		if resourceType == reaperconfig.ResourceType_GCS_OBJECT {
+			fmt.Print("Include noncurrent object versions? (y/n): ")
+			versionsResponse, err := reader.ReadString('\n')
+			if err != nil {
+				return nil, err
+			}
+			resourceConfig.IncludeNoncurrentVersions = len(versionsResponse) > 1 && versionsResponse[0] == 'y'
+
+			fmt.Print("Delete objects through bucket lifecycle rules instead of listing them? (y/n): ")
+			lifecycleResponse, err := reader.ReadString('\n')
+			if err != nil {
+				return nil, err
+			}
+			resourceConfig.UseLifecycleRules = len(lifecycleResponse) > 1 && lifecycleResponse[0] == 'y'
+		}
+		if resourceType == reaperconfig.ResourceType_PROJECT {
+			fmt.Print("Labels projects must have (comma separated key=value pairs): ")
+			labelsString, err := reader.ReadString('\n')
+			if err != nil {
+				return nil, err
+			}
+			labelsString = strings.TrimSuffix(labelsString, "\n")
+			if len(labelsString) > 0 {
+				resourceConfig.MatchLabels = make(map[string]string)
+				for _, label := range strings.Split(labelsString, ",") {
+					keyValue := strings.SplitN(label, "=", 2)
+					if len(keyValue) != 2 {
+						return nil, fmt.Errorf("Invalid label %s", label)
+					}
+					resourceConfig.MatchLabels[keyValue[0]] = keyValue[1]
+				}
+			}
+		}
+		resources = append(resources, resourceConfig)
 	}
 
 	config := reaper.NewReaperConfig(resources, schedule, projectID, uuid)
+	config.ProjectIds = projectIDs
+	config.ProjectParent = projectParent
+	if len(credentialsFile) > 0 || len(serviceAccount) > 0 || len(scopes) > 0 {
+		config.Credentials = &reaperconfig.Credentials{
+			CredentialsFile:           credentialsFile,
+			ImpersonateServiceAccount: serviceAccount,
+			Scopes:                    scopes,
+		}
+	}
+	config.DryRun = dryRun
+	config.MaxDeletionsPerSweep = uint32(maxDeletions)
+	config.MaxDeletionFraction = maxFraction
+	config.GracePeriod = gracePeriod
 	return config, nil
 }
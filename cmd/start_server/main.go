@@ -18,18 +18,44 @@ import (
 	"context"
 	"flag"
 	"log"
+	"strings"
 
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/clients/resourcemanager"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/history"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/logger"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/manager"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/state"
 )
 
 func main() {
 	port := flag.String("port", "8000", "port to run gRPC server on")
 	projectID := flag.String("project-id", "", "GCP Project ID for where to store logs")
 	logsName := flag.String("logs-name", "", "name of logs")
+	stateLocation := flag.String(
+		"state", "",
+		"file path, or GCS object in the form gs://bucket/object, to persist reapers in across restarts",
+	)
+	historyPath := flag.String(
+		"history", "",
+		"file path to record the deletions attempted by reapers in, which are otherwise only kept in memory",
+	)
+	configDir := flag.String(
+		"config-dir", "",
+		"directory of ReaperConfig files in text proto, JSON or YAML format to run reapers from",
+	)
+	allowedProjectFolders := flag.String(
+		"allowed-project-folders", "",
+		"comma separated folders, such as folders/123, that reapers may delete projects from",
+	)
 
 	flag.Parse()
 
+	if len(*allowedProjectFolders) > 0 {
+		if err := resourcemanager.SetAllowedFolders(strings.Split(*allowedProjectFolders, ",")); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	if err := logger.CreateLogger(); err != nil {
 		log.Fatal(err)
 	}
@@ -39,8 +65,26 @@ func main() {
 		if err != nil {
 			log.Fatal(err)
 		}
-		logger.Logf("Logging to %s in project", *logsName, *projectID)
+		logger.Logf("Logging to %s in project %s", *logsName, *projectID)
+	}
+
+	var store state.Store
+	if len(*stateLocation) > 0 {
+		var err error
+		store, err = state.NewStore(context.Background(), *stateLocation)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	options := manager.ServerOptions{Store: store, ConfigDir: *configDir}
+	if len(*historyPath) > 0 {
+		deletionHistory, err := history.OpenStore(*historyPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		options.History = deletionHistory
 	}
 
-	manager.StartServer(*port)
+	manager.StartServer(*port, options)
 }
@@ -10,7 +10,9 @@ require (
 	github.com/googleapis/google-cloud-go-testing v0.0.0-20191008195207-8e1d251e947d
 	github.com/robfig/cron/v3 v3.0.1
 	go.opencensus.io v0.22.3
+	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
 	google.golang.org/api v0.26.0
 	google.golang.org/grpc v1.28.0
 	google.golang.org/protobuf v1.24.0
+	gopkg.in/yaml.v2 v2.4.0
 )
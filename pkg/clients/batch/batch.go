@@ -0,0 +1,174 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+)
+
+// MaxRequests is the max number of requests Google APIs accept in a single batch.
+const MaxRequests = 100
+
+// A Request is a single request in a batch. The path is the absolute path of the
+// request on the API's host, including any query parameters.
+type Request struct {
+	Method string
+	Path   string
+}
+
+// A Response is the response to a single request in a batch. If the request failed,
+// Err is set, and is a *googleapi.Error if the API returned an error status.
+type Response struct {
+	Body []byte
+	Err  error
+}
+
+// URLs returns the batch URL of the Google API with the given endpoint, and the base path of
+// the API that the paths of batched requests start with. The batch URL of an API is the path
+// of its endpoint under /batch on the same host. The endpoint of the Compute Engine API
+// includes its projects collection, which is not part of its batch URL.
+func URLs(endpoint string) (string, string, error) {
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return "", "", err
+	}
+	basePath := strings.TrimSuffix(endpointURL.Path, "/") + "/"
+	batchPath := "/batch" + strings.TrimSuffix(strings.TrimSuffix(basePath, "/"), "/projects")
+	batchURL := url.URL{Scheme: endpointURL.Scheme, Host: endpointURL.Host, Path: batchPath}
+	return batchURL.String(), basePath, nil
+}
+
+// Do sends the requests as a single multipart/mixed batch request to the batch URL of
+// a Google API, and returns the response to each request in the same order. If the
+// batch request itself fails, every response has the same error.
+func Do(ctx context.Context, httpClient *http.Client, batchURL string, requests []Request) []Response {
+	responses, err := do(ctx, httpClient, batchURL, requests)
+	if err != nil {
+		responses = make([]Response, len(requests))
+		for idx := range responses {
+			responses[idx].Err = err
+		}
+	}
+	return responses
+}
+
+// do sends the batch request, and returns an error if the batch request failed as a whole.
+func do(ctx context.Context, httpClient *http.Client, batchURL string, requests []Request) ([]Response, error) {
+	if len(requests) > MaxRequests {
+		return nil, fmt.Errorf("batch of %d requests exceeds the max of %d", len(requests), MaxRequests)
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for idx, request := range requests {
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Type", "application/http")
+		header.Set("Content-ID", fmt.Sprintf("<item%d>", idx))
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(part, "%s %s HTTP/1.1\r\n\r\n", request.Method, request.Path)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, batchURL, &body)
+	if err != nil {
+		return nil, err
+	}
+	httpRequest.Header.Set("Content-Type", "multipart/mixed; boundary="+writer.Boundary())
+	httpResponse, err := httpClient.Do(httpRequest)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResponse.Body.Close()
+	if err := googleapi.CheckResponse(httpResponse); err != nil {
+		return nil, err
+	}
+	return parseResponses(httpResponse, len(requests))
+}
+
+// parseResponses parses the multipart/mixed response of a batch request. Each part is
+// matched to its request by its Content-ID. Requests without a response get an error.
+func parseResponses(httpResponse *http.Response, numRequests int) ([]Response, error) {
+	mediaType, params, err := mime.ParseMediaType(httpResponse.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		return nil, fmt.Errorf("batch response is not multipart: %s", httpResponse.Header.Get("Content-Type"))
+	}
+
+	responses := make([]Response, numRequests)
+	received := make([]bool, numRequests)
+	reader := multipart.NewReader(httpResponse.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		idx, isValid := itemIndex(part.Header.Get("Content-ID"), numRequests)
+		if !isValid {
+			continue
+		}
+		received[idx] = true
+
+		itemResponse, err := http.ReadResponse(bufio.NewReader(part), nil)
+		if err != nil {
+			responses[idx].Err = err
+			continue
+		}
+		if err := googleapi.CheckResponse(itemResponse); err != nil {
+			responses[idx].Err = err
+			continue
+		}
+		responses[idx].Body, responses[idx].Err = ioutil.ReadAll(itemResponse.Body)
+		itemResponse.Body.Close()
+	}
+
+	for idx := range responses {
+		if !received[idx] {
+			responses[idx].Err = fmt.Errorf("batch response is missing item %d", idx)
+		}
+	}
+	return responses, nil
+}
+
+// itemIndex returns the index of the request a response part belongs to, from the part's
+// Content-ID, which is of the form "<response-item{index}>".
+func itemIndex(contentID string, numRequests int) (int, bool) {
+	contentID = strings.Trim(contentID, "<>")
+	contentID = strings.TrimPrefix(contentID, "response-")
+	if !strings.HasPrefix(contentID, "item") {
+		return 0, false
+	}
+	idx, err := strconv.Atoi(strings.TrimPrefix(contentID, "item"))
+	if err != nil || idx < 0 || idx >= numRequests {
+		return 0, false
+	}
+	return idx, true
+}
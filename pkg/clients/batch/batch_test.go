@@ -0,0 +1,105 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package batch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/utils"
+	"google.golang.org/api/googleapi"
+)
+
+type URLsTestCase struct {
+	Endpoint         string
+	ExpectedBatchURL string
+	ExpectedBasePath string
+}
+
+var urlsTestCases = []URLsTestCase{
+	URLsTestCase{"https://storage.googleapis.com/storage/v1/", "https://storage.googleapis.com/batch/storage/v1", "/storage/v1/"},
+	URLsTestCase{"https://compute.googleapis.com/compute/v1/projects/", "https://compute.googleapis.com/batch/compute/v1", "/compute/v1/projects/"},
+	URLsTestCase{"http://127.0.0.1:8080", "http://127.0.0.1:8080/batch", "/"},
+}
+
+func TestURLs(t *testing.T) {
+	for _, testCase := range urlsTestCases {
+		batchURL, basePath, err := URLs(testCase.Endpoint)
+		if err != nil {
+			t.Errorf("URLs(%s) failed: %v", testCase.Endpoint, err)
+			continue
+		}
+		if batchURL != testCase.ExpectedBatchURL || basePath != testCase.ExpectedBasePath {
+			t.Errorf(
+				"URLs(%s) = %s, %s, expected %s, %s",
+				testCase.Endpoint, batchURL, basePath, testCase.ExpectedBatchURL, testCase.ExpectedBasePath,
+			)
+		}
+	}
+}
+
+func TestDo(t *testing.T) {
+	server := utils.CreateServer(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/missing":
+			http.Error(w, "not found", http.StatusNotFound)
+		case "/unavailable":
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte(req.Method + " " + req.URL.RequestURI()))
+		}
+	})
+	defer server.Close()
+
+	requests := []Request{
+		Request{http.MethodDelete, "/ok?generation=1"},
+		Request{http.MethodDelete, "/missing"},
+		Request{http.MethodGet, "/unavailable"},
+	}
+	responses := Do(context.Background(), server.Client(), server.URL+"/batch", requests)
+	if len(responses) != len(requests) {
+		t.Fatalf("Expected %d responses, got %d", len(requests), len(responses))
+	}
+	if responses[0].Err != nil || string(responses[0].Body) != "DELETE /ok?generation=1" {
+		t.Errorf("Unexpected response to the first request: %s, %v", responses[0].Body, responses[0].Err)
+	}
+	expectedCodes := []int{0, http.StatusNotFound, http.StatusServiceUnavailable}
+	for idx := 1; idx < len(responses); idx++ {
+		var apiError *googleapi.Error
+		if !errors.As(responses[idx].Err, &apiError) || apiError.Code != expectedCodes[idx] {
+			t.Errorf("Expected request %d to fail with code %d, got %v", idx, expectedCodes[idx], responses[idx].Err)
+		}
+	}
+}
+
+func TestDoBatchFailure(t *testing.T) {
+	server := utils.CreateServer(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	})
+	defer server.Close()
+
+	responses := Do(context.Background(), server.Client(), server.URL+"/not-a-batch", []Request{
+		Request{http.MethodDelete, "/first"},
+		Request{http.MethodDelete, "/second"},
+	})
+	for idx, response := range responses {
+		var apiError *googleapi.Error
+		if !errors.As(response.Err, &apiError) || apiError.Code != http.StatusForbidden {
+			t.Errorf("Expected request %d to fail with the error of the batch, got %v", idx, response.Err)
+		}
+	}
+}
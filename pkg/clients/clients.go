@@ -17,9 +17,11 @@ package clients
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/clients/gce"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/clients/gcs"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/clients/resourcemanager"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
 	"google.golang.org/api/option"
@@ -33,10 +35,21 @@ import (
 //    more details.
 //  - GetResources returns a list of Resources that are match the ResourceConfig.
 //  - DeleteResource deletes the specified resource.
+//  - MarkResource marks the specified resource for deletion by setting the
+//    resources.MarkLabel on it, so that the resource can be deleted after a grace
+//    period. Owners can remove the label to rescue the resource.
 type Client interface {
 	Auth(ctx context.Context, opts ...option.ClientOption) error
 	GetResources(projectID string, config *reaperconfig.ResourceConfig) ([]*resources.Resource, error)
 	DeleteResource(projectID string, resource *resources.Resource) error
+	MarkResource(projectID string, resource *resources.Resource, markedAt time.Time) error
+}
+
+// A BatchDeleter is a Client that can delete many resources in a single request to GCP.
+// DeleteResources returns the error of each delete, in the same order as the resources,
+// so that a batch can partially fail.
+type BatchDeleter interface {
+	DeleteResources(projectID string, resourcesToDelete []*resources.Resource) []error
 }
 
 // NewClient is the factory method that returns the correct implementation of the GCP
@@ -49,6 +62,8 @@ func NewClient(resourceType reaperconfig.ResourceType) (Client, error) {
 		return gcs.NewGCSBucketClient(), nil
 	case reaperconfig.ResourceType_GCS_OBJECT:
 		return gcs.NewGCSObjectClient(), nil
+	case reaperconfig.ResourceType_PROJECT:
+		return resourcemanager.NewProjectClient(), nil
 	default:
 		return nil, errors.New("Unsupported Resource Type")
 	}
@@ -0,0 +1,130 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clients
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	iamcredentials "google.golang.org/api/iamcredentials/v1"
+	"google.golang.org/api/option"
+)
+
+// cloudPlatformScope is the scope requested when the credentials do not set any scopes.
+const cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// CredentialOptions returns the client options for authenticating with the given
+// credentials. The options are added after the given base options, so that they take
+// precedence over them. If the credentials are nil, the base options are returned as is.
+// When the credentials impersonate a service account, the base options and credentials
+// file only authenticate the calls to the IAM Credentials API, and the returned options
+// hold only the impersonated token source. Otherwise the credentials file or base
+// options would take precedence over it, and the clients would not be impersonated.
+func CredentialOptions(ctx context.Context, credentials *reaperconfig.Credentials, baseOptions ...option.ClientOption) ([]option.ClientOption, error) {
+	if credentials == nil {
+		return baseOptions, nil
+	}
+	clientOptions := append([]option.ClientOption{}, baseOptions...)
+	credentialsFile := credentials.GetCredentialsFile()
+	scopes := credentials.GetScopes()
+
+	serviceAccount := credentials.GetImpersonateServiceAccount()
+	if len(serviceAccount) == 0 {
+		if len(credentialsFile) > 0 {
+			clientOptions = append(clientOptions, option.WithCredentialsFile(credentialsFile))
+		}
+		if len(scopes) > 0 {
+			clientOptions = append(clientOptions, option.WithScopes(scopes...))
+		}
+		return clientOptions, nil
+	}
+	if len(credentialsFile) > 0 {
+		// The credentials file is loaded into a token source, since a token source in the
+		// base options would otherwise take precedence over it.
+		fileTokenSource, err := credentialsFileTokenSource(ctx, credentialsFile)
+		if err != nil {
+			return nil, err
+		}
+		clientOptions = append(clientOptions, option.WithTokenSource(fileTokenSource))
+	}
+	if len(scopes) == 0 {
+		scopes = []string{cloudPlatformScope}
+	}
+	tokenSource, err := impersonatedTokenSource(ctx, serviceAccount, scopes, clientOptions...)
+	if err != nil {
+		return nil, err
+	}
+	return []option.ClientOption{option.WithTokenSource(tokenSource)}, nil
+}
+
+// credentialsFileTokenSource returns a token source for cloud-platform access tokens of
+// the service account key file at the given path.
+func credentialsFileTokenSource(ctx context.Context, credentialsFile string) (oauth2.TokenSource, error) {
+	data, err := ioutil.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading credentials file %s failed with the following error: %s", credentialsFile, err.Error())
+	}
+	fileCredentials, err := google.CredentialsFromJSON(ctx, data, cloudPlatformScope)
+	if err != nil {
+		return nil, fmt.Errorf("parsing credentials file %s failed with the following error: %s", credentialsFile, err.Error())
+	}
+	return fileCredentials.TokenSource, nil
+}
+
+// impersonatedTokenSource returns a token source for access tokens of the given service
+// account, which are created through the IAM Credentials API by authenticating with the
+// given options.
+func impersonatedTokenSource(ctx context.Context, serviceAccount string, scopes []string, clientOptions ...option.ClientOption) (oauth2.TokenSource, error) {
+	service, err := iamcredentials.NewService(ctx, clientOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("impersonating %s failed with the following error: %s", serviceAccount, err.Error())
+	}
+	source := &impersonationSource{
+		ctx:            ctx,
+		service:        service,
+		serviceAccount: serviceAccount,
+		scopes:         scopes,
+	}
+	return oauth2.ReuseTokenSource(nil, source), nil
+}
+
+// impersonationSource creates a new access token for a service account each time a token
+// is needed.
+type impersonationSource struct {
+	ctx            context.Context
+	service        *iamcredentials.Service
+	serviceAccount string
+	scopes         []string
+}
+
+// Token creates an access token for the service account.
+func (source *impersonationSource) Token() (*oauth2.Token, error) {
+	name := fmt.Sprintf("projects/-/serviceAccounts/%s", source.serviceAccount)
+	request := &iamcredentials.GenerateAccessTokenRequest{Scope: source.scopes}
+	response, err := source.service.Projects.ServiceAccounts.GenerateAccessToken(name, request).Context(source.ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("creating access token for %s failed with the following error: %s", source.serviceAccount, err.Error())
+	}
+	expiry, err := time.Parse(time.RFC3339, response.ExpireTime)
+	if err != nil {
+		return nil, fmt.Errorf("access token for %s has invalid expire time %s", source.serviceAccount, response.ExpireTime)
+	}
+	return &oauth2.Token{AccessToken: response.AccessToken, TokenType: "Bearer", Expiry: expiry}, nil
+}
@@ -0,0 +1,176 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clients
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/utils"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"golang.org/x/oauth2"
+	iamcredentials "google.golang.org/api/iamcredentials/v1"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+)
+
+// CredentialOptionsTestCase sets whether the base options authenticate with the server
+// token or the credentials file, and whether the credentials set the credentials file.
+type CredentialOptionsTestCase struct {
+	BaseCredentialsFile       bool
+	CredentialsFile           bool
+	ImpersonateServiceAccount string
+	ExpectedToken             string
+	ExpectedImpersonatorToken string
+}
+
+var credentialOptionsTestCases = []CredentialOptionsTestCase{
+	CredentialOptionsTestCase{false, false, "", "server", ""},
+	CredentialOptionsTestCase{true, false, "", "key-file", ""},
+	CredentialOptionsTestCase{false, false, "reaper@project.iam.gserviceaccount.com", "impersonated", "server"},
+	CredentialOptionsTestCase{false, true, "reaper@project.iam.gserviceaccount.com", "impersonated", "key-file"},
+	CredentialOptionsTestCase{true, false, "reaper@project.iam.gserviceaccount.com", "impersonated", "key-file"},
+	CredentialOptionsTestCase{true, true, "reaper@project.iam.gserviceaccount.com", "impersonated", "key-file"},
+}
+
+func TestCredentialOptions(t *testing.T) {
+	var apiToken, impersonatorToken string
+	server := utils.CreateServer(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case req.URL.Path == "/token":
+			w.Write([]byte(`{"access_token": "key-file", "token_type": "Bearer", "expires_in": 3600}`))
+		case strings.HasSuffix(req.URL.Path, ":generateAccessToken"):
+			impersonatorToken = strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+			w.Write([]byte(`{"accessToken": "impersonated", "expireTime": "2999-01-01T00:00:00Z"}`))
+		default:
+			apiToken = strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+			w.Write([]byte(`{}`))
+		}
+	})
+	defer server.Close()
+	credentialsFile := createCredentialsFile(t, server.URL+"/token")
+	defer os.Remove(credentialsFile)
+
+	for _, testCase := range credentialOptionsTestCases {
+		apiToken, impersonatorToken = "", ""
+		credentials := &reaperconfig.Credentials{ImpersonateServiceAccount: testCase.ImpersonateServiceAccount}
+		if testCase.CredentialsFile {
+			credentials.CredentialsFile = credentialsFile
+		}
+		baseOptions := []option.ClientOption{option.WithEndpoint(server.URL)}
+		if testCase.BaseCredentialsFile {
+			baseOptions = append(baseOptions, option.WithCredentialsFile(credentialsFile))
+		} else {
+			baseOptions = append(baseOptions, option.WithTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "server"})))
+		}
+
+		ctx := context.Background()
+		clientOptions, err := CredentialOptions(ctx, credentials, baseOptions...)
+		if err != nil {
+			t.Fatalf("CredentialOptions(%v) failed with the following error: %s", credentials, err.Error())
+		}
+		client, _, err := htransport.NewClient(ctx, append(clientOptions, option.WithScopes(cloudPlatformScope))...)
+		if err != nil {
+			t.Fatalf("Creating a client for %v failed with the following error: %s", credentials, err.Error())
+		}
+		response, err := client.Get(server.URL + "/api")
+		if err != nil {
+			t.Fatalf("Calling the API with %v failed with the following error: %s", credentials, err.Error())
+		}
+		response.Body.Close()
+
+		if apiToken != testCase.ExpectedToken {
+			t.Errorf("Expected the API to be called with the %s token for %v, got %s", testCase.ExpectedToken, credentials, apiToken)
+		}
+		if impersonatorToken != testCase.ExpectedImpersonatorToken {
+			t.Errorf("Expected the impersonation to use the %s token for %v, got %s", testCase.ExpectedImpersonatorToken, credentials, impersonatorToken)
+		}
+	}
+}
+
+// createCredentialsFile writes a service account key file, whose tokens are created at
+// the given token URL, and returns its path.
+func createCredentialsFile(t *testing.T, tokenURL string) string {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Generating a private key failed with the following error: %s", err.Error())
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	key, _ := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"client_email":   "server@project.iam.gserviceaccount.com",
+		"private_key_id": "1",
+		"private_key":    string(keyPEM),
+		"token_uri":      tokenURL,
+	})
+
+	keyFile, err := ioutil.TempFile("", "key")
+	if err != nil {
+		t.Fatalf("Creating the credentials file failed with the following error: %s", err.Error())
+	}
+	defer keyFile.Close()
+	if _, err := keyFile.Write(key); err != nil {
+		t.Fatalf("Writing the credentials file failed with the following error: %s", err.Error())
+	}
+	return keyFile.Name()
+}
+
+func TestImpersonatedTokenSource(t *testing.T) {
+	var paths []string
+	var scopes []string
+	server := utils.CreateServer(func(w http.ResponseWriter, req *http.Request) {
+		paths = append(paths, req.URL.Path)
+		var request iamcredentials.GenerateAccessTokenRequest
+		json.NewDecoder(req.Body).Decode(&request)
+		scopes = request.Scope
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"accessToken": "impersonated", "expireTime": "2999-01-01T00:00:00Z"}`))
+	})
+	defer server.Close()
+
+	serviceAccount := "reaper@project.iam.gserviceaccount.com"
+	tokenSource, err := impersonatedTokenSource(context.Background(), serviceAccount, []string{cloudPlatformScope}, utils.GetTestOptions(server)...)
+	if err != nil {
+		t.Fatalf("impersonatedTokenSource failed with the following error: %s", err.Error())
+	}
+	for idx := 0; idx < 2; idx++ {
+		token, err := tokenSource.Token()
+		if err != nil {
+			t.Fatalf("Token failed with the following error: %s", err.Error())
+		}
+		if token.AccessToken != "impersonated" {
+			t.Errorf("Expected the impersonated access token, got %s", token.AccessToken)
+		}
+	}
+
+	expectedPaths := []string{"/v1/projects/-/serviceAccounts/" + serviceAccount + ":generateAccessToken"}
+	if !reflect.DeepEqual(paths, expectedPaths) {
+		t.Errorf("Expected the token to be created once at %v, got %v", expectedPaths, paths)
+	}
+	if !reflect.DeepEqual(scopes, []string{cloudPlatformScope}) {
+		t.Errorf("Expected the token to be created with the cloud-platform scope, got %v", scopes)
+	}
+}
@@ -16,18 +16,35 @@ package gce
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
 	compute "google.golang.org/api/compute/v1"
 	"google.golang.org/api/option"
+	"google.golang.org/api/option/internaloption"
+	htransport "google.golang.org/api/transport/http"
 
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/clients/batch"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/operations"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
 )
 
+// computeEndpoint is the default endpoint of the Compute Engine API.
+const computeEndpoint = "https://compute.googleapis.com/compute/v1/projects/"
+
 // Client for a Compute Engine Resource.
 type GCEClient struct {
 	Client *compute.Service
+	// Poller waits for the operations returned by Compute Engine to be done.
+	Poller     *operations.Poller
+	httpClient *http.Client
+	batchURL   string
+	basePath   string
+	ctx        context.Context
 }
 
 func NewGCEClient() *GCEClient {
@@ -38,40 +55,149 @@ func NewGCEClient() *GCEClient {
 // https://pkg.go.dev/google.golang.org/api/option?tab=doc for more
 // information about passing options.
 func (client *GCEClient) Auth(ctx context.Context, opts ...option.ClientOption) error {
-	authedClient, err := compute.NewService(ctx, opts...)
+	opts = append([]option.ClientOption{
+		option.WithScopes(compute.ComputeScope),
+		internaloption.WithDefaultEndpoint(computeEndpoint),
+	}, opts...)
+	httpClient, endpoint, err := htransport.NewClient(ctx, opts...)
+	if err != nil {
+		return err
+	}
+	authedClient, err := compute.NewService(ctx, option.WithHTTPClient(httpClient), option.WithEndpoint(endpoint))
+	if err != nil {
+		return err
+	}
+	batchURL, basePath, err := batch.URLs(endpoint)
 	if err != nil {
 		return err
 	}
 	client.Client = authedClient
+	client.httpClient = httpClient
+	client.batchURL = batchURL
+	client.basePath = basePath
+	client.ctx = ctx
+	if client.Poller == nil {
+		client.Poller = operations.NewPoller()
+	}
 	return nil
 }
 
-// GetResources gets the Compute Engine instances that pass the filters defined in the ResourceConfig
+// GetResources gets the Compute Engine instances that pass the filters defined in the ResourceConfig.
+// If listing fails in some zones, the instances from the remaining zones are returned along with
+// a resources.ZoneErrors describing the failed zones.
 func (client *GCEClient) GetResources(projectID string, config *reaperconfig.ResourceConfig) ([]*resources.Resource, error) {
 	var instances []*resources.Resource
+	zoneErrors := make(resources.ZoneErrors)
 	zones := config.GetZones()
 	for _, zone := range zones {
 		zoneInstancesCall := client.Client.Instances.List(projectID, zone)
 		// Info on filtering: https://cloud.google.com/compute/docs/reference/rest/v1/instances/list
 		// zoneInstancesCall.Filter()
-		instancesInZone, err := zoneInstancesCall.Do()
+		instancesInZone, err := zoneInstancesCall.Context(client.ctx).Do()
 		if err != nil {
-			return nil, err
+			zoneErrors[zone] = err
+			continue
 		}
 		for _, instance := range instancesInZone.Items {
 			timeCreated, _ := time.Parse(time.RFC3339, instance.CreationTimestamp)
 			parsedResource := resources.NewResource(instance.Name, zone, timeCreated, reaperconfig.ResourceType_GCE_VM)
+			parsedResource.ProjectID = projectID
+			parsedResource.Labels = instance.Labels
+			parsedResource.Protected = instance.DeletionProtection
 			if resources.ShouldAddResourceToWatchlist(parsedResource, config.GetNameFilter(), config.GetSkipFilter()) {
 				instances = append(instances, parsedResource)
 			}
 		}
 	}
+	if len(zoneErrors) > 0 {
+		return instances, zoneErrors
+	}
 	return instances, nil
 }
 
-// DeleteResource deletes the specificed Compute Engine instance.
+// DeleteResource deletes the specificed Compute Engine instance, and waits for the delete
+// operation to be done. An error is returned if the operation failed.
 func (client *GCEClient) DeleteResource(projectID string, resource *resources.Resource) error {
 	deleteInstanceCall := client.Client.Instances.Delete(projectID, resource.Zone, resource.Name)
-	_, err := deleteInstanceCall.Do()
-	return err
+	operation, err := deleteInstanceCall.Context(client.ctx).Do()
+	if err != nil {
+		return err
+	}
+	return client.waitForOperation(projectID, resource.Zone, operation)
+}
+
+// DeleteResources deletes the specified Compute Engine instances with batch requests of up
+// to 100 deletes, waits for each delete operation to be done, and returns the error of each
+// delete in the same order.
+func (client *GCEClient) DeleteResources(projectID string, resourcesToDelete []*resources.Resource) []error {
+	errs := make([]error, len(resourcesToDelete))
+	for start := 0; start < len(resourcesToDelete); start += batch.MaxRequests {
+		end := start + batch.MaxRequests
+		if end > len(resourcesToDelete) {
+			end = len(resourcesToDelete)
+		}
+		var requests []batch.Request
+		for _, resource := range resourcesToDelete[start:end] {
+			path := fmt.Sprintf(
+				"%s%s/zones/%s/instances/%s",
+				client.basePath, url.PathEscape(projectID), url.PathEscape(resource.Zone), url.PathEscape(resource.Name),
+			)
+			requests = append(requests, batch.Request{Method: http.MethodDelete, Path: path})
+		}
+
+		// Every delete is started before waiting on any of them, so that the operations run
+		// concurrently.
+		responses := batch.Do(client.ctx, client.httpClient, client.batchURL, requests)
+		for idx, response := range responses {
+			resource := resourcesToDelete[start+idx]
+			if response.Err != nil {
+				errs[start+idx] = response.Err
+				continue
+			}
+			operation := &compute.Operation{}
+			if err := json.Unmarshal(response.Body, operation); err != nil {
+				errs[start+idx] = fmt.Errorf("decoding delete operation failed with the following error: %s", err.Error())
+				continue
+			}
+			errs[start+idx] = client.waitForOperation(projectID, resource.Zone, operation)
+		}
+	}
+	return errs
+}
+
+// MarkResource marks the specified Compute Engine instance for deletion by adding the
+// mark label to the instance's labels.
+func (client *GCEClient) MarkResource(projectID string, resource *resources.Resource, markedAt time.Time) error {
+	instance, err := client.Client.Instances.Get(projectID, resource.Zone, resource.Name).Context(client.ctx).Do()
+	if err != nil {
+		return err
+	}
+	labels := make(map[string]string)
+	for key, value := range instance.Labels {
+		labels[key] = value
+	}
+	labels[resources.MarkLabel] = resources.MarkValue(markedAt)
+
+	setLabelsRequest := &compute.InstancesSetLabelsRequest{
+		Labels:           labels,
+		LabelFingerprint: instance.LabelFingerprint,
+	}
+	operation, err := client.Client.Instances.SetLabels(projectID, resource.Zone, resource.Name, setLabelsRequest).Context(client.ctx).Do()
+	if err != nil {
+		return err
+	}
+	return client.waitForOperation(projectID, resource.Zone, operation)
+}
+
+// waitForOperation waits for a zonal operation to be done, and returns the error the
+// operation finished with, if any.
+func (client *GCEClient) waitForOperation(projectID, zone string, operation *compute.Operation) error {
+	zonalOperation := &zoneOperation{
+		ctx:       client.ctx,
+		client:    client.Client,
+		projectID: projectID,
+		zone:      zone,
+		operation: operation,
+	}
+	return client.Poller.Wait(client.ctx, zonalOperation)
 }
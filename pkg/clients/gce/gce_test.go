@@ -24,8 +24,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/operations"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/utils"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	compute "google.golang.org/api/compute/v1"
 	"google.golang.org/api/option"
 )
 
@@ -122,6 +125,9 @@ func TestGetResources(t *testing.T) {
 		if err != nil {
 			t.Error(err)
 		}
+		for _, resource := range testCase.Expected {
+			resource.ProjectID = testCase.ProjectID
+		}
 		if !compareResourceLists(result, testCase.Expected) {
 			// Improve this error message
 			// Can't just print resource arrays since it is impossible to read
@@ -130,6 +136,48 @@ func TestGetResources(t *testing.T) {
 	}
 }
 
+// TestGetResourcesZoneFailure tests that when listing one zone fails, the client still returns
+// the resources from the other zones, and reports the error for the failed zone.
+func TestGetResourcesZoneFailure(t *testing.T) {
+	server := createServer(func(w http.ResponseWriter, req *http.Request) {
+		if strings.Contains(req.URL.Path, "/failingZone/") {
+			http.Error(w, "backend error", http.StatusServiceUnavailable)
+			return
+		}
+		getResourcesHandler(w, req)
+	})
+	defer server.Close()
+	testClient := createTestGCEClient(server)
+
+	setupManyTestInstances()
+	config := &reaperconfig.ResourceConfig{
+		Zones:      []string{"testZone1", "failingZone", "testZone2"},
+		NameFilter: "test",
+	}
+	result, err := testClient.GetResources("project1", config)
+
+	zoneErrors, isZoneErrors := err.(resources.ZoneErrors)
+	if !isZoneErrors {
+		t.Fatalf("Expected resources.ZoneErrors, got: %v", err)
+	}
+	if _, failed := zoneErrors["failingZone"]; !failed || len(zoneErrors) != 1 {
+		t.Errorf("Expected only failingZone to fail, got: %v", zoneErrors)
+	}
+	expected := []*resources.Resource{
+		resources.NewResource("test1", "testZone1", timeCreated, reaperconfig.ResourceType_GCE_VM),
+		resources.NewResource("test2", "testZone1", timeCreated, reaperconfig.ResourceType_GCE_VM),
+		resources.NewResource("test3", "testZone1", timeCreated, reaperconfig.ResourceType_GCE_VM),
+		resources.NewResource("test1", "testZone2", timeCreated, reaperconfig.ResourceType_GCE_VM),
+		resources.NewResource("test2", "testZone2", timeCreated, reaperconfig.ResourceType_GCE_VM),
+	}
+	for _, resource := range expected {
+		resource.ProjectID = "project1"
+	}
+	if !compareResourceLists(result, expected) {
+		t.Errorf("Resources from the zones that did not fail not same as expected")
+	}
+}
+
 // A DeleteResourceTestCase is a struct for organizing test inputs and expected outputs
 // for testing client's the DeleteResource method.
 type DeleteResourceTestCase struct {
@@ -184,6 +232,130 @@ func TestDeleteResource(t *testing.T) {
 	}
 }
 
+// TestMarkResource tests that the Compute Engine client's MarkResource method adds the mark
+// label while keeping the instance's existing labels.
+func TestMarkResource(t *testing.T) {
+	var setLabelsRequest compute.InstancesSetLabelsRequest
+	server := createServer(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(req.URL.Path, "/setLabels") {
+			json.NewDecoder(req.Body).Decode(&setLabelsRequest)
+			w.Write([]byte(`{"status": "DONE"}`))
+			return
+		}
+		w.Write([]byte(`{"name": "test", "labels": {"owner": "tester"}, "labelFingerprint": "fingerprint"}`))
+	})
+	defer server.Close()
+	testClient := createTestGCEClient(server)
+
+	markedAt := time.Unix(1592402400, 0)
+	resource := resources.NewResource("test", "testZone1", timeCreated, reaperconfig.ResourceType_GCE_VM)
+	if err := testClient.MarkResource("project1", resource, markedAt); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedLabels := map[string]string{"owner": "tester", resources.MarkLabel: "1592402400"}
+	if !reflect.DeepEqual(setLabelsRequest.Labels, expectedLabels) {
+		t.Errorf("Expected labels %v, got %v", expectedLabels, setLabelsRequest.Labels)
+	}
+	if setLabelsRequest.LabelFingerprint != "fingerprint" {
+		t.Errorf("Expected label fingerprint to be passed through, got %s", setLabelsRequest.LabelFingerprint)
+	}
+}
+
+type WaitForOperationTestCase struct {
+	// Operations are returned in order, first by the delete call, then by each
+	// call to get the operation.
+	Operations  []string
+	ExpectError bool
+}
+
+var waitForOperationTestCases = []WaitForOperationTestCase{
+	WaitForOperationTestCase{[]string{`{"name": "op", "status": "DONE"}`}, false},
+	WaitForOperationTestCase{
+		[]string{
+			`{"name": "op", "status": "PENDING"}`,
+			`{"name": "op", "status": "RUNNING"}`,
+			`{"name": "op", "status": "DONE"}`,
+		},
+		false,
+	},
+	WaitForOperationTestCase{
+		[]string{
+			`{"name": "op", "status": "RUNNING"}`,
+			`{"name": "op", "status": "DONE", "httpErrorStatusCode": 400, "error": {"errors": [{"code": "RESOURCE_IN_USE_BY_ANOTHER_RESOURCE", "message": "in use"}]}}`,
+		},
+		true,
+	},
+}
+
+// TestDeleteResourceWaitsForOperation tests that DeleteResource only returns once the
+// delete operation is done, and surfaces the operation's error.
+func TestDeleteResourceWaitsForOperation(t *testing.T) {
+	for _, testCase := range waitForOperationTestCases {
+		var numRequests int
+		server := createServer(func(w http.ResponseWriter, req *http.Request) {
+			if numRequests > 0 && !strings.HasSuffix(req.URL.Path, "/testZone1/operations/op") {
+				t.Errorf("Expected the operation to be polled, got request to %s", req.URL.Path)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(testCase.Operations[numRequests]))
+			numRequests++
+		})
+		testClient := createTestGCEClient(server)
+		testClient.Poller = &operations.Poller{Interval: time.Millisecond, Timeout: time.Second}
+
+		resource := resources.NewResource("test", "testZone1", timeCreated, reaperconfig.ResourceType_GCE_VM)
+		err := testClient.DeleteResource("project1", resource)
+		if (err != nil) != testCase.ExpectError {
+			t.Errorf("DeleteResource returned error %v; expected error: %v", err, testCase.ExpectError)
+		}
+		if numRequests != len(testCase.Operations) {
+			t.Errorf("Expected %d requests, got %d", len(testCase.Operations), numRequests)
+		}
+		server.Close()
+	}
+}
+
+// TestDeleteResourcesBatch tests that DeleteResources deletes instances in a batch, and
+// reports the error of each delete on its own.
+func TestDeleteResourcesBatch(t *testing.T) {
+	var deletes []string
+	server := createServer(func(w http.ResponseWriter, req *http.Request) {
+		deletes = append(deletes, req.Method+" "+req.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(req.URL.Path, "/missing"):
+			http.Error(w, `{"error": {"code": 404, "message": "not found"}}`, http.StatusNotFound)
+		case strings.HasSuffix(req.URL.Path, "/failing"):
+			w.Write([]byte(`{"name": "op", "status": "DONE", "httpErrorStatusCode": 403,
+				"error": {"errors": [{"code": "FORBIDDEN", "message": "forbidden"}]}}`))
+		default:
+			w.Write([]byte(`{"name": "op", "status": "DONE"}`))
+		}
+	})
+	defer server.Close()
+	testClient := createTestGCEClient(server)
+
+	var toDelete []*resources.Resource
+	for _, name := range []string{"deleted", "missing", "failing"} {
+		toDelete = append(toDelete, resources.NewResource(name, "testZone1", timeCreated, reaperconfig.ResourceType_GCE_VM))
+	}
+	errs := testClient.DeleteResources("project1", toDelete)
+
+	expectedDeletes := []string{
+		"DELETE /project1/zones/testZone1/instances/deleted",
+		"DELETE /project1/zones/testZone1/instances/missing",
+		"DELETE /project1/zones/testZone1/instances/failing",
+	}
+	if !reflect.DeepEqual(deletes, expectedDeletes) {
+		t.Errorf("Expected deletes %v, got %v", expectedDeletes, deletes)
+	}
+	if len(errs) != 3 || errs[0] != nil || errs[1] == nil || errs[2] == nil {
+		t.Errorf("Expected only the first delete to succeed, got errors %v", errs)
+	}
+}
+
 type GetResourcesResponse struct {
 	Items []Instance
 }
@@ -203,7 +375,8 @@ func getResourcesHandler(w http.ResponseWriter, req *http.Request) {
 }
 
 type DeleteResourceResponse struct {
-	Text string
+	Text   string
+	Status string `json:"status"`
 }
 
 // Mock server's http handler for DeleteResource test
@@ -226,7 +399,7 @@ func deleteResourcesHandler(w http.ResponseWriter, req *http.Request) {
 	// Removing instance with name match in zone and project
 	testInstances[projectID][zone] = append(instancesInZone[:index], instancesInZone[index+1:]...)
 
-	res := DeleteResourceResponse{"Successfully Deleted"}
+	res := DeleteResourceResponse{"Successfully Deleted", "DONE"}
 	w.Header().Set("Content-Type", "application/json")
 
 	json.NewEncoder(w).Encode(res)
@@ -263,7 +436,7 @@ func compareResourceLists(result, expected []*resources.Resource) bool {
 // createServer is a helper function to create a fake server
 // where http requsts will be rerouted for testing
 func createServer(handler http.HandlerFunc) *httptest.Server {
-	return httptest.NewServer(http.HandlerFunc(handler))
+	return httptest.NewServer(utils.BatchHandler(handler))
 }
 
 // createTestGCEClient creates a Compute Engine client that sends
@@ -0,0 +1,71 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gce
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// zoneOperation is a Compute Engine zonal operation that can be waited on with an
+// operations.Poller.
+type zoneOperation struct {
+	ctx       context.Context
+	client    *compute.Service
+	projectID string
+	zone      string
+	operation *compute.Operation
+}
+
+// Done returns whether the operation has finished, and the error it finished with. If
+// the operation has an HTTP error status code, the error is a *googleapi.Error with that
+// code, so that it can be classified like the error of any other call.
+func (op *zoneOperation) Done() (bool, error) {
+	if op.operation.Status != "DONE" {
+		return false, nil
+	}
+	if op.operation.Error == nil || len(op.operation.Error.Errors) == 0 {
+		return true, nil
+	}
+
+	var errorMessages []string
+	for _, operationError := range op.operation.Error.Errors {
+		errorMessages = append(errorMessages, fmt.Sprintf("%s: %s", operationError.Code, operationError.Message))
+	}
+	message := fmt.Sprintf("operation %s failed: %s", op.Name(), strings.Join(errorMessages, "; "))
+	if op.operation.HttpErrorStatusCode != 0 {
+		return true, &googleapi.Error{Code: int(op.operation.HttpErrorStatusCode), Message: message}
+	}
+	return true, fmt.Errorf("%s", message)
+}
+
+// Refresh gets the latest state of the operation.
+func (op *zoneOperation) Refresh() error {
+	operation, err := op.client.ZoneOperations.Get(op.projectID, op.zone, op.operation.Name).Context(op.ctx).Do()
+	if err != nil {
+		return err
+	}
+	op.operation = operation
+	return nil
+}
+
+// Name returns the name of the operation.
+func (op *zoneOperation) Name() string {
+	return op.operation.Name
+}
@@ -16,18 +16,39 @@ package gcs
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
 	"cloud.google.com/go/storage"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/clients/batch"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
+	"google.golang.org/api/option/internaloption"
+	htransport "google.golang.org/api/transport/http"
 )
 
-// gcsBaseClient is common between GCS Buckets and GCS Objects.
+// storageEndpoint is the default endpoint of the GCS JSON API.
+const storageEndpoint = "https://storage.googleapis.com/storage/v1/"
+
+// emptyBucketPageSize is the number of object generations deleted at a time when a bucket
+// is emptied, which is the most GCS lists in a single page.
+const emptyBucketPageSize = 1000
+
+// gcsBaseClient is common between GCS Buckets and GCS Objects. Besides the storage client,
+// it has an HTTP client for the GCS JSON API, which is used to batch object deletes.
 type gcsBaseClient struct {
-	client *storage.Client
-	ctx    context.Context
+	client     *storage.Client
+	httpClient *http.Client
+	batchURL   string
+	basePath   string
+	ctx        context.Context
 }
 
 // Auth authenticates the GCS client for both GCS Buckets and Objects.
@@ -36,11 +57,68 @@ func (client *gcsBaseClient) Auth(ctx context.Context, opts ...option.ClientOpti
 	if err != nil {
 		return err
 	}
+	httpClient, endpoint, err := newJSONAPIClient(ctx, opts...)
+	if err != nil {
+		return err
+	}
+	batchURL, basePath, err := batch.URLs(endpoint)
+	if err != nil {
+		return err
+	}
 	client.client = authedClient
+	client.httpClient = httpClient
+	client.batchURL = batchURL
+	client.basePath = basePath
 	client.ctx = ctx
 	return nil
 }
 
+// newJSONAPIClient creates an authenticated HTTP client for the GCS JSON API, and returns it
+// along with the endpoint of the API, which ends with a slash.
+func newJSONAPIClient(ctx context.Context, opts ...option.ClientOption) (*http.Client, string, error) {
+	opts = append([]option.ClientOption{
+		option.WithScopes(storage.ScopeFullControl),
+		internaloption.WithDefaultEndpoint(storageEndpoint),
+	}, opts...)
+	httpClient, endpoint, err := htransport.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, "", err
+	}
+	return httpClient, strings.TrimSuffix(endpoint, "/") + "/", nil
+}
+
+// objectGeneration identifies a single generation of a GCS object.
+type objectGeneration struct {
+	bucket     string
+	name       string
+	generation int64
+}
+
+// deleteObjects deletes the given object generations with batch requests to the GCS JSON API,
+// and returns the error of each delete in the same order. A generation of zero deletes the
+// live version of the object.
+func (client *gcsBaseClient) deleteObjects(objects []objectGeneration) []error {
+	errs := make([]error, 0, len(objects))
+	for start := 0; start < len(objects); start += batch.MaxRequests {
+		end := start + batch.MaxRequests
+		if end > len(objects) {
+			end = len(objects)
+		}
+		var requests []batch.Request
+		for _, object := range objects[start:end] {
+			path := fmt.Sprintf("%sb/%s/o/%s", client.basePath, url.PathEscape(object.bucket), url.PathEscape(object.name))
+			if object.generation != 0 {
+				path = fmt.Sprintf("%s?generation=%d", path, object.generation)
+			}
+			requests = append(requests, batch.Request{Method: http.MethodDelete, Path: path})
+		}
+		for _, response := range batch.Do(client.ctx, client.httpClient, client.batchURL, requests) {
+			errs = append(errs, response.Err)
+		}
+	}
+	return errs
+}
+
 // GCSBucketClient is a client for GCS Buckets.
 type GCSBucketClient struct {
 	*gcsBaseClient
@@ -51,11 +129,14 @@ func NewGCSBucketClient() *GCSBucketClient {
 	return &GCSBucketClient{&gcsBaseClient{}}
 }
 
-// GetResources gets the GCS Bucket resources that match the given ResourceConfig.
+// GetResources gets the GCS Bucket resources that match the given ResourceConfig. The buckets
+// of every zone are listed together, so if listing fails, no buckets are returned along with a
+// resources.ZoneErrors that fails every zone of the ResourceConfig.
 func (client *GCSBucketClient) GetResources(projectID string, config *reaperconfig.ResourceConfig) ([]*resources.Resource, error) {
 	var instances []*resources.Resource
 	bucketIterator := client.client.Buckets(client.ctx, projectID)
-	for bucket, done := bucketIterator.Next(); done == nil; bucket, done = bucketIterator.Next() {
+	bucket, err := bucketIterator.Next()
+	for ; err == nil; bucket, err = bucketIterator.Next() {
 		bucketZone := bucket.Location
 		for _, zone := range config.GetZones() {
 			if strings.Compare(bucketZone, strings.ToUpper(zone)) != 0 {
@@ -64,21 +145,107 @@ func (client *GCSBucketClient) GetResources(projectID string, config *reaperconf
 			name := bucket.Name
 			timeCreated := bucket.Created
 			parsedResource := resources.NewResource(name, bucketZone, timeCreated, reaperconfig.ResourceType_GCS_BUCKET)
+			parsedResource.ProjectID = projectID
+			parsedResource.Labels = bucket.Labels
+			parsedResource.ForceDelete = config.GetForceDelete()
 			if resources.ShouldAddResourceToWatchlist(parsedResource, config.GetNameFilter(), config.GetSkipFilter()) {
 				instances = append(instances, parsedResource)
 			}
 		}
 	}
+	if err != iterator.Done {
+		zoneErrors := make(resources.ZoneErrors)
+		for _, zone := range config.GetZones() {
+			zoneErrors[zone] = err
+		}
+		return nil, zoneErrors
+	}
 	return instances, nil
 }
 
-// DeleteResource deletes the given GCS Bucket.
+// DeleteResource deletes the given GCS Bucket. If the resource is force deleted, all of the
+// objects in the bucket are deleted first.
 func (client *GCSBucketClient) DeleteResource(projectID string, resource *resources.Resource) error {
 	bucketHandle := client.client.Bucket(resource.Name)
+	if resource.ForceDelete {
+		if err := client.emptyBucket(bucketHandle); err != nil {
+			return err
+		}
+	}
 	err := bucketHandle.Delete(client.ctx)
 	return err
 }
 
+// emptyBucket deletes every generation of every object in the bucket. If any object can not be
+// deleted because of a hold or retention policy, nothing is deleted and an error wrapping
+// resources.ErrUndeletable is returned, since the bucket can not be emptied until the object is
+// released. The objects are checked in a first listing of the bucket, and are then deleted a page
+// at a time while listing the bucket again, so that the objects are never all held in memory.
+func (client *GCSBucketClient) emptyBucket(bucketHandle *storage.BucketHandle) error {
+	objectIterator := bucketHandle.Objects(client.ctx, &storage.Query{Versions: true})
+	object, err := objectIterator.Next()
+	for ; err == nil; object, err = objectIterator.Next() {
+		if isObjectProtected(object) {
+			return fmt.Errorf(
+				"bucket %s contains object %s (generation %d) under a hold or retention policy: %w",
+				object.Bucket, object.Name, object.Generation, resources.ErrUndeletable,
+			)
+		}
+	}
+	if err != iterator.Done {
+		return err
+	}
+
+	pager := iterator.NewPager(bucketHandle.Objects(client.ctx, &storage.Query{Versions: true}), emptyBucketPageSize, "")
+	for {
+		var objects []*storage.ObjectAttrs
+		pageToken, err := pager.NextPage(&objects)
+		if err != nil {
+			return err
+		}
+		if err := client.deleteObjectPage(objects); err != nil {
+			return err
+		}
+		if len(pageToken) == 0 {
+			return nil
+		}
+	}
+}
+
+// deleteObjectPage deletes the given object generations, which are a page of the objects in a
+// bucket. Objects that were already deleted are ignored.
+func (client *GCSBucketClient) deleteObjectPage(objects []*storage.ObjectAttrs) error {
+	objectGenerations := make([]objectGeneration, len(objects))
+	for idx, object := range objects {
+		objectGenerations[idx] = objectGeneration{object.Bucket, object.Name, object.Generation}
+	}
+	for idx, err := range client.deleteObjects(objectGenerations) {
+		if err != nil && !isNotFound(err) {
+			return fmt.Errorf(
+				"deleting object %s (generation %d) failed with the following error: %s",
+				objects[idx].Name, objects[idx].Generation, err.Error(),
+			)
+		}
+	}
+	return nil
+}
+
+// isNotFound returns whether the error is a GCS JSON API error for a missing object.
+func isNotFound(err error) bool {
+	var apiError *googleapi.Error
+	return errors.As(err, &apiError) && apiError.Code == http.StatusNotFound
+}
+
+// MarkResource marks the given GCS Bucket for deletion by adding the mark label to the
+// bucket's labels.
+func (client *GCSBucketClient) MarkResource(projectID string, resource *resources.Resource, markedAt time.Time) error {
+	bucketHandle := client.client.Bucket(resource.Name)
+	var bucketUpdate storage.BucketAttrsToUpdate
+	bucketUpdate.SetLabel(resources.MarkLabel, resources.MarkValue(markedAt))
+	_, err := bucketHandle.Update(client.ctx, bucketUpdate)
+	return err
+}
+
 // GCSObjectClient is a client for GCS objects. Note that the Zone
 // for a GCS Object is the GCS Bucket name.
 type GCSObjectClient struct {
@@ -90,28 +257,94 @@ func NewGCSObjectClient() *GCSObjectClient {
 	return &GCSObjectClient{&gcsBaseClient{}}
 }
 
-// GetResources gets the GCS Object resources that match the given ResourceConfig.
+// GetResources gets the GCS Object resources that match the given ResourceConfig. Each resource
+// is a single generation of an object. If the ResourceConfig includes noncurrent versions, every
+// generation of each object is returned, and the time created is the time the generation was
+// created. If listing fails in some buckets, the objects from the remaining buckets are returned
+// along with a resources.ZoneErrors describing the failed buckets.
 func (client *GCSObjectClient) GetResources(projectID string, config *reaperconfig.ResourceConfig) ([]*resources.Resource, error) {
 	var instances []*resources.Resource
+	zoneErrors := make(resources.ZoneErrors)
 
 	for _, bucket := range config.GetZones() {
 		bucketHandle := client.client.Bucket(bucket)
-		objectIterator := bucketHandle.Objects(client.ctx, nil)
+		query := &storage.Query{Versions: config.GetIncludeNoncurrentVersions()}
+		objectIterator := bucketHandle.Objects(client.ctx, query)
 
-		for object, done := objectIterator.Next(); done == nil; object, done = objectIterator.Next() {
+		var bucketInstances []*resources.Resource
+		object, err := objectIterator.Next()
+		for ; err == nil; object, err = objectIterator.Next() {
 			objectResource := resources.NewResource(object.Name, bucket, object.Created, reaperconfig.ResourceType_GCS_OBJECT)
+			objectResource.ProjectID = projectID
+			objectResource.Labels = object.Metadata
+			objectResource.Generation = object.Generation
+			objectResource.Protected = isObjectProtected(object)
 			if resources.ShouldAddResourceToWatchlist(objectResource, config.GetNameFilter(), config.GetSkipFilter()) {
-				instances = append(instances, objectResource)
+				bucketInstances = append(bucketInstances, objectResource)
 			}
 		}
+		if err != iterator.Done {
+			zoneErrors[bucket] = err
+			continue
+		}
+		instances = append(instances, bucketInstances...)
+	}
+	if len(zoneErrors) > 0 {
+		return instances, zoneErrors
 	}
 	return instances, nil
 }
 
-// DeleteResource deletes the given GCS Object.
+// isObjectProtected returns whether GCS will refuse to delete the object, because it is
+// under a hold or has not reached the end of its bucket's retention period.
+func isObjectProtected(object *storage.ObjectAttrs) bool {
+	return object.EventBasedHold || object.TemporaryHold || object.RetentionExpirationTime.After(time.Now())
+}
+
+// DeleteResource deletes the given GCS Object. The delete is pinned to the generation of the
+// resource, so that a newer generation of the object, written after the object was listed,
+// is never deleted.
 func (client *GCSObjectClient) DeleteResource(projectID string, resource *resources.Resource) error {
-	bucketHandle := client.client.Bucket(resource.Zone)
-	objectHandle := bucketHandle.Object(resource.Name)
+	objectHandle := client.objectHandle(resource)
 	err := objectHandle.Delete(client.ctx)
 	return err
 }
+
+// DeleteResources deletes the given GCS Objects with batch requests of up to 100 deletes,
+// and returns the error of each delete in the same order. As with DeleteResource, each
+// delete is pinned to the generation of the resource.
+func (client *GCSObjectClient) DeleteResources(projectID string, resourcesToDelete []*resources.Resource) []error {
+	objects := make([]objectGeneration, len(resourcesToDelete))
+	for idx, resource := range resourcesToDelete {
+		objects[idx] = objectGeneration{resource.Zone, resource.Name, resource.Generation}
+	}
+	return client.deleteObjects(objects)
+}
+
+// objectHandle returns the handle of the given GCS Object, pinned to its generation if known.
+func (client *GCSObjectClient) objectHandle(resource *resources.Resource) *storage.ObjectHandle {
+	objectHandle := client.client.Bucket(resource.Zone).Object(resource.Name)
+	if resource.Generation != 0 {
+		objectHandle = objectHandle.Generation(resource.Generation)
+	}
+	return objectHandle
+}
+
+// MarkResource marks the given GCS Object for deletion by adding the mark label to the
+// object's custom metadata.
+func (client *GCSObjectClient) MarkResource(projectID string, resource *resources.Resource, markedAt time.Time) error {
+	objectHandle := client.objectHandle(resource)
+	objectAttrs, err := objectHandle.Attrs(client.ctx)
+	if err != nil {
+		return err
+	}
+	metadata := make(map[string]string)
+	for key, value := range objectAttrs.Metadata {
+		metadata[key] = value
+	}
+	metadata[resources.MarkLabel] = resources.MarkValue(markedAt)
+
+	objectUpdate := storage.ObjectAttrsToUpdate{Metadata: metadata}
+	_, err = objectHandle.If(storage.Conditions{MetagenerationMatch: objectAttrs.Metageneration}).Update(client.ctx, objectUpdate)
+	return err
+}
@@ -16,6 +16,8 @@ package gcs
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"reflect"
 	"strings"
@@ -25,6 +27,7 @@ import (
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/utils"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"google.golang.org/api/googleapi"
 )
 
 // Maybe look here for testing:
@@ -85,6 +88,283 @@ func TestDeleteBucketResource(t *testing.T) {
 	}
 }
 
+type ForceDeleteBucketTestCase struct {
+	Objects           string
+	ExpectedRequests  []string
+	ExpectUndeletable bool
+}
+
+var forceDeleteBucketTestCases = []ForceDeleteBucketTestCase{
+	ForceDeleteBucketTestCase{
+		`{"items": [
+			{"name": "a", "bucket": "test-bucket", "generation": "1"},
+			{"name": "a", "bucket": "test-bucket", "generation": "2"},
+			{"name": "b", "bucket": "test-bucket", "generation": "3"}
+		]}`,
+		[]string{
+			"GET /b/test-bucket/o versions=true",
+			"GET /b/test-bucket/o versions=true",
+			"DELETE /b/test-bucket/o/a generation=1",
+			"DELETE /b/test-bucket/o/a generation=2",
+			"DELETE /b/test-bucket/o/b generation=3",
+			"DELETE /b/test-bucket ",
+		},
+		false,
+	},
+	ForceDeleteBucketTestCase{
+		`{"items": [
+			{"name": "a", "bucket": "test-bucket", "generation": "1"},
+			{"name": "held", "bucket": "test-bucket", "generation": "2", "temporaryHold": true}
+		]}`,
+		[]string{"GET /b/test-bucket/o versions=true"},
+		true,
+	},
+	ForceDeleteBucketTestCase{
+		`{"items": [
+			{"name": "retained", "bucket": "test-bucket", "generation": "1", "retentionExpirationTime": "2999-01-01T00:00:00Z"}
+		]}`,
+		[]string{"GET /b/test-bucket/o versions=true"},
+		true,
+	},
+}
+
+func TestForceDeleteBucket(t *testing.T) {
+	for _, testCase := range forceDeleteBucketTestCases {
+		var requests []string
+		server := utils.CreateServer(func(w http.ResponseWriter, req *http.Request) {
+			query := req.URL.Query()
+			var params []string
+			for _, param := range []string{"versions", "generation"} {
+				if value := query.Get(param); len(value) > 0 {
+					params = append(params, param+"="+value)
+				}
+			}
+			requests = append(requests, req.Method+" "+req.URL.Path+" "+strings.Join(params, "&"))
+			if req.Method == http.MethodGet {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(testCase.Objects))
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+
+		client := NewGCSBucketClient()
+		client.Auth(context.TODO(), utils.GetTestOptions(server)...)
+		bucket := resources.NewResource("test-bucket", "US", time.Now(), reaperconfig.ResourceType_GCS_BUCKET)
+		bucket.ForceDelete = true
+
+		err := client.DeleteResource("SampleProject1", bucket)
+		if testCase.ExpectUndeletable != errors.Is(err, resources.ErrUndeletable) {
+			t.Errorf("DeleteResource returned %v; expected undeletable: %v", err, testCase.ExpectUndeletable)
+		}
+		if !testCase.ExpectUndeletable && err != nil {
+			t.Errorf("Force delete failed with the following error: %s", err.Error())
+		}
+		if !reflect.DeepEqual(requests, testCase.ExpectedRequests) {
+			t.Errorf("Expected requests %v, got %v", testCase.ExpectedRequests, requests)
+		}
+		server.Close()
+	}
+}
+
+func TestForceDeleteBucketPages(t *testing.T) {
+	// The bucket has a full page of objects, and a second page with a single object.
+	var objects []string
+	for idx := 0; idx <= emptyBucketPageSize; idx++ {
+		objects = append(objects, fmt.Sprintf(`{"name": "object-%d", "bucket": "test-bucket", "generation": "1"}`, idx))
+	}
+	pages := map[string]string{
+		"":       `{"items": [` + strings.Join(objects[:emptyBucketPageSize], ", ") + `], "nextPageToken": "page-2"}`,
+		"page-2": `{"items": [` + objects[emptyBucketPageSize] + `]}`,
+	}
+
+	// Each listing is recorded along with the number of objects deleted after it.
+	var requests []string
+	var objectDeletes int
+	server := utils.CreateServer(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.Method == http.MethodGet:
+			if objectDeletes > 0 {
+				requests = append(requests, fmt.Sprintf("DELETE %d objects", objectDeletes))
+				objectDeletes = 0
+			}
+			pageToken := req.URL.Query().Get("pageToken")
+			requests = append(requests, "GET page "+pageToken)
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(pages[pageToken]))
+			return
+		case strings.HasPrefix(req.URL.Path, "/b/test-bucket/o/"):
+			objectDeletes++
+		default:
+			requests = append(requests, fmt.Sprintf("DELETE %d objects", objectDeletes), "DELETE bucket")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	defer server.Close()
+
+	client := NewGCSBucketClient()
+	client.Auth(context.TODO(), utils.GetTestOptions(server)...)
+	bucket := resources.NewResource("test-bucket", "US", time.Now(), reaperconfig.ResourceType_GCS_BUCKET)
+	bucket.ForceDelete = true
+	if err := client.DeleteResource("SampleProject1", bucket); err != nil {
+		t.Fatalf("Force delete failed with the following error: %s", err.Error())
+	}
+
+	expectedRequests := []string{
+		"GET page ",
+		"GET page page-2",
+		"GET page ",
+		fmt.Sprintf("DELETE %d objects", emptyBucketPageSize),
+		"GET page page-2",
+		"DELETE 1 objects",
+		"DELETE bucket",
+	}
+	if !reflect.DeepEqual(requests, expectedRequests) {
+		t.Errorf("Expected every object to be checked, and then deleted a page at a time, with requests %v, got %v", expectedRequests, requests)
+	}
+}
+
+type IsNotFoundTestCase struct {
+	Err      error
+	Expected bool
+}
+
+var isNotFoundTestCases = []IsNotFoundTestCase{
+	IsNotFoundTestCase{&googleapi.Error{Code: http.StatusNotFound}, true},
+	IsNotFoundTestCase{fmt.Errorf("deleting object failed: %w", &googleapi.Error{Code: http.StatusNotFound}), true},
+	IsNotFoundTestCase{&googleapi.Error{Code: http.StatusForbidden}, false},
+	IsNotFoundTestCase{errors.New("not found"), false},
+	IsNotFoundTestCase{nil, false},
+}
+
+func TestIsNotFound(t *testing.T) {
+	for _, testCase := range isNotFoundTestCases {
+		if result := isNotFound(testCase.Err); result != testCase.Expected {
+			t.Errorf("isNotFound(%v) = %v; want %v", testCase.Err, result, testCase.Expected)
+		}
+	}
+}
+
+func TestGetBucketResourcesListingError(t *testing.T) {
+	server := utils.CreateServer(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("pageToken") == "page-2" {
+			http.Error(w, `{"error": {"code": 403, "message": "forbidden"}}`, http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"items": [{"name": "test-bucket", "location": "US", "timeCreated": "2020-06-17T10:00:00Z"}], "nextPageToken": "page-2"}`))
+	})
+	defer server.Close()
+
+	client := NewGCSBucketClient()
+	client.Auth(context.TODO(), utils.GetTestOptions(server)...)
+	config := &reaperconfig.ResourceConfig{
+		ResourceType: reaperconfig.ResourceType_GCS_BUCKET,
+		NameFilter:   "test",
+		Zones:        []string{"us", "nam4"},
+	}
+	buckets, err := client.GetResources("SampleProject1", config)
+
+	zoneErrors, isZoneErrors := err.(resources.ZoneErrors)
+	if !isZoneErrors || len(zoneErrors) != 2 || !isForbidden(zoneErrors["us"]) || !isForbidden(zoneErrors["nam4"]) {
+		t.Errorf("Expected the listing error for every zone, got %v", err)
+	}
+	if len(buckets) != 0 {
+		t.Errorf("Expected no buckets when listing fails, got %v", buckets)
+	}
+}
+
+// isForbidden returns whether the error is a GCS JSON API error for a forbidden request.
+func isForbidden(err error) bool {
+	var apiError *googleapi.Error
+	return errors.As(err, &apiError) && apiError.Code == http.StatusForbidden
+}
+
+func TestObjectVersions(t *testing.T) {
+	var requests []string
+	server := utils.CreateServer(func(w http.ResponseWriter, req *http.Request) {
+		requests = append(requests, req.Method+" "+req.URL.Path+" "+req.URL.Query().Get("versions")+req.URL.Query().Get("generation"))
+		if req.Method == http.MethodGet {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"items": [
+				{"name": "test-object", "bucket": "test-bucket", "generation": "1", "timeCreated": "2020-06-17T10:00:00Z"},
+				{"name": "test-object", "bucket": "test-bucket", "generation": "2", "timeCreated": "2020-06-18T10:00:00Z"}
+			]}`))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	defer server.Close()
+
+	client := NewGCSObjectClient()
+	client.Auth(context.TODO(), utils.GetTestOptions(server)...)
+
+	config := &reaperconfig.ResourceConfig{
+		ResourceType:              reaperconfig.ResourceType_GCS_OBJECT,
+		NameFilter:                "test",
+		Zones:                     []string{"test-bucket"},
+		IncludeNoncurrentVersions: true,
+	}
+	objects, err := client.GetResources("SampleProject1", config)
+	if err != nil {
+		t.Fatalf("GCS Object GetResources failed with the following error: %s", err.Error())
+	}
+	if len(objects) != 2 || objects[0].Generation != 1 || objects[1].Generation != 2 {
+		t.Fatalf("Expected both generations of the object, got %v", objects)
+	}
+	if !objects[0].TimeCreated.Before(objects[1].TimeCreated) {
+		t.Error("Expected each generation to have its own time created")
+	}
+
+	if err := client.DeleteResource("SampleProject1", objects[0]); err != nil {
+		t.Errorf("GCS Object Delete failed with the following error: %s", err.Error())
+	}
+	expectedRequests := []string{
+		"GET /b/test-bucket/o true",
+		"DELETE /b/test-bucket/o/test-object 1",
+	}
+	if !reflect.DeepEqual(requests, expectedRequests) {
+		t.Errorf("Expected requests %v, got %v", expectedRequests, requests)
+	}
+}
+
+func TestBatchDeleteObjects(t *testing.T) {
+	var deletes []string
+	server := utils.CreateServer(func(w http.ResponseWriter, req *http.Request) {
+		deletes = append(deletes, req.Method+" "+req.URL.Path+" "+req.URL.Query().Get("generation"))
+		if strings.HasSuffix(req.URL.Path, "forbidden") {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	defer server.Close()
+
+	client := NewGCSObjectClient()
+	client.Auth(context.TODO(), utils.GetTestOptions(server)...)
+
+	var objects []*resources.Resource
+	for idx := 0; idx < 150; idx++ {
+		object := resources.NewResource(fmt.Sprintf("object-%d", idx), "test-bucket", time.Now(), reaperconfig.ResourceType_GCS_OBJECT)
+		object.Generation = int64(idx + 1)
+		objects = append(objects, object)
+	}
+	objects[120].Name = "forbidden"
+
+	errs := client.DeleteResources("SampleProject1", objects)
+	if len(errs) != len(objects) || len(deletes) != len(objects) {
+		t.Fatalf("Expected %d deletes, got %d deletes and %d errors", len(objects), len(deletes), len(errs))
+	}
+	if deletes[7] != "DELETE /b/test-bucket/o/object-7 8" {
+		t.Errorf("Expected delete to be pinned to the generation, got %s", deletes[7])
+	}
+	for idx, err := range errs {
+		if (err != nil) != (idx == 120) {
+			t.Errorf("Delete of %s returned error %v", objects[idx].Name, err)
+		}
+	}
+}
+
 func deleteBucketResourceHandler(w http.ResponseWriter, req *http.Request) {
 	bucketName := strings.Split(req.URL.Path, "/")[2]
 	for _, instances := range testInstances {
@@ -0,0 +1,409 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp/syntax"
+	"sort"
+	"strings"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// A LifecycleRule is a GCS bucket lifecycle rule applied by the reaper. It deletes objects
+// that are at least AgeDays old, and whose names start with any of the prefixes and end with
+// any of the suffixes. No prefixes or suffixes means any name matches.
+type LifecycleRule struct {
+	AgeDays  int64
+	Prefixes []string
+	Suffixes []string
+}
+
+// String returns a readable description of the rule.
+func (rule LifecycleRule) String() string {
+	return fmt.Sprintf("delete after %d days (prefixes: %v, suffixes: %v)", rule.AgeDays, rule.Prefixes, rule.Suffixes)
+}
+
+// key returns a string that is equal for rules with the same age, prefixes and suffixes.
+func (rule LifecycleRule) key() string {
+	prefixes := append([]string{}, rule.Prefixes...)
+	suffixes := append([]string{}, rule.Suffixes...)
+	sort.Strings(prefixes)
+	sort.Strings(suffixes)
+	return fmt.Sprintf("%d|%q|%q", rule.AgeDays, prefixes, suffixes)
+}
+
+// LifecycleDrift is the difference between the lifecycle rules a bucket should have and the
+// rules it actually has. Missing rules are desired but not on the bucket, and extra rules were
+// applied by the reaper but are no longer desired.
+type LifecycleDrift struct {
+	Missing []LifecycleRule
+	Extra   []LifecycleRule
+}
+
+// IsEmpty returns whether the bucket's rules match the desired rules.
+func (drift LifecycleDrift) IsEmpty() bool {
+	return len(drift.Missing) == 0 && len(drift.Extra) == 0
+}
+
+// LifecycleRulesFromConfig translates a GCS Object ResourceConfig into the lifecycle rules that
+// delete the same objects. The TTL must be a duration, and is rounded up to whole days. The name
+// filter must be made of alternatives that are each anchored to the start or end of the name,
+// such as "^test-", "\.tmp$" or "^test-.*\.tmp$", since lifecycle rules can only match prefixes
+// and suffixes. A skip filter can not be translated.
+func LifecycleRulesFromConfig(config *reaperconfig.ResourceConfig) ([]LifecycleRule, error) {
+	if config.GetResourceType() != reaperconfig.ResourceType_GCS_OBJECT {
+		return nil, fmt.Errorf("lifecycle rules are only supported for GCS objects")
+	}
+	if len(config.GetSkipFilter()) > 0 {
+		return nil, fmt.Errorf("lifecycle rules do not support skip filters")
+	}
+	ttl, err := resources.ParseTTL(config.GetTtl())
+	if err != nil {
+		return nil, err
+	}
+	ageDays, err := resources.TTLDays(ttl)
+	if err != nil {
+		return nil, fmt.Errorf("lifecycle rules require a duration TTL: %v", err)
+	}
+	if len(config.GetNameFilter()) == 0 {
+		return nil, fmt.Errorf("lifecycle rules require a name filter")
+	}
+
+	var rules []LifecycleRule
+	for _, branch := range splitAlternatives(config.GetNameFilter()) {
+		prefix, suffix, err := translateNameFilter(branch)
+		if err != nil {
+			return nil, fmt.Errorf("name filter %s can not be translated to lifecycle rules: %v", config.GetNameFilter(), err)
+		}
+		rule := LifecycleRule{AgeDays: ageDays}
+		if len(prefix) > 0 {
+			rule.Prefixes = []string{prefix}
+		}
+		if len(suffix) > 0 {
+			rule.Suffixes = []string{suffix}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// splitAlternatives splits a regex on its top level alternations. Each alternative is parsed on
+// its own, since the regex parser factors common prefixes out of alternations.
+func splitAlternatives(filter string) []string {
+	var alternatives []string
+	var depth, start int
+	inClass, escaped := false, false
+	for idx, char := range filter {
+		switch {
+		case escaped:
+			escaped = false
+		case char == '\\':
+			escaped = true
+		case inClass:
+			inClass = char != ']'
+		case char == '[':
+			inClass = true
+		case char == '(':
+			depth++
+		case char == ')':
+			depth--
+		case char == '|' && depth == 0:
+			alternatives = append(alternatives, filter[start:idx])
+			start = idx + 1
+		}
+	}
+	return append(alternatives, filter[start:])
+}
+
+// translateNameFilter translates a single alternative of a name filter into a prefix and
+// suffix. The alternative must be of the form "^prefix", "suffix$", "^prefix.*suffix$", or
+// ".*" to match every name. An empty prefix or suffix matches any name.
+func translateNameFilter(filter string) (string, string, error) {
+	parsed, err := syntax.Parse(filter, syntax.Perl)
+	if err != nil {
+		return "", "", err
+	}
+	parts := []*syntax.Regexp{parsed}
+	if parsed.Op == syntax.OpConcat {
+		parts = parsed.Sub
+	}
+
+	// The filter is reduced to its anchors, and a pattern of literals (L) and wildcards (W).
+	var beginAnchored, endAnchored bool
+	var pattern string
+	var literals []string
+	for idx, part := range parts {
+		switch {
+		case part.Op == syntax.OpBeginText && idx == 0:
+			beginAnchored = true
+		case part.Op == syntax.OpEndText && idx == len(parts)-1:
+			endAnchored = true
+		case part.Op == syntax.OpLiteral && part.Flags&syntax.FoldCase == 0:
+			if strings.HasSuffix(pattern, "L") {
+				literals[len(literals)-1] += string(part.Rune)
+			} else {
+				pattern += "L"
+				literals = append(literals, string(part.Rune))
+			}
+		case part.Op == syntax.OpStar && (part.Sub[0].Op == syntax.OpAnyCharNotNL || part.Sub[0].Op == syntax.OpAnyChar):
+			pattern += "W"
+		case part.Op == syntax.OpEmptyMatch:
+		default:
+			return "", "", fmt.Errorf("%s is not a literal or wildcard", part.String())
+		}
+	}
+
+	switch {
+	case (pattern == "" || pattern == "W") && !(beginAnchored && endAnchored && pattern == ""):
+		return "", "", nil
+	case (pattern == "L" && beginAnchored && !endAnchored) || (pattern == "LW" && beginAnchored):
+		return literals[0], "", nil
+	case (pattern == "L" && endAnchored && !beginAnchored) || (pattern == "WL" && endAnchored):
+		return "", literals[0], nil
+	case pattern == "LWL" && beginAnchored && endAnchored:
+		return literals[0], literals[1], nil
+	default:
+		return "", "", fmt.Errorf("%s must be anchored to the start or end of the name", filter)
+	}
+}
+
+// LifecycleClient reads and updates bucket lifecycle rules. It uses the GCS JSON API directly,
+// since the storage libraries do not support the matchesPrefix and matchesSuffix conditions.
+type LifecycleClient struct {
+	httpClient *http.Client
+	endpoint   string
+	ctx        context.Context
+}
+
+// NewLifecycleClient constructs a LifecycleClient.
+func NewLifecycleClient() *LifecycleClient {
+	return &LifecycleClient{}
+}
+
+// Auth authenticates the LifecycleClient.
+func (client *LifecycleClient) Auth(ctx context.Context, opts ...option.ClientOption) error {
+	httpClient, endpoint, err := newJSONAPIClient(ctx, opts...)
+	if err != nil {
+		return err
+	}
+	client.httpClient = httpClient
+	client.endpoint = endpoint
+	client.ctx = ctx
+	return nil
+}
+
+// bucketLifecycle is the lifecycle configuration of a bucket. Rules are kept as raw JSON so
+// that rules not applied by the reaper are written back unchanged.
+type bucketLifecycle struct {
+	Metageneration int64 `json:"metageneration,string"`
+	Lifecycle      struct {
+		Rule []json.RawMessage `json:"rule"`
+	} `json:"lifecycle"`
+}
+
+// lifecycleRuleJSON is the JSON representation of a lifecycle rule applied by the reaper.
+type lifecycleRuleJSON struct {
+	Action struct {
+		Type string `json:"type"`
+	} `json:"action"`
+	Condition struct {
+		Age           int64    `json:"age"`
+		MatchesPrefix []string `json:"matchesPrefix,omitempty"`
+		MatchesSuffix []string `json:"matchesSuffix,omitempty"`
+	} `json:"condition"`
+}
+
+// ruleConditions are the conditions the reaper uses in its lifecycle rules.
+var ruleConditions = map[string]bool{"age": true, "matchesPrefix": true, "matchesSuffix": true}
+
+// parseRule parses a raw lifecycle rule, and returns whether it has the form of the rules the
+// reaper applies, which delete objects based only on their age, prefix and suffix. Whether the
+// rule was actually applied by the reaper is decided by the caller.
+func parseRule(rawRule json.RawMessage) (LifecycleRule, bool) {
+	var conditions struct {
+		Condition map[string]json.RawMessage `json:"condition"`
+	}
+	if err := json.Unmarshal(rawRule, &conditions); err != nil {
+		return LifecycleRule{}, false
+	}
+	if _, hasAge := conditions.Condition["age"]; !hasAge {
+		return LifecycleRule{}, false
+	}
+	for condition := range conditions.Condition {
+		if !ruleConditions[condition] {
+			return LifecycleRule{}, false
+		}
+	}
+
+	var rule lifecycleRuleJSON
+	if err := json.Unmarshal(rawRule, &rule); err != nil || rule.Action.Type != "Delete" {
+		return LifecycleRule{}, false
+	}
+	return LifecycleRule{
+		AgeDays:  rule.Condition.Age,
+		Prefixes: rule.Condition.MatchesPrefix,
+		Suffixes: rule.Condition.MatchesSuffix,
+	}, true
+}
+
+// ruleJSON returns the raw JSON of a lifecycle rule applied by the reaper.
+func ruleJSON(rule LifecycleRule) (json.RawMessage, error) {
+	var encoded lifecycleRuleJSON
+	encoded.Action.Type = "Delete"
+	encoded.Condition.Age = rule.AgeDays
+	encoded.Condition.MatchesPrefix = rule.Prefixes
+	encoded.Condition.MatchesSuffix = rule.Suffixes
+	return json.Marshal(encoded)
+}
+
+// ReconcileLifecycleRules compares the bucket's lifecycle rules with the desired rules, and
+// returns the drift between them. Applied are the rules the reaper previously applied to the
+// bucket, and only those rules are ever removed; all other rules on the bucket are left
+// untouched. A desired rule that is already on the bucket, whoever added it, is not added
+// again. If apply is set and there is drift, the missing rules are added and the applied rules
+// that are no longer desired are removed. The rules the reaper has applied to the bucket after
+// reconciling are returned along with the drift.
+func (client *LifecycleClient) ReconcileLifecycleRules(bucket string, applied, desired []LifecycleRule, apply bool) (LifecycleDrift, []LifecycleRule, error) {
+	var drift LifecycleDrift
+	current, err := client.getLifecycle(bucket)
+	if err != nil {
+		return drift, applied, err
+	}
+
+	desiredKeys := make(map[string]bool)
+	for _, rule := range desired {
+		desiredKeys[rule.key()] = true
+	}
+	appliedCounts := make(map[string]int)
+	for _, rule := range applied {
+		appliedCounts[rule.key()]++
+	}
+
+	var updatedRules []json.RawMessage
+	var owned, kept []LifecycleRule
+	currentKeys := make(map[string]bool)
+	for _, rawRule := range current.Lifecycle.Rule {
+		rule, isReaperRule := parseRule(rawRule)
+		if !isReaperRule {
+			updatedRules = append(updatedRules, rawRule)
+			continue
+		}
+		key := rule.key()
+		if appliedCounts[key] > 0 {
+			appliedCounts[key]--
+			if !desiredKeys[key] || currentKeys[key] {
+				drift.Extra = append(drift.Extra, rule)
+				owned = append(owned, rule)
+				continue
+			}
+			kept = append(kept, rule)
+		}
+		currentKeys[key] = true
+		updatedRules = append(updatedRules, rawRule)
+	}
+
+	var added []LifecycleRule
+	for _, rule := range desired {
+		key := rule.key()
+		if currentKeys[key] {
+			continue
+		}
+		currentKeys[key] = true
+		drift.Missing = append(drift.Missing, rule)
+		encoded, err := ruleJSON(rule)
+		if err != nil {
+			return drift, applied, err
+		}
+		updatedRules = append(updatedRules, encoded)
+		added = append(added, rule)
+	}
+
+	if drift.IsEmpty() {
+		return drift, kept, nil
+	}
+	if !apply {
+		return drift, append(kept, owned...), nil
+	}
+	if err := client.setLifecycleRules(bucket, current.Metageneration, updatedRules); err != nil {
+		return drift, append(kept, owned...), err
+	}
+	return drift, append(kept, added...), nil
+}
+
+// getLifecycle gets the lifecycle configuration and metageneration of a bucket.
+func (client *LifecycleClient) getLifecycle(bucket string) (*bucketLifecycle, error) {
+	requestURL := fmt.Sprintf("%sb/%s?fields=lifecycle,metageneration", client.endpoint, url.PathEscape(bucket))
+	request, err := http.NewRequestWithContext(client.ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := client.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if err := googleapi.CheckResponse(response); err != nil {
+		return nil, err
+	}
+
+	lifecycle := &bucketLifecycle{}
+	if err := json.NewDecoder(response.Body).Decode(lifecycle); err != nil {
+		return nil, err
+	}
+	return lifecycle, nil
+}
+
+// setLifecycleRules replaces the lifecycle rules of a bucket. The update only succeeds if the
+// bucket's metageneration still matches, so that concurrent changes to the bucket are not lost.
+func (client *LifecycleClient) setLifecycleRules(bucket string, metageneration int64, rules []json.RawMessage) error {
+	var update struct {
+		Lifecycle struct {
+			Rule []json.RawMessage `json:"rule"`
+		} `json:"lifecycle"`
+	}
+	update.Lifecycle.Rule = rules
+	if update.Lifecycle.Rule == nil {
+		update.Lifecycle.Rule = []json.RawMessage{}
+	}
+	body, err := json.Marshal(update)
+	if err != nil {
+		return err
+	}
+
+	requestURL := fmt.Sprintf(
+		"%sb/%s?ifMetagenerationMatch=%d&fields=lifecycle", client.endpoint, url.PathEscape(bucket), metageneration,
+	)
+	request, err := http.NewRequestWithContext(client.ctx, http.MethodPatch, requestURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := client.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	return googleapi.CheckResponse(response)
+}
@@ -0,0 +1,161 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcs
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/utils"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+)
+
+type LifecycleRulesFromConfigTestCase struct {
+	NameFilter  string
+	SkipFilter  string
+	TTL         string
+	Expected    []LifecycleRule
+	ExpectError bool
+}
+
+var lifecycleRulesFromConfigTestCases = []LifecycleRulesFromConfigTestCase{
+	LifecycleRulesFromConfigTestCase{"^tmp-", "", "48h", []LifecycleRule{{AgeDays: 2, Prefixes: []string{"tmp-"}}}, false},
+	LifecycleRulesFromConfigTestCase{"^tmp-.*", "", "P1D", []LifecycleRule{{AgeDays: 1, Prefixes: []string{"tmp-"}}}, false},
+	LifecycleRulesFromConfigTestCase{`\.log$`, "", "6h", []LifecycleRule{{AgeDays: 1, Suffixes: []string{".log"}}}, false},
+	LifecycleRulesFromConfigTestCase{`.*\.log$`, "", "6h", []LifecycleRule{{AgeDays: 1, Suffixes: []string{".log"}}}, false},
+	LifecycleRulesFromConfigTestCase{
+		`^test-.*\.log$`, "", "P7D",
+		[]LifecycleRule{{AgeDays: 7, Prefixes: []string{"test-"}, Suffixes: []string{".log"}}}, false,
+	},
+	LifecycleRulesFromConfigTestCase{
+		"^test-a|^test-b", "", "P1D",
+		[]LifecycleRule{{AgeDays: 1, Prefixes: []string{"test-a"}}, {AgeDays: 1, Prefixes: []string{"test-b"}}}, false,
+	},
+	LifecycleRulesFromConfigTestCase{".*", "", "P1D", []LifecycleRule{{AgeDays: 1}}, false},
+	// Unanchored filters match anywhere in the name, which lifecycle rules can not express.
+	LifecycleRulesFromConfigTestCase{"test", "", "P1D", nil, true},
+	LifecycleRulesFromConfigTestCase{"^test$", "", "P1D", nil, true},
+	LifecycleRulesFromConfigTestCase{"^test[0-9]", "", "P1D", nil, true},
+	LifecycleRulesFromConfigTestCase{"^test", "skip", "P1D", nil, true},
+	LifecycleRulesFromConfigTestCase{"^test", "", "0 5 * * *", nil, true},
+}
+
+func TestLifecycleRulesFromConfig(t *testing.T) {
+	for _, testCase := range lifecycleRulesFromConfigTestCases {
+		config := &reaperconfig.ResourceConfig{
+			ResourceType: reaperconfig.ResourceType_GCS_OBJECT,
+			NameFilter:   testCase.NameFilter,
+			SkipFilter:   testCase.SkipFilter,
+			Ttl:          testCase.TTL,
+		}
+		rules, err := LifecycleRulesFromConfig(config)
+		if (err != nil) != testCase.ExpectError {
+			t.Errorf("Name filter %q: returned error %v; expected error: %v", testCase.NameFilter, err, testCase.ExpectError)
+			continue
+		}
+		if !reflect.DeepEqual(rules, testCase.Expected) {
+			t.Errorf("Name filter %q: expected rules %v, got %v", testCase.NameFilter, testCase.Expected, rules)
+		}
+	}
+}
+
+func TestReconcileLifecycleRules(t *testing.T) {
+	var patchRequest struct {
+		Query string
+		Body  map[string]interface{}
+	}
+	server := utils.CreateServer(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if req.Method == http.MethodPatch {
+			patchRequest.Query = req.URL.Query().Get("ifMetagenerationMatch")
+			body, _ := ioutil.ReadAll(req.Body)
+			json.Unmarshal(body, &patchRequest.Body)
+			w.Write([]byte(`{}`))
+			return
+		}
+		w.Write([]byte(`{"metageneration": "7", "lifecycle": {"rule": [
+			{"action": {"type": "SetStorageClass", "storageClass": "COLDLINE"}, "condition": {"age": 30}},
+			{"action": {"type": "Delete"}, "condition": {"age": 1, "matchesPrefix": ["tmp-"]}},
+			{"action": {"type": "Delete"}, "condition": {"age": 5, "matchesPrefix": ["old-"]}},
+			{"action": {"type": "Delete"}, "condition": {"age": 3, "matchesSuffix": [".bak"]}},
+			{"action": {"type": "Delete"}, "condition": {"numNewerVersions": 3}}
+		]}}`))
+	})
+	defer server.Close()
+
+	client := NewLifecycleClient()
+	if err := client.Auth(context.TODO(), utils.GetTestOptions(server)...); err != nil {
+		t.Fatal(err)
+	}
+	// The rule deleting old- objects was added by the bucket's owner, so it must never be
+	// removed, and since it is already on the bucket it is not added again either.
+	applied := []LifecycleRule{
+		{AgeDays: 1, Prefixes: []string{"tmp-"}},
+		{AgeDays: 3, Suffixes: []string{".bak"}},
+	}
+	desired := []LifecycleRule{
+		{AgeDays: 1, Prefixes: []string{"tmp-"}},
+		{AgeDays: 2, Suffixes: []string{".log"}},
+		{AgeDays: 5, Prefixes: []string{"old-"}},
+	}
+
+	drift, owned, err := client.ReconcileLifecycleRules("test-bucket", applied, desired, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedDrift := LifecycleDrift{
+		Missing: []LifecycleRule{{AgeDays: 2, Suffixes: []string{".log"}}},
+		Extra:   []LifecycleRule{{AgeDays: 3, Suffixes: []string{".bak"}}},
+	}
+	if !reflect.DeepEqual(drift, expectedDrift) {
+		t.Errorf("Expected drift %v, got %v", expectedDrift, drift)
+	}
+	if !reflect.DeepEqual(owned, applied) {
+		t.Errorf("Expected the applied rules %v to be unchanged when only reporting drift, got %v", applied, owned)
+	}
+	if patchRequest.Body != nil {
+		t.Error("Lifecycle rules should not be updated when only reporting drift")
+	}
+
+	_, owned, err = client.ReconcileLifecycleRules("test-bucket", applied, desired, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedOwned := []LifecycleRule{
+		{AgeDays: 1, Prefixes: []string{"tmp-"}},
+		{AgeDays: 2, Suffixes: []string{".log"}},
+	}
+	if !reflect.DeepEqual(owned, expectedOwned) {
+		t.Errorf("Expected the reaper to have applied rules %v, got %v", expectedOwned, owned)
+	}
+	if patchRequest.Query != "7" {
+		t.Errorf("Expected update to be conditional on metageneration 7, got %q", patchRequest.Query)
+	}
+	var expectedBody map[string]interface{}
+	json.Unmarshal([]byte(`{"lifecycle": {"rule": [
+		{"action": {"type": "SetStorageClass", "storageClass": "COLDLINE"}, "condition": {"age": 30}},
+		{"action": {"type": "Delete"}, "condition": {"age": 1, "matchesPrefix": ["tmp-"]}},
+		{"action": {"type": "Delete"}, "condition": {"age": 5, "matchesPrefix": ["old-"]}},
+		{"action": {"type": "Delete"}, "condition": {"numNewerVersions": 3}},
+		{"action": {"type": "Delete"}, "condition": {"age": 2, "matchesSuffix": [".log"]}}
+	]}}`), &expectedBody)
+	if !reflect.DeepEqual(patchRequest.Body, expectedBody) {
+		t.Errorf("Expected lifecycle update %v, got %v", expectedBody, patchRequest.Body)
+	}
+}
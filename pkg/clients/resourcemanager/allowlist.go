@@ -0,0 +1,58 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resourcemanager
+
+import (
+	"fmt"
+	"sync"
+)
+
+var (
+	allowedFoldersMux sync.RWMutex
+	allowedFolders    map[string]bool
+)
+
+// SetAllowedFolders sets the allowlist of folders, such as "folders/123", whose projects
+// may be reaped. Projects are never listed or deleted outside of these folders, so the
+// PROJECT resource type can not be used at all until the allowlist is set. Each folder
+// must be given as folders/{id}.
+func SetAllowedFolders(folders []string) error {
+	folderSet := make(map[string]bool)
+	for _, folder := range folders {
+		if parentType, _, err := ParseParent(folder); err != nil || parentType != "folder" {
+			return fmt.Errorf("invalid allowed folder %s, expected folders/{id}", folder)
+		}
+		folderSet[folder] = true
+	}
+	allowedFoldersMux.Lock()
+	defer allowedFoldersMux.Unlock()
+	allowedFolders = folderSet
+	return nil
+}
+
+// IsFolderAllowed returns whether projects in the given folder may be reaped.
+func IsFolderAllowed(folder string) bool {
+	allowedFoldersMux.RLock()
+	defer allowedFoldersMux.RUnlock()
+	return allowedFolders[folder]
+}
+
+// checkFolderAllowed returns an error if projects in the given folder may not be reaped.
+func checkFolderAllowed(folder string) error {
+	if !IsFolderAllowed(folder) {
+		return fmt.Errorf("folder %s is not on the allowlist of folders whose projects may be reaped", folder)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resourcemanager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	crmv1 "google.golang.org/api/cloudresourcemanager/v1"
+	"google.golang.org/api/option"
+)
+
+// ProjectClient is a client for whole GCP projects. Note that the Zone of a project is
+// the folder it is in, and projects are only listed and deleted in allowed folders.
+type ProjectClient struct {
+	Client *crmv1.Service
+	ctx    context.Context
+}
+
+// NewProjectClient creates a new project client.
+func NewProjectClient() *ProjectClient {
+	return &ProjectClient{}
+}
+
+// Auth authenticates the project client.
+func (client *ProjectClient) Auth(ctx context.Context, opts ...option.ClientOption) error {
+	authedClient, err := crmv1.NewService(ctx, opts...)
+	if err != nil {
+		return err
+	}
+	client.Client = authedClient
+	client.ctx = ctx
+	return nil
+}
+
+// GetResources gets the active projects directly in the folders of the ResourceConfig that
+// match its filters and labels. Projects are listed by folder rather than by project, so
+// the project ID is ignored. Folders that are not on the allowlist are reported as failed
+// in a resources.ZoneErrors, along with any folders that failed to be listed, and folders
+// with projects whose creation time could not be parsed. Those projects are skipped.
+func (client *ProjectClient) GetResources(projectID string, config *reaperconfig.ResourceConfig) ([]*resources.Resource, error) {
+	var instances []*resources.Resource
+	zoneErrors := make(resources.ZoneErrors)
+	for _, folder := range config.GetZones() {
+		if err := checkFolderAllowed(folder); err != nil {
+			zoneErrors[folder] = err
+			continue
+		}
+		projects, err := listProjectsInParent(client.ctx, client.Client, folder)
+		if err != nil {
+			zoneErrors[folder] = err
+			continue
+		}
+		for _, project := range projects {
+			// A project without a valid creation time would look older than any TTL, so
+			// it is skipped rather than risk deleting it.
+			timeCreated, err := time.Parse(time.RFC3339, project.CreateTime)
+			if err != nil {
+				zoneErrors[folder] = fmt.Errorf("project %s has an invalid create time %q with the following error: %s", project.ProjectId, project.CreateTime, err.Error())
+				continue
+			}
+			parsedResource := resources.NewResource(project.ProjectId, folder, timeCreated, reaperconfig.ResourceType_PROJECT)
+			parsedResource.ProjectID = project.ProjectId
+			parsedResource.Labels = project.Labels
+			if !parsedResource.HasLabels(config.GetMatchLabels()) {
+				continue
+			}
+			if resources.ShouldAddResourceToWatchlist(parsedResource, config.GetNameFilter(), config.GetSkipFilter()) {
+				instances = append(instances, parsedResource)
+			}
+		}
+	}
+	if len(zoneErrors) > 0 {
+		return instances, zoneErrors
+	}
+	return instances, nil
+}
+
+// DeleteResource deletes the given project, which schedules it for deletion. The project is
+// looked up again first, and is only deleted if it is still active and in an allowed folder.
+func (client *ProjectClient) DeleteResource(projectID string, resource *resources.Resource) error {
+	if _, err := client.getDeletableProject(resource); err != nil {
+		return err
+	}
+	_, err := client.Client.Projects.Delete(resource.Name).Context(client.ctx).Do()
+	return err
+}
+
+// MarkResource marks the given project for deletion by adding the mark label to the
+// project's labels.
+func (client *ProjectClient) MarkResource(projectID string, resource *resources.Resource, markedAt time.Time) error {
+	project, err := client.getDeletableProject(resource)
+	if err != nil {
+		return err
+	}
+	labels := make(map[string]string)
+	for key, value := range project.Labels {
+		labels[key] = value
+	}
+	labels[resources.MarkLabel] = resources.MarkValue(markedAt)
+	project.Labels = labels
+	_, err = client.Client.Projects.Update(resource.Name, project).Context(client.ctx).Do()
+	return err
+}
+
+// getDeletableProject gets the given project, and returns an error if it is no longer
+// active, or is not directly in an allowed folder.
+func (client *ProjectClient) getDeletableProject(resource *resources.Resource) (*crmv1.Project, error) {
+	project, err := client.Client.Projects.Get(resource.Name).Context(client.ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	if project.LifecycleState != "ACTIVE" {
+		return nil, fmt.Errorf("project %s is %s", project.ProjectId, project.LifecycleState)
+	}
+	if project.Parent == nil || project.Parent.Type != "folder" {
+		return nil, fmt.Errorf("project %s is not in a folder", project.ProjectId)
+	}
+	if err := checkFolderAllowed("folders/" + project.Parent.Id); err != nil {
+		return nil, err
+	}
+	return project, nil
+}
@@ -0,0 +1,152 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resourcemanager
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/utils"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+)
+
+// testProjects maps each project ID to its JSON representation.
+var testProjects = map[string]string{
+	"test-run-1":  `{"projectId": "test-run-1", "createTime": "2020-06-17T10:00:00Z", "labels": {"suite": "e2e"}, "lifecycleState": "ACTIVE", "parent": {"type": "folder", "id": "10"}}`,
+	"test-run-2":  `{"projectId": "test-run-2", "createTime": "2020-06-17T10:00:00Z", "labels": {"suite": "unit"}, "lifecycleState": "ACTIVE", "parent": {"type": "folder", "id": "10"}}`,
+	"test-moved":  `{"projectId": "test-moved", "createTime": "2020-06-17T10:00:00Z", "labels": {"suite": "e2e"}, "lifecycleState": "ACTIVE", "parent": {"type": "folder", "id": "99"}}`,
+	"test-remove": `{"projectId": "test-remove", "createTime": "2020-06-17T10:00:00Z", "labels": {"suite": "e2e"}, "lifecycleState": "DELETE_REQUESTED", "parent": {"type": "folder", "id": "10"}}`,
+	"test-run-3":  `{"projectId": "test-run-3", "labels": {"suite": "e2e"}, "lifecycleState": "ACTIVE", "parent": {"type": "folder", "id": "10"}}`,
+	"test-run-4":  `{"projectId": "test-run-4", "createTime": "yesterday", "labels": {"suite": "e2e"}, "lifecycleState": "ACTIVE", "parent": {"type": "folder", "id": "10"}}`,
+}
+
+func TestSetAllowedFolders(t *testing.T) {
+	defer SetAllowedFolders(nil)
+	if err := SetAllowedFolders([]string{"organizations/1"}); err == nil {
+		t.Error("Expected organizations to be rejected from the allowlist")
+	}
+	if err := SetAllowedFolders([]string{"folders/10"}); err != nil {
+		t.Fatalf("SetAllowedFolders failed: %v", err)
+	}
+	if !IsFolderAllowed("folders/10") || IsFolderAllowed("folders/11") {
+		t.Error("Only folders/10 should be allowed")
+	}
+}
+
+func TestProjectClientGetResources(t *testing.T) {
+	SetAllowedFolders([]string{"folders/10"})
+	defer SetAllowedFolders(nil)
+
+	var filters []string
+	server := utils.CreateServer(func(w http.ResponseWriter, req *http.Request) {
+		filters = append(filters, req.URL.Query().Get("filter"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"projects": [` + testProjects["test-run-1"] + `, ` + testProjects["test-run-2"] + `]}`))
+	})
+	defer server.Close()
+
+	client := NewProjectClient()
+	client.Auth(context.Background(), utils.GetTestOptions(server)...)
+	config := &reaperconfig.ResourceConfig{
+		ResourceType: reaperconfig.ResourceType_PROJECT,
+		NameFilter:   "^test-run-",
+		Zones:        []string{"folders/10", "folders/99"},
+		MatchLabels:  map[string]string{"suite": "e2e"},
+	}
+	projects, err := client.GetResources("", config)
+
+	zoneErrors, isZoneErrors := err.(resources.ZoneErrors)
+	if _, failed := zoneErrors["folders/99"]; !isZoneErrors || !failed || len(zoneErrors) != 1 {
+		t.Errorf("Expected only the folder that is not allowed to fail, got %v", err)
+	}
+	if expectedFilters := []string{"parent.type:folder parent.id:10 lifecycleState:ACTIVE"}; !reflect.DeepEqual(filters, expectedFilters) {
+		t.Errorf("Expected project list filters %v, got %v", expectedFilters, filters)
+	}
+	if len(projects) != 1 || projects[0].Name != "test-run-1" || projects[0].Zone != "folders/10" || projects[0].ProjectID != "test-run-1" {
+		t.Errorf("Expected only project test-run-1, got %v", projects)
+	}
+}
+
+func TestProjectClientGetResourcesInvalidCreateTime(t *testing.T) {
+	SetAllowedFolders([]string{"folders/10"})
+	defer SetAllowedFolders(nil)
+
+	server := utils.CreateServer(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"projects": [` + testProjects["test-run-1"] + `, ` + testProjects["test-run-3"] + `, ` + testProjects["test-run-4"] + `]}`))
+	})
+	defer server.Close()
+
+	client := NewProjectClient()
+	client.Auth(context.Background(), utils.GetTestOptions(server)...)
+	config := &reaperconfig.ResourceConfig{
+		ResourceType: reaperconfig.ResourceType_PROJECT,
+		NameFilter:   "^test-run-",
+		Zones:        []string{"folders/10"},
+	}
+	projects, err := client.GetResources("", config)
+
+	zoneErrors, isZoneErrors := err.(resources.ZoneErrors)
+	if _, failed := zoneErrors["folders/10"]; !isZoneErrors || !failed {
+		t.Errorf("Expected the folder with invalid create times to be reported, got %v", err)
+	}
+	if len(projects) != 1 || projects[0].Name != "test-run-1" {
+		t.Errorf("Expected only project test-run-1, got %v", projects)
+	}
+}
+
+type DeleteProjectTestCase struct {
+	ProjectID      string
+	ExpectedDelete bool
+}
+
+var deleteProjectTestCases = []DeleteProjectTestCase{
+	DeleteProjectTestCase{"test-run-1", true},
+	DeleteProjectTestCase{"test-moved", false},
+	DeleteProjectTestCase{"test-remove", false},
+}
+
+func TestProjectClientDeleteResource(t *testing.T) {
+	SetAllowedFolders([]string{"folders/10"})
+	defer SetAllowedFolders(nil)
+
+	for _, testCase := range deleteProjectTestCases {
+		var deletes []string
+		server := utils.CreateServer(func(w http.ResponseWriter, req *http.Request) {
+			projectID := strings.TrimPrefix(req.URL.Path, "/v1/projects/")
+			if req.Method == http.MethodDelete {
+				deletes = append(deletes, projectID)
+				w.Write([]byte(`{}`))
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(testProjects[projectID]))
+		})
+
+		client := NewProjectClient()
+		client.Auth(context.Background(), utils.GetTestOptions(server)...)
+		project := resources.NewResource(testCase.ProjectID, "folders/10", time.Now(), reaperconfig.ResourceType_PROJECT)
+		err := client.DeleteResource("", project)
+		if deleted := len(deletes) == 1; deleted != testCase.ExpectedDelete || (err == nil) != testCase.ExpectedDelete {
+			t.Errorf("Project %s deleted: %v, error: %v; expected delete: %v", testCase.ProjectID, deleted, err, testCase.ExpectedDelete)
+		}
+		server.Close()
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resourcemanager
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	crmv1 "google.golang.org/api/cloudresourcemanager/v1"
+	crmv2 "google.golang.org/api/cloudresourcemanager/v2"
+	"google.golang.org/api/option"
+)
+
+// ResourceManagerClient resolves the projects under a folder or organization through the
+// Resource Manager API.
+type ResourceManagerClient struct {
+	projects *crmv1.Service
+	folders  *crmv2.Service
+	ctx      context.Context
+}
+
+// NewResourceManagerClient creates a new Resource Manager client.
+func NewResourceManagerClient() *ResourceManagerClient {
+	return &ResourceManagerClient{}
+}
+
+// Auth authenticates the Resource Manager client.
+func (client *ResourceManagerClient) Auth(ctx context.Context, opts ...option.ClientOption) error {
+	projects, err := crmv1.NewService(ctx, opts...)
+	if err != nil {
+		return err
+	}
+	folders, err := crmv2.NewService(ctx, opts...)
+	if err != nil {
+		return err
+	}
+	client.projects = projects
+	client.folders = folders
+	client.ctx = ctx
+	return nil
+}
+
+// ParseParent splits a Resource Manager parent, such as "folders/123" or "organizations/456",
+// into the parent type used in project filters and the parent's ID.
+func ParseParent(parent string) (string, string, error) {
+	splitParent := strings.Split(parent, "/")
+	if len(splitParent) != 2 || len(splitParent[1]) == 0 {
+		return "", "", fmt.Errorf("invalid parent %s, expected folders/{id} or organizations/{id}", parent)
+	}
+	switch splitParent[0] {
+	case "folders":
+		return "folder", splitParent[1], nil
+	case "organizations":
+		return "organization", splitParent[1], nil
+	default:
+		return "", "", fmt.Errorf("invalid parent %s, expected folders/{id} or organizations/{id}", parent)
+	}
+}
+
+// ListProjects returns the active projects under the given folder or organization,
+// including the projects in all of its subfolders.
+func (client *ResourceManagerClient) ListProjects(parent string) ([]*crmv1.Project, error) {
+	projects, err := listProjectsInParent(client.ctx, client.projects, parent)
+	if err != nil {
+		return nil, err
+	}
+
+	var subfolders []string
+	err = client.folders.Folders.List().Parent(parent).Pages(client.ctx, func(page *crmv2.ListFoldersResponse) error {
+		for _, folder := range page.Folders {
+			subfolders = append(subfolders, folder.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing folders under %s failed with the following error: %s", parent, err.Error())
+	}
+	for _, subfolder := range subfolders {
+		subfolderProjects, err := client.ListProjects(subfolder)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, subfolderProjects...)
+	}
+	return projects, nil
+}
+
+// listProjectsInParent returns the active projects directly under the given folder or
+// organization, not including the projects in its subfolders.
+func listProjectsInParent(ctx context.Context, service *crmv1.Service, parent string) ([]*crmv1.Project, error) {
+	parentType, parentID, err := ParseParent(parent)
+	if err != nil {
+		return nil, err
+	}
+
+	var projects []*crmv1.Project
+	filter := fmt.Sprintf("parent.type:%s parent.id:%s lifecycleState:ACTIVE", parentType, parentID)
+	err = service.Projects.List().Filter(filter).Pages(ctx, func(page *crmv1.ListProjectsResponse) error {
+		projects = append(projects, page.Projects...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing projects under %s failed with the following error: %s", parent, err.Error())
+	}
+	return projects, nil
+}
+
+// ListProjectIDs returns the sorted IDs of the active projects under the given folder or
+// organization, including the projects in all of its subfolders.
+func (client *ResourceManagerClient) ListProjectIDs(parent string) ([]string, error) {
+	projects, err := client.ListProjects(parent)
+	if err != nil {
+		return nil, err
+	}
+	projectIDs := make([]string, len(projects))
+	for idx, project := range projects {
+		projectIDs[idx] = project.ProjectId
+	}
+	sort.Strings(projectIDs)
+	return projectIDs, nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resourcemanager
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/utils"
+)
+
+// testFolders maps each parent to its subfolders and the IDs of the projects in it.
+var testFolders = map[string]struct {
+	subfolders string
+	projects   string
+}{
+	"organizations/1": {`[{"name": "folders/10"}]`, `[{"projectId": "org-project"}]`},
+	"folders/10":      {`[{"name": "folders/11"}, {"name": "folders/12"}]`, `[{"projectId": "test-b"}, {"projectId": "test-a"}]`},
+	"folders/11":      {`[]`, `[{"projectId": "nested"}]`},
+	"folders/12":      {`[]`, `[]`},
+}
+
+// testParents maps the filter of each project list call to its parent.
+var testParents = map[string]string{
+	"parent.type:organization parent.id:1 lifecycleState:ACTIVE": "organizations/1",
+	"parent.type:folder parent.id:10 lifecycleState:ACTIVE":      "folders/10",
+	"parent.type:folder parent.id:11 lifecycleState:ACTIVE":      "folders/11",
+	"parent.type:folder parent.id:12 lifecycleState:ACTIVE":      "folders/12",
+}
+
+func resourceManagerHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch req.URL.Path {
+	case "/v1/projects":
+		w.Write([]byte(`{"projects": ` + testFolders[testParents[req.URL.Query().Get("filter")]].projects + `}`))
+	case "/v2/folders":
+		w.Write([]byte(`{"folders": ` + testFolders[req.URL.Query().Get("parent")].subfolders + `}`))
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+type ListProjectIDsTestCase struct {
+	Parent      string
+	Expected    []string
+	ExpectError bool
+}
+
+var listProjectIDsTestCases = []ListProjectIDsTestCase{
+	ListProjectIDsTestCase{"folders/10", []string{"nested", "test-a", "test-b"}, false},
+	ListProjectIDsTestCase{"organizations/1", []string{"nested", "org-project", "test-a", "test-b"}, false},
+	ListProjectIDsTestCase{"folders/12", []string{}, false},
+	ListProjectIDsTestCase{"projects/test-a", nil, true},
+}
+
+func TestListProjectIDs(t *testing.T) {
+	server := utils.CreateServer(resourceManagerHandler)
+	defer server.Close()
+
+	client := NewResourceManagerClient()
+	if err := client.Auth(context.Background(), utils.GetTestOptions(server)...); err != nil {
+		t.Fatalf("Resource Manager client failed to authenticate: %v", err)
+	}
+	for _, testCase := range listProjectIDsTestCases {
+		projectIDs, err := client.ListProjectIDs(testCase.Parent)
+		if (err != nil) != testCase.ExpectError {
+			t.Errorf("ListProjectIDs(%s) returned error %v; expected error: %v", testCase.Parent, err, testCase.ExpectError)
+			continue
+		}
+		if !testCase.ExpectError && !reflect.DeepEqual(projectIDs, testCase.Expected) {
+			t.Errorf("ListProjectIDs(%s) = %v; want %v", testCase.Parent, projectIDs, testCase.Expected)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// An ErrorClass describes how the reaper should react to an error from GCP.
+type ErrorClass int
+
+const (
+	// Retryable errors are transient, such as rate limits and server errors,
+	// and the call should be retried.
+	Retryable ErrorClass = iota
+	// Permanent errors will fail again if retried, such as permission denied.
+	Permanent
+	// NotFound errors mean the resource is already gone. Deleting or marking a
+	// resource that is not found counts as a success.
+	NotFound
+)
+
+// ClassifyError returns the ErrorClass of an error returned by a Client. Rate limit
+// (429) and server (5xx) errors and network timeouts are retryable, not found (404)
+// errors are not found, and all other errors are permanent. A resources.ZoneErrors is
+// retryable if any of the zones failed with a retryable error.
+func ClassifyError(err error) ErrorClass {
+	if errors.Is(err, storage.ErrBucketNotExist) || errors.Is(err, storage.ErrObjectNotExist) {
+		return NotFound
+	}
+
+	var zoneErrors resources.ZoneErrors
+	if errors.As(err, &zoneErrors) {
+		for _, zoneError := range zoneErrors {
+			if ClassifyError(zoneError) == Retryable {
+				return Retryable
+			}
+		}
+		return Permanent
+	}
+
+	var apiError *googleapi.Error
+	if errors.As(err, &apiError) {
+		switch {
+		case apiError.Code == http.StatusNotFound:
+			return NotFound
+		case apiError.Code == http.StatusTooManyRequests || apiError.Code >= http.StatusInternalServerError:
+			return Retryable
+		default:
+			return Permanent
+		}
+	}
+
+	var netError net.Error
+	if errors.As(err, &netError) && netError.Timeout() {
+		return Retryable
+	}
+	return Permanent
+}
+
+// A RetryPolicy determines how many times, and how often, a failed call is retried.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+}
+
+// DefaultRetryPolicy is used for any field of a reaperconfig.RetryPolicy that is not set.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+	Multiplier:     2,
+}
+
+// NewRetryPolicy creates a RetryPolicy from its proto config, using the defaults from
+// DefaultRetryPolicy for any unset fields.
+func NewRetryPolicy(config *reaperconfig.RetryPolicy) (*RetryPolicy, error) {
+	policy := DefaultRetryPolicy
+	if config.GetMaxAttempts() > 0 {
+		policy.MaxAttempts = int(config.GetMaxAttempts())
+	}
+	if len(config.GetInitialBackoff()) > 0 {
+		initialBackoff, err := time.ParseDuration(config.GetInitialBackoff())
+		if err != nil || initialBackoff < 0 {
+			return nil, fmt.Errorf("invalid initial backoff %s", config.GetInitialBackoff())
+		}
+		policy.InitialBackoff = initialBackoff
+	}
+	if len(config.GetMaxBackoff()) > 0 {
+		maxBackoff, err := time.ParseDuration(config.GetMaxBackoff())
+		if err != nil || maxBackoff < 0 {
+			return nil, fmt.Errorf("invalid max backoff %s", config.GetMaxBackoff())
+		}
+		policy.MaxBackoff = maxBackoff
+	}
+	if multiplier := config.GetMultiplier(); multiplier != 0 {
+		if multiplier < 1 {
+			return nil, fmt.Errorf("backoff multiplier %v must be at least 1", multiplier)
+		}
+		policy.Multiplier = multiplier
+	}
+	return &policy, nil
+}
+
+// backoff returns how long to wait before the given retry, where the first retry is 1.
+func (policy *RetryPolicy) backoff(retry int) time.Duration {
+	backoff := float64(policy.InitialBackoff)
+	for i := 1; i < retry; i++ {
+		backoff *= policy.Multiplier
+		if backoff >= float64(policy.MaxBackoff) {
+			return policy.MaxBackoff
+		}
+	}
+	if backoff > float64(policy.MaxBackoff) {
+		return policy.MaxBackoff
+	}
+	return time.Duration(backoff)
+}
+
+// retryingClient is a Client that retries the calls of another Client according to
+// a RetryPolicy.
+type retryingClient struct {
+	ctx    context.Context
+	client Client
+	policy *RetryPolicy
+	sleep  func(context.Context, time.Duration) error
+}
+
+// WithRetries wraps a Client so that its calls are retried on retryable errors according
+// to the given policy, and deleting or marking a resource that is not found counts as a
+// success. If the policy is nil, the DefaultRetryPolicy is used. Waiting between retries
+// stops once the context is cancelled.
+func WithRetries(ctx context.Context, client Client, policy *RetryPolicy) Client {
+	return withRetries(ctx, client, policy, sleepContext)
+}
+
+// withRetries is WithRetries with the function used to wait between retries.
+func withRetries(ctx context.Context, client Client, policy *RetryPolicy, sleep func(context.Context, time.Duration) error) Client {
+	if policy == nil {
+		policy = &DefaultRetryPolicy
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return &retryingClient{ctx, client, policy, sleep}
+}
+
+// sleepContext waits for the given duration, or until the context is cancelled, in which
+// case the context's error is returned.
+func sleepContext(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// retry calls the given function until it succeeds, fails with an error that is not
+// retryable, or the policy runs out of attempts. The last error is returned, or the
+// context's error if the context is cancelled while waiting to retry.
+func (client *retryingClient) retry(call func() error) error {
+	err := call()
+	for attempt := 1; err != nil && attempt < client.policy.MaxAttempts; attempt++ {
+		if ClassifyError(err) != Retryable {
+			return err
+		}
+		if sleepErr := client.sleep(client.ctx, client.policy.backoff(attempt)); sleepErr != nil {
+			return sleepErr
+		}
+		err = call()
+	}
+	return err
+}
+
+// Auth authenticates the wrapped client. Authentication is not retried.
+func (client *retryingClient) Auth(ctx context.Context, opts ...option.ClientOption) error {
+	return client.client.Auth(ctx, opts...)
+}
+
+// GetResources gets the resources from the wrapped client, retrying on retryable errors.
+// If the last attempt only failed in some zones, its resources are returned along with
+// the error.
+func (client *retryingClient) GetResources(projectID string, config *reaperconfig.ResourceConfig) ([]*resources.Resource, error) {
+	var filteredResources []*resources.Resource
+	err := client.retry(func() error {
+		var err error
+		filteredResources, err = client.client.GetResources(projectID, config)
+		return err
+	})
+	return filteredResources, err
+}
+
+// DeleteResource deletes the resource with the wrapped client, retrying on retryable errors.
+// A resource that is not found is already deleted, so it counts as a success.
+func (client *retryingClient) DeleteResource(projectID string, resource *resources.Resource) error {
+	err := client.retry(func() error {
+		return client.client.DeleteResource(projectID, resource)
+	})
+	if err != nil && ClassifyError(err) == NotFound {
+		return nil
+	}
+	return err
+}
+
+// MarkResource marks the resource with the wrapped client, retrying on retryable errors.
+// A resource that is not found is already deleted, so it counts as a success.
+func (client *retryingClient) MarkResource(projectID string, resource *resources.Resource, markedAt time.Time) error {
+	err := client.retry(func() error {
+		return client.client.MarkResource(projectID, resource, markedAt)
+	})
+	if err != nil && ClassifyError(err) == NotFound {
+		return nil
+	}
+	return err
+}
+
+// DeleteResources deletes the resources with the wrapped client, retrying only the deletes
+// that failed with a retryable error. If the wrapped client is not a BatchDeleter, each
+// resource is deleted on its own. A resource that is not found counts as deleted. If the
+// context is cancelled while waiting to retry, the deletes still pending fail with the
+// context's error.
+func (client *retryingClient) DeleteResources(projectID string, resourcesToDelete []*resources.Resource) []error {
+	errs := make([]error, len(resourcesToDelete))
+	batchDeleter, isBatchDeleter := client.client.(BatchDeleter)
+	if !isBatchDeleter {
+		for idx, resource := range resourcesToDelete {
+			errs[idx] = client.DeleteResource(projectID, resource)
+		}
+		return errs
+	}
+
+	pending := make([]int, len(resourcesToDelete))
+	for idx := range pending {
+		pending[idx] = idx
+	}
+	for attempt := 1; len(pending) > 0; attempt++ {
+		if attempt > 1 {
+			if sleepErr := client.sleep(client.ctx, client.policy.backoff(attempt-1)); sleepErr != nil {
+				for _, idx := range pending {
+					errs[idx] = sleepErr
+				}
+				break
+			}
+		}
+		batch := make([]*resources.Resource, len(pending))
+		for batchIdx, idx := range pending {
+			batch[batchIdx] = resourcesToDelete[idx]
+		}
+		batchErrs := batchDeleter.DeleteResources(projectID, batch)
+
+		var toRetry []int
+		for batchIdx, idx := range pending {
+			errs[idx] = batchErrs[batchIdx]
+			if errs[idx] != nil && ClassifyError(errs[idx]) == Retryable && attempt < client.policy.MaxAttempts {
+				toRetry = append(toRetry, idx)
+			}
+		}
+		pending = toRetry
+	}
+
+	for idx, err := range errs {
+		if err != nil && ClassifyError(err) == NotFound {
+			errs[idx] = nil
+		}
+	}
+	return errs
+}
@@ -0,0 +1,303 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/clients/gcs"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/utils"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// fakeClient is a Client that fails each call with the next of its errors, and succeeds
+// once it runs out of errors.
+type fakeClient struct {
+	errors []error
+	calls  int
+}
+
+func (client *fakeClient) nextError() error {
+	client.calls++
+	if client.calls > len(client.errors) {
+		return nil
+	}
+	return client.errors[client.calls-1]
+}
+
+func (client *fakeClient) Auth(ctx context.Context, opts ...option.ClientOption) error {
+	return nil
+}
+
+func (client *fakeClient) GetResources(projectID string, config *reaperconfig.ResourceConfig) ([]*resources.Resource, error) {
+	return nil, client.nextError()
+}
+
+func (client *fakeClient) DeleteResource(projectID string, resource *resources.Resource) error {
+	return client.nextError()
+}
+
+func (client *fakeClient) MarkResource(projectID string, resource *resources.Resource, markedAt time.Time) error {
+	return client.nextError()
+}
+
+func apiError(code int) error {
+	return &googleapi.Error{Code: code}
+}
+
+type ClassifyErrorTestCase struct {
+	Err      error
+	Expected ErrorClass
+}
+
+var classifyErrorTestCases = []ClassifyErrorTestCase{
+	ClassifyErrorTestCase{apiError(http.StatusTooManyRequests), Retryable},
+	ClassifyErrorTestCase{apiError(http.StatusInternalServerError), Retryable},
+	ClassifyErrorTestCase{apiError(http.StatusServiceUnavailable), Retryable},
+	ClassifyErrorTestCase{apiError(http.StatusForbidden), Permanent},
+	ClassifyErrorTestCase{apiError(http.StatusBadRequest), Permanent},
+	ClassifyErrorTestCase{apiError(http.StatusNotFound), NotFound},
+	ClassifyErrorTestCase{fmt.Errorf("wrapped: %w", apiError(http.StatusNotFound)), NotFound},
+	ClassifyErrorTestCase{storage.ErrObjectNotExist, NotFound},
+	ClassifyErrorTestCase{storage.ErrBucketNotExist, NotFound},
+	ClassifyErrorTestCase{errors.New("unknown"), Permanent},
+	ClassifyErrorTestCase{resources.ZoneErrors{"zone1": apiError(http.StatusForbidden), "zone2": apiError(http.StatusBadGateway)}, Retryable},
+	ClassifyErrorTestCase{resources.ZoneErrors{"zone1": apiError(http.StatusForbidden)}, Permanent},
+}
+
+func TestClassifyError(t *testing.T) {
+	for _, testCase := range classifyErrorTestCases {
+		if result := ClassifyError(testCase.Err); result != testCase.Expected {
+			t.Errorf("ClassifyError(%v) = %v; want %v", testCase.Err, result, testCase.Expected)
+		}
+	}
+}
+
+type RetryTestCase struct {
+	Errors         []error
+	ExpectedCalls  int
+	ExpectedSleeps []time.Duration
+	ExpectError    bool
+}
+
+var testRetryPolicy = &RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: time.Second,
+	MaxBackoff:     3 * time.Second,
+	Multiplier:     2,
+}
+
+var retryTestCases = []RetryTestCase{
+	// Succeeds on the first attempt.
+	RetryTestCase{nil, 1, nil, false},
+	// Succeeds after transient errors.
+	RetryTestCase{
+		[]error{apiError(http.StatusServiceUnavailable), apiError(http.StatusTooManyRequests)},
+		3, []time.Duration{time.Second, 2 * time.Second}, false,
+	},
+	// Runs out of attempts, and the backoff is capped by the max backoff.
+	RetryTestCase{
+		[]error{apiError(500), apiError(500), apiError(500), apiError(500)},
+		4, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}, true,
+	},
+	// Permanent errors are not retried.
+	RetryTestCase{[]error{apiError(http.StatusForbidden)}, 1, nil, true},
+	// Resources that are not found are already deleted.
+	RetryTestCase{[]error{apiError(http.StatusServiceUnavailable), apiError(http.StatusNotFound)}, 2, []time.Duration{time.Second}, false},
+}
+
+func TestRetryDeleteResource(t *testing.T) {
+	for _, testCase := range retryTestCases {
+		fake := &fakeClient{errors: testCase.Errors}
+		var sleeps []time.Duration
+		client := withRetries(context.Background(), fake, testRetryPolicy, func(ctx context.Context, backoff time.Duration) error {
+			sleeps = append(sleeps, backoff)
+			return nil
+		})
+
+		err := client.DeleteResource("project", resources.NewResource("test", "zone", time.Time{}, reaperconfig.ResourceType_GCE_VM))
+		if (err != nil) != testCase.ExpectError {
+			t.Errorf("DeleteResource returned error %v; expected error: %v", err, testCase.ExpectError)
+		}
+		if fake.calls != testCase.ExpectedCalls {
+			t.Errorf("DeleteResource made %d calls; want %d", fake.calls, testCase.ExpectedCalls)
+		}
+		if !reflect.DeepEqual(sleeps, testCase.ExpectedSleeps) {
+			t.Errorf("DeleteResource waited %v; want %v", sleeps, testCase.ExpectedSleeps)
+		}
+	}
+}
+
+func TestRetryStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fake := &fakeClient{errors: []error{apiError(http.StatusServiceUnavailable), apiError(http.StatusServiceUnavailable)}}
+	client := WithRetries(ctx, fake, &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour, MaxBackoff: time.Hour, Multiplier: 1})
+
+	err := client.DeleteResource("project", resources.NewResource("test", "zone", time.Time{}, reaperconfig.ResourceType_GCE_VM))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the context's error once cancelled, got %v", err)
+	}
+	if fake.calls != 1 {
+		t.Errorf("DeleteResource made %d calls; want 1", fake.calls)
+	}
+}
+
+func TestRetryGetResourcesNotFound(t *testing.T) {
+	fake := &fakeClient{errors: []error{apiError(http.StatusNotFound)}}
+	client := withRetries(context.Background(), fake, testRetryPolicy, func(context.Context, time.Duration) error { return nil })
+	if _, err := client.GetResources("project", &reaperconfig.ResourceConfig{}); err == nil {
+		t.Errorf("Expected listing a zone that is not found to fail")
+	}
+	if fake.calls != 1 {
+		t.Errorf("GetResources made %d calls; want 1", fake.calls)
+	}
+}
+
+func TestRetryGCSBucketListing(t *testing.T) {
+	var listRequests int
+	server := utils.CreateServer(func(w http.ResponseWriter, req *http.Request) {
+		listRequests++
+		if listRequests == 1 {
+			http.Error(w, `{"error": {"code": 503, "message": "backend error"}}`, http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"items": [{"name": "test-bucket", "location": "US", "timeCreated": "2020-06-17T10:00:00Z"}]}`))
+	})
+	defer server.Close()
+
+	bucketClient := gcs.NewGCSBucketClient()
+	if err := bucketClient.Auth(context.Background(), utils.GetTestOptions(server)...); err != nil {
+		t.Fatalf("GCS Bucket Auth failed with the following error: %s", err.Error())
+	}
+	client := withRetries(context.Background(), bucketClient, testRetryPolicy, func(context.Context, time.Duration) error { return nil })
+	config := &reaperconfig.ResourceConfig{ResourceType: reaperconfig.ResourceType_GCS_BUCKET, NameFilter: "test", Zones: []string{"us"}}
+	buckets, err := client.GetResources("project", config)
+	if err != nil {
+		t.Fatalf("Expected the failed bucket page to be retried, got %v", err)
+	}
+	if len(buckets) != 1 || buckets[0].Name != "test-bucket" {
+		t.Errorf("Expected bucket test-bucket, got %v", buckets)
+	}
+	if listRequests != 2 {
+		t.Errorf("Expected the bucket listing to be requested twice, got %d", listRequests)
+	}
+}
+
+// fakeBatchDeleter is a fakeClient that deletes resources in batches, failing each resource
+// with the next of its errors for that resource.
+type fakeBatchDeleter struct {
+	fakeClient
+	errors  map[string][]error
+	batches [][]string
+}
+
+func (client *fakeBatchDeleter) DeleteResources(projectID string, resourcesToDelete []*resources.Resource) []error {
+	var batch []string
+	errs := make([]error, len(resourcesToDelete))
+	for idx, resource := range resourcesToDelete {
+		batch = append(batch, resource.Name)
+		if resourceErrors := client.errors[resource.Name]; len(resourceErrors) > 0 {
+			errs[idx] = resourceErrors[0]
+			client.errors[resource.Name] = resourceErrors[1:]
+		}
+	}
+	client.batches = append(client.batches, batch)
+	return errs
+}
+
+func TestRetryDeleteResources(t *testing.T) {
+	fake := &fakeBatchDeleter{errors: map[string][]error{
+		"retried":   []error{apiError(http.StatusServiceUnavailable)},
+		"forbidden": []error{apiError(http.StatusForbidden)},
+		"gone":      []error{apiError(http.StatusNotFound)},
+		"flaky": []error{
+			apiError(http.StatusTooManyRequests), apiError(http.StatusTooManyRequests),
+			apiError(http.StatusTooManyRequests), apiError(http.StatusTooManyRequests),
+		},
+	}}
+	var sleeps []time.Duration
+	client := withRetries(context.Background(), fake, testRetryPolicy, func(ctx context.Context, backoff time.Duration) error {
+		sleeps = append(sleeps, backoff)
+		return nil
+	})
+
+	var toDelete []*resources.Resource
+	for _, name := range []string{"ok", "retried", "forbidden", "gone", "flaky"} {
+		toDelete = append(toDelete, resources.NewResource(name, "zone", time.Time{}, reaperconfig.ResourceType_GCS_OBJECT))
+	}
+	errs := client.(BatchDeleter).DeleteResources("project", toDelete)
+
+	expectedBatches := [][]string{
+		[]string{"ok", "retried", "forbidden", "gone", "flaky"},
+		[]string{"retried", "flaky"},
+		[]string{"flaky"},
+		[]string{"flaky"},
+	}
+	if !reflect.DeepEqual(fake.batches, expectedBatches) {
+		t.Errorf("DeleteResources sent batches %v; want %v", fake.batches, expectedBatches)
+	}
+	expectedSleeps := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}
+	if !reflect.DeepEqual(sleeps, expectedSleeps) {
+		t.Errorf("DeleteResources waited %v; want %v", sleeps, expectedSleeps)
+	}
+	expectFailed := []bool{false, false, true, false, true}
+	for idx, err := range errs {
+		if (err != nil) != expectFailed[idx] {
+			t.Errorf("Delete of %s returned error %v; expected error: %v", toDelete[idx].Name, err, expectFailed[idx])
+		}
+	}
+}
+
+type NewRetryPolicyTestCase struct {
+	Config      *reaperconfig.RetryPolicy
+	Expected    *RetryPolicy
+	ExpectError bool
+}
+
+var newRetryPolicyTestCases = []NewRetryPolicyTestCase{
+	NewRetryPolicyTestCase{nil, &DefaultRetryPolicy, false},
+	NewRetryPolicyTestCase{
+		&reaperconfig.RetryPolicy{MaxAttempts: 2, InitialBackoff: "100ms"},
+		&RetryPolicy{MaxAttempts: 2, InitialBackoff: 100 * time.Millisecond, MaxBackoff: 30 * time.Second, Multiplier: 2},
+		false,
+	},
+	NewRetryPolicyTestCase{&reaperconfig.RetryPolicy{MaxBackoff: "soon"}, nil, true},
+	NewRetryPolicyTestCase{&reaperconfig.RetryPolicy{Multiplier: 0.5}, nil, true},
+}
+
+func TestNewRetryPolicy(t *testing.T) {
+	for _, testCase := range newRetryPolicyTestCases {
+		result, err := NewRetryPolicy(testCase.Config)
+		if (err != nil) != testCase.ExpectError {
+			t.Errorf("NewRetryPolicy(%v) returned error %v; expected error: %v", testCase.Config, err, testCase.ExpectError)
+			continue
+		}
+		if !testCase.ExpectError && !reflect.DeepEqual(result, testCase.Expected) {
+			t.Errorf("NewRetryPolicy(%v) = %v; want %v", testCase.Config, result, testCase.Expected)
+		}
+	}
+}
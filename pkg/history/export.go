@@ -0,0 +1,91 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package history
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+)
+
+// csvHeader names the columns written by WriteCSV.
+var csvHeader = []string{
+	"attempt_time", "reaper_uuid", "outcome", "resource_type", "project_id", "zone", "name",
+	"time_created", "ttl", "deletion_time", "matched_name_filter", "error",
+}
+
+// WriteJSON writes the records as JSON, one record per line.
+func WriteJSON(w io.Writer, records []*reaperconfig.DeletionRecord) error {
+	marshaler := jsonpb.Marshaler{}
+	for _, record := range records {
+		var line bytes.Buffer
+		if err := marshaler.Marshal(&line, record); err != nil {
+			return fmt.Errorf("encoding deletion record failed with the following error: %s", err.Error())
+		}
+		line.WriteByte('\n')
+		if _, err := w.Write(line.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteCSV writes the records as CSV, preceded by a header row if withHeader is set. Times
+// are in RFC 3339 format.
+func WriteCSV(w io.Writer, records []*reaperconfig.DeletionRecord, withHeader bool) error {
+	writer := csv.NewWriter(w)
+	if withHeader {
+		writer.Write(csvHeader)
+	}
+	for _, record := range records {
+		resource := record.GetResource()
+		writer.Write([]string{
+			formatTimestamp(record.GetAttemptTime()),
+			record.GetReaperUuid(),
+			record.GetOutcome().String(),
+			resource.GetResourceType().String(),
+			resource.GetProjectId(),
+			resource.GetZone(),
+			resource.GetName(),
+			formatTimestamp(resource.GetTimeCreated()),
+			resource.GetTtl(),
+			formatTimestamp(resource.GetDeletionTime()),
+			record.GetMatchedConfig().GetNameFilter(),
+			record.GetError(),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// formatTimestamp formats the timestamp in RFC 3339 format, or as an empty string if it
+// is not set.
+func formatTimestamp(instant *timestamp.Timestamp) string {
+	if instant == nil {
+		return ""
+	}
+	parsed, err := ptypes.Timestamp(instant)
+	if err != nil {
+		return ""
+	}
+	return parsed.Format(time.RFC3339)
+}
@@ -0,0 +1,178 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// Store keeps the history of the deletions attempted by reapers, in the order they were
+// recorded. A store with a path appends each record to the file at the path as a line of
+// JSON, and restores the history from the file when it is opened. Store is safe for
+// concurrent use.
+type Store struct {
+	mu      sync.Mutex
+	path    string
+	records []*reaperconfig.DeletionRecord
+}
+
+// NewMemoryStore returns a store that only keeps the history in memory.
+func NewMemoryStore() *Store {
+	return &Store{}
+}
+
+// OpenStore returns a store that persists the history to the file at the given path, with
+// the history that was already recorded there.
+func OpenStore(path string) (*Store, error) {
+	store := &Store{path: path}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening deletion history %s failed with the following error: %s", path, err.Error())
+	}
+	defer file.Close()
+
+	unmarshaler := jsonpb.Unmarshaler{AllowUnknownFields: true}
+	reader := bufio.NewReader(file)
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			record := &reaperconfig.DeletionRecord{}
+			if err := unmarshaler.Unmarshal(bytes.NewReader(line), record); err != nil {
+				return nil, fmt.Errorf("reading line %d of deletion history %s failed with the following error: %s", lineNumber, path, err.Error())
+			}
+			store.records = append(store.records, record)
+		}
+		if err == io.EOF {
+			return store, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading deletion history %s failed with the following error: %s", path, err.Error())
+		}
+	}
+}
+
+// Append adds the given records to the history.
+func (store *Store) Append(records ...*reaperconfig.DeletionRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.path) > 0 {
+		var lines bytes.Buffer
+		if err := WriteJSON(&lines, records); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(store.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("opening deletion history %s failed with the following error: %s", store.path, err.Error())
+		}
+		_, err = file.Write(lines.Bytes())
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("writing deletion history %s failed with the following error: %s", store.path, err.Error())
+		}
+	}
+	store.records = append(store.records, records...)
+	return nil
+}
+
+// List returns the page of records matching the request's filters that its page token
+// points to. Since records are only ever appended, the pages of a request stay the same as
+// more records are recorded, and new records show up on the last page.
+func (store *Store) List(req *reaperconfig.ListDeletionsRequest) (*reaperconfig.ListDeletionsResponse, error) {
+	offset := 0
+	if len(req.GetPageToken()) > 0 {
+		var err error
+		offset, err = strconv.Atoi(req.GetPageToken())
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("invalid page token %s", req.GetPageToken())
+		}
+	}
+	pageSize := int(req.GetPageSize())
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	} else if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+	startTime, err := optionalTime(req.GetStartTime())
+	if err != nil {
+		return nil, fmt.Errorf("invalid start time: %v", err)
+	}
+	endTime, err := optionalTime(req.GetEndTime())
+	if err != nil {
+		return nil, fmt.Errorf("invalid end time: %v", err)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	response := &reaperconfig.ListDeletionsResponse{}
+	matches := 0
+	for _, record := range store.records {
+		attemptTime, _ := ptypes.Timestamp(record.GetAttemptTime())
+		switch {
+		case len(req.GetUuid()) > 0 && record.GetReaperUuid() != req.GetUuid():
+			continue
+		case len(req.GetProjectId()) > 0 && record.GetResource().GetProjectId() != req.GetProjectId():
+			continue
+		case len(req.GetName()) > 0 && record.GetResource().GetName() != req.GetName():
+			continue
+		case !startTime.IsZero() && attemptTime.Before(startTime):
+			continue
+		case !endTime.IsZero() && !attemptTime.Before(endTime):
+			continue
+		}
+		matches++
+		if matches <= offset {
+			continue
+		}
+		if len(response.Records) == pageSize {
+			response.NextPageToken = strconv.Itoa(offset + pageSize)
+			break
+		}
+		response.Records = append(response.Records, record)
+	}
+	return response, nil
+}
+
+// optionalTime converts the timestamp to a time, which is zero if the timestamp is not set.
+func optionalTime(instant *timestamp.Timestamp) (time.Time, error) {
+	if instant == nil {
+		return time.Time{}, nil
+	}
+	return ptypes.Timestamp(instant)
+}
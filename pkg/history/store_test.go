@@ -0,0 +1,159 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package history
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+)
+
+var historyTime = time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+var testRecords = []*reaperconfig.DeletionRecord{
+	testRecord("reaper-1", "vm-1", "project1", 0, reaperconfig.DeletionOutcome_DELETED),
+	testRecord("reaper-1", "vm-2", "project1", time.Hour, reaperconfig.DeletionOutcome_FAILED),
+	testRecord("reaper-2", "vm-1", "project2", 2*time.Hour, reaperconfig.DeletionOutcome_DELETED),
+	testRecord("reaper-1", "vm-3", "project1", 3*time.Hour, reaperconfig.DeletionOutcome_SKIPPED),
+	testRecord("reaper-2", "vm-4", "project2", 4*time.Hour, reaperconfig.DeletionOutcome_DELETED),
+}
+
+type ListTestCase struct {
+	Request               *reaperconfig.ListDeletionsRequest
+	ExpectedNames         []string
+	ExpectedNextPageToken string
+	ExpectedError         bool
+}
+
+var listTestCases = []ListTestCase{
+	ListTestCase{&reaperconfig.ListDeletionsRequest{}, []string{"vm-1", "vm-2", "vm-1", "vm-3", "vm-4"}, "", false},
+	ListTestCase{&reaperconfig.ListDeletionsRequest{Uuid: "reaper-1"}, []string{"vm-1", "vm-2", "vm-3"}, "", false},
+	ListTestCase{&reaperconfig.ListDeletionsRequest{ProjectId: "project2", Name: "vm-1"}, []string{"vm-1"}, "", false},
+	ListTestCase{
+		&reaperconfig.ListDeletionsRequest{StartTime: historyTimestamp(time.Hour), EndTime: historyTimestamp(3 * time.Hour)},
+		[]string{"vm-2", "vm-1"}, "", false,
+	},
+	ListTestCase{&reaperconfig.ListDeletionsRequest{PageSize: 2}, []string{"vm-1", "vm-2"}, "2", false},
+	ListTestCase{&reaperconfig.ListDeletionsRequest{PageSize: 2, PageToken: "2"}, []string{"vm-1", "vm-3"}, "4", false},
+	ListTestCase{&reaperconfig.ListDeletionsRequest{PageSize: 2, PageToken: "4"}, []string{"vm-4"}, "", false},
+	ListTestCase{&reaperconfig.ListDeletionsRequest{Uuid: "reaper-1", PageSize: 2, PageToken: "2"}, []string{"vm-3"}, "", false},
+	ListTestCase{&reaperconfig.ListDeletionsRequest{PageToken: "invalid"}, nil, "", true},
+}
+
+func TestList(t *testing.T) {
+	store := NewMemoryStore()
+	store.Append(testRecords...)
+	for _, testCase := range listTestCases {
+		response, err := store.List(testCase.Request)
+		if gotError := err != nil; gotError != testCase.ExpectedError {
+			t.Errorf("Expected error %v for request %v, got %v", testCase.ExpectedError, testCase.Request, err)
+			continue
+		}
+		var names []string
+		for _, record := range response.GetRecords() {
+			names = append(names, record.GetResource().GetName())
+		}
+		if !reflect.DeepEqual(names, testCase.ExpectedNames) || response.GetNextPageToken() != testCase.ExpectedNextPageToken {
+			t.Errorf(
+				"Expected %v with next page token %q for request %v, got %v with %q",
+				testCase.ExpectedNames, testCase.ExpectedNextPageToken, testCase.Request, names, response.GetNextPageToken(),
+			)
+		}
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	path := filepath.Join(tempDir, "deletions.jsonl")
+
+	store, err := OpenStore(path)
+	if err != nil {
+		t.Fatalf("OpenStore failed with the following error: %s", err.Error())
+	}
+	store.Append(testRecords[:2]...)
+	store.Append(testRecords[2:]...)
+
+	reopenedStore, err := OpenStore(path)
+	if err != nil {
+		t.Fatalf("OpenStore failed with the following error: %s", err.Error())
+	}
+	response, _ := reopenedStore.List(&reaperconfig.ListDeletionsRequest{})
+	if len(response.GetRecords()) != len(testRecords) {
+		t.Fatalf("Expected %d records after reopening the store, got %d", len(testRecords), len(response.GetRecords()))
+	}
+	for idx, record := range response.GetRecords() {
+		if !proto.Equal(record, testRecords[idx]) {
+			t.Errorf("Expected record %v, got %v", testRecords[idx], record)
+		}
+	}
+
+	ioutil.WriteFile(path, []byte("not json\n"), 0644)
+	if _, err := OpenStore(path); err == nil {
+		t.Error("Expected error opening a corrupted deletion history")
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var output bytes.Buffer
+	if err := WriteCSV(&output, testRecords[1:2], true); err != nil {
+		t.Fatalf("WriteCSV failed with the following error: %s", err.Error())
+	}
+	expected := strings.Join(csvHeader, ",") + "\n" +
+		"2020-06-01T13:00:00Z,reaper-1,FAILED,GCE_VM,project1,zone1,vm-2,2020-06-01T10:00:00Z,1h,2020-06-01T11:00:00Z,^vm-,test error\n"
+	if output.String() != expected {
+		t.Errorf("Expected CSV:\n%s\ngot:\n%s", expected, output.String())
+	}
+}
+
+func testRecord(reaperUUID, name, projectID string, attempted time.Duration, outcome reaperconfig.DeletionOutcome) *reaperconfig.DeletionRecord {
+	record := &reaperconfig.DeletionRecord{
+		ReaperUuid: reaperUUID,
+		Resource: &reaperconfig.WatchedResource{
+			Name:         name,
+			Zone:         "zone1",
+			ProjectId:    projectID,
+			ResourceType: reaperconfig.ResourceType_GCE_VM,
+			TimeCreated:  historyTimestamp(-2 * time.Hour),
+			Ttl:          "1h",
+			DeletionTime: historyTimestamp(-time.Hour),
+		},
+		MatchedConfig: &reaperconfig.ResourceConfig{NameFilter: "^vm-", Ttl: "1h"},
+		AttemptTime:   historyTimestamp(attempted),
+		Outcome:       outcome,
+	}
+	if outcome == reaperconfig.DeletionOutcome_FAILED {
+		record.Error = "test error"
+	}
+	return record
+}
+
+func historyTimestamp(offset time.Duration) *timestamp.Timestamp {
+	instant, _ := ptypes.TimestampProto(historyTime.Add(offset))
+	return instant
+}
@@ -0,0 +1,279 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/logger"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/reaper"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"gopkg.in/yaml.v2"
+)
+
+// configPollInterval is how often the config directory is checked for changed files. The
+// directory is polled rather than watched for file system events, since polling sees every
+// kind of change the same way, including the symlink swaps that update files mounted from a
+// Kubernetes ConfigMap, and files on network file systems that do not report events.
+const configPollInterval = 5 * time.Second
+
+// ParseConfigFile parses a ReaperConfig from the contents of a config file. The format is
+// picked from the file extension, which is one of .textproto, .textpb or .pbtxt for the
+// text proto format, .json for JSON, and .yaml or .yml for YAML. JSON and YAML configs use
+// the JSON names of the ReaperConfig fields.
+func ParseConfigFile(path string, contents []byte) (*reaperconfig.ReaperConfig, error) {
+	config := &reaperconfig.ReaperConfig{}
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".textproto", ".textpb", ".pbtxt":
+		err = proto.UnmarshalText(string(contents), config)
+	case ".json":
+		err = jsonpb.Unmarshal(bytes.NewReader(contents), config)
+	case ".yaml", ".yml":
+		var jsonContents []byte
+		jsonContents, err = yamlToJSON(contents)
+		if err == nil {
+			err = jsonpb.Unmarshal(bytes.NewReader(jsonContents), config)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config file format %s", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// isConfigFile returns whether the file at the given path is in one of the config formats.
+func isConfigFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".textproto", ".textpb", ".pbtxt", ".json", ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// yamlToJSON converts a YAML document into JSON, so that it can be parsed as a proto.
+func yamlToJSON(contents []byte) ([]byte, error) {
+	var document interface{}
+	if err := yaml.Unmarshal(contents, &document); err != nil {
+		return nil, err
+	}
+	jsonDocument, err := jsonValue(document)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonDocument)
+}
+
+// jsonValue converts a value decoded from YAML into a value that can be encoded as JSON,
+// which only has string map keys.
+func jsonValue(value interface{}) (interface{}, error) {
+	switch typedValue := value.(type) {
+	case map[interface{}]interface{}:
+		jsonMap := make(map[string]interface{}, len(typedValue))
+		for key, mapValue := range typedValue {
+			stringKey, isString := key.(string)
+			if !isString {
+				return nil, fmt.Errorf("YAML map key %v is not a string", key)
+			}
+			jsonMapValue, err := jsonValue(mapValue)
+			if err != nil {
+				return nil, err
+			}
+			jsonMap[stringKey] = jsonMapValue
+		}
+		return jsonMap, nil
+	case []interface{}:
+		jsonList := make([]interface{}, len(typedValue))
+		for idx, listValue := range typedValue {
+			jsonListValue, err := jsonValue(listValue)
+			if err != nil {
+				return nil, err
+			}
+			jsonList[idx] = jsonListValue
+		}
+		return jsonList, nil
+	default:
+		return value, nil
+	}
+}
+
+// configFile is a config file the configWatcher has seen, along with the UUID of the
+// reaper it configures. The UUID is empty if the file never parsed into a valid config.
+type configFile struct {
+	contents []byte
+	uuid     string
+}
+
+// configWatcher keeps the manager's reapers in sync with the ReaperConfig files in a
+// directory. Added, changed and removed files add, update and delete reapers. Files that
+// fail to parse are reported, and the reapers they configured keep running as they were.
+// Reapers added through the manager are left alone, unless a file sets their UUID.
+type configWatcher struct {
+	dir     string
+	manager *ReaperManager
+	files   map[string]*configFile
+}
+
+// newConfigWatcher creates a configWatcher for the config files in the given directory. The
+// reapers the manager restored from its config files are known to the watcher from the
+// start, so that the reapers whose files were removed while the manager was not running are
+// deleted on the first reconcile.
+func newConfigWatcher(dir string, manager *ReaperManager) *configWatcher {
+	files := make(map[string]*configFile)
+	for name, uuid := range manager.configFiles() {
+		files[filepath.Join(dir, name)] = &configFile{uuid: uuid}
+	}
+	return &configWatcher{dir: dir, manager: manager, files: files}
+}
+
+// watch reconciles the reapers with the config files right away, and then every time the
+// config poll interval passes, until the context is cancelled.
+func (watcher *configWatcher) watch(ctx context.Context) {
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+	for {
+		watcher.reconcile()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reconcile applies the config files that were added or changed since the last reconcile,
+// and deletes the reapers of the files that were removed. A reaper whose file was renamed
+// is updated from its new file rather than deleted.
+func (watcher *configWatcher) reconcile() {
+	entries, err := ioutil.ReadDir(watcher.dir)
+	if err != nil {
+		logger.Error(fmt.Errorf("reading config directory %s failed with the following error: %s", watcher.dir, err.Error()))
+		return
+	}
+
+	seen := make(map[string]bool)
+	var paths []string
+	contents := make(map[string][]byte)
+	for _, entry := range entries {
+		path := filepath.Join(watcher.dir, entry.Name())
+		if entry.IsDir() || !isConfigFile(path) {
+			continue
+		}
+		seen[path] = true
+		fileContents, err := ioutil.ReadFile(path)
+		if err != nil {
+			logger.Error(fmt.Errorf("reading config file %s failed with the following error: %s", path, err.Error()))
+			continue
+		}
+		paths = append(paths, path)
+		contents[path] = fileContents
+	}
+
+	// The removed files are forgotten before the other files are applied, so that a file
+	// with the UUID of a removed file takes over its reaper.
+	removed := make(map[string]string)
+	for path, file := range watcher.files {
+		if seen[path] {
+			continue
+		}
+		if len(file.uuid) > 0 {
+			removed[file.uuid] = path
+		}
+		delete(watcher.files, path)
+	}
+
+	for _, path := range paths {
+		file, isKnown := watcher.files[path]
+		if !isKnown {
+			file = &configFile{}
+			watcher.files[path] = file
+		} else if bytes.Equal(file.contents, contents[path]) {
+			continue
+		}
+		file.contents = contents[path]
+		if err := watcher.apply(path, file); err != nil {
+			logger.Error(fmt.Errorf("config file %s not applied: %v", path, err))
+		}
+	}
+
+	for uuid, path := range removed {
+		if watcher.isConfigured(uuid) {
+			continue
+		}
+		logger.Logf("Config file %s removed, deleting reaper with UUID %s", path, uuid)
+		if err := watcher.manager.DeleteReaper(uuid); err != nil {
+			logger.Error(err)
+		}
+	}
+}
+
+// isConfigured returns whether the reaper with the given UUID is configured by one of the
+// config files.
+func (watcher *configWatcher) isConfigured(uuid string) bool {
+	for _, file := range watcher.files {
+		if file.uuid == uuid {
+			return true
+		}
+	}
+	return false
+}
+
+// apply adds or updates the reaper configured by the given file. If the file used to
+// configure a reaper with a different UUID, that reaper is deleted.
+func (watcher *configWatcher) apply(path string, file *configFile) error {
+	config, err := ParseConfigFile(path, file.contents)
+	if err != nil {
+		return err
+	}
+	uuid := config.GetUuid()
+	if len(uuid) == 0 {
+		return fmt.Errorf("config must set a UUID")
+	}
+	for otherPath, otherFile := range watcher.files {
+		if otherPath != path && otherFile.uuid == uuid {
+			return fmt.Errorf("UUID %s is already used by config file %s", uuid, otherPath)
+		}
+	}
+	if err := reaper.NewReaper().UpdateReaperConfig(config); err != nil {
+		return err
+	}
+
+	if file.uuid == uuid || watcher.manager.GetReaper(uuid) != nil {
+		err = watcher.manager.UpdateReaper(config)
+	} else {
+		err = watcher.manager.AddReaperFromConfig(config)
+	}
+	if err != nil {
+		return err
+	}
+	if len(file.uuid) > 0 && file.uuid != uuid {
+		if err := watcher.manager.DeleteReaper(file.uuid); err != nil {
+			logger.Error(err)
+		}
+	}
+	file.uuid = uuid
+	return watcher.manager.setConfigFile(uuid, filepath.Base(path))
+}
@@ -0,0 +1,189 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/reaper"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/state"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"github.com/robfig/cron/v3"
+)
+
+var expectedFileConfig = &reaperconfig.ReaperConfig{
+	Uuid:      "UUID_1",
+	ProjectId: "testProject",
+	Schedule:  "@every 1h",
+	Resources: []*reaperconfig.ResourceConfig{
+		&reaperconfig.ResourceConfig{
+			ResourceType: reaperconfig.ResourceType_GCS_BUCKET,
+			NameFilter:   "test-",
+			Zones:        []string{"US"},
+			Ttl:          "6h",
+		},
+	},
+}
+
+type ParseConfigFileTestCase struct {
+	Path        string
+	Contents    string
+	ExpectError bool
+}
+
+var parseConfigFileTestCases = []ParseConfigFileTestCase{
+	ParseConfigFileTestCase{
+		"reaper.textproto",
+		`uuid: "UUID_1" project_id: "testProject" schedule: "@every 1h"
+		resources { resource_type: GCS_BUCKET name_filter: "test-" zones: "US" ttl: "6h" }`,
+		false,
+	},
+	ParseConfigFileTestCase{
+		"reaper.json",
+		`{"uuid": "UUID_1", "projectId": "testProject", "schedule": "@every 1h",
+		"resources": [{"resourceType": "GCS_BUCKET", "nameFilter": "test-", "zones": ["US"], "ttl": "6h"}]}`,
+		false,
+	},
+	ParseConfigFileTestCase{
+		"reaper.yaml",
+		"uuid: UUID_1\nproject_id: testProject\nschedule: '@every 1h'\nresources:\n- resource_type: GCS_BUCKET\n  name_filter: test-\n  zones: [US]\n  ttl: 6h\n",
+		false,
+	},
+	ParseConfigFileTestCase{"reaper.yaml", "uuid: UUID_1\nunknown_field: true\n", true},
+	ParseConfigFileTestCase{"reaper.json", `{"uuid": `, true},
+	ParseConfigFileTestCase{"reaper.txt", `uuid: "UUID_1"`, true},
+}
+
+func TestParseConfigFile(t *testing.T) {
+	for _, testCase := range parseConfigFileTestCases {
+		config, err := ParseConfigFile(testCase.Path, []byte(testCase.Contents))
+		if (err != nil) != testCase.ExpectError {
+			t.Errorf("ParseConfigFile(%s) returned error %v; expected error: %v", testCase.Path, err, testCase.ExpectError)
+			continue
+		}
+		if !testCase.ExpectError && !proto.Equal(config, expectedFileConfig) {
+			t.Errorf("ParseConfigFile(%s) = %v; want %v", testCase.Path, config, expectedFileConfig)
+		}
+	}
+}
+
+func TestConfigWatcher(t *testing.T) {
+	configDir, err := ioutil.TempDir("", "configs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(configDir)
+	writeConfig := func(name, contents string) {
+		if err := ioutil.WriteFile(filepath.Join(configDir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testManager := NewReaperManager(context.Background())
+	defer testManager.stopReapers()
+	watcher := newConfigWatcher(configDir, testManager)
+	applyChanges := func(expectedReapers int) {
+		watcher.reconcile()
+		if reapers := len(testManager.ListReapers()); reapers != expectedReapers {
+			t.Errorf("Expected %d reapers, got %d", expectedReapers, reapers)
+		}
+	}
+
+	writeConfig("first.yaml", "uuid: UUID_1\nproject_id: testProject\nschedule: '@every 1h'\n")
+	writeConfig("second.json", `{"uuid": "UUID_2", "projectId": "testProject", "schedule": "@every 1h"}`)
+	writeConfig("README.md", "Not a config file")
+	applyChanges(2)
+	applyChanges(2)
+
+	writeConfig("first.yaml", "uuid: UUID_1\nproject_id: testProject\nschedule: '@every 2h'\n")
+	applyChanges(2)
+	if !reflect.DeepEqual(testManager.GetReaper("UUID_1").Schedule, cron.Every(2*time.Hour)) {
+		t.Error("Reaper not updated from changed config file")
+	}
+
+	writeConfig("first.yaml", "uuid: UUID_1\nschedule: [")
+	writeConfig("third.textproto", `uuid: "UUID_2" project_id: "testProject" schedule: "@every 1h"`)
+	applyChanges(2)
+	if !reflect.DeepEqual(testManager.GetReaper("UUID_1").Schedule, cron.Every(2*time.Hour)) {
+		t.Error("Reaper changed by config file that failed to parse")
+	}
+
+	os.Remove(filepath.Join(configDir, "second.json"))
+	os.Remove(filepath.Join(configDir, "third.textproto"))
+	applyChanges(1)
+	if testManager.GetReaper("UUID_2") != nil {
+		t.Error("Reaper not deleted when its config file was removed")
+	}
+}
+
+func TestConfigWatcherRestoredReapers(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "configs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	configDir := filepath.Join(tempDir, "configs")
+	if err := os.Mkdir(configDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	store := state.NewFileStore(filepath.Join(tempDir, "state.json"))
+	writeConfig := func(name, uuid string) {
+		contents := fmt.Sprintf("uuid: %s\nproject_id: testProject\nschedule: '@every 1h'\n", uuid)
+		if err := ioutil.WriteFile(filepath.Join(configDir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testManager := NewReaperManager(context.Background())
+	testManager.LoadState(store)
+	writeConfig("first.yaml", "UUID_1")
+	writeConfig("second.yaml", "UUID_2")
+	newConfigWatcher(configDir, testManager).reconcile()
+	testManager.AddReaperFromConfig(reaper.NewReaperConfig(nil, "@every 1h", "testProject", "UUID_3"))
+	testManager.stopReapers()
+
+	// Restart the manager after the second config file was removed, and the first one was
+	// renamed, while it was not running.
+	os.Remove(filepath.Join(configDir, "second.yaml"))
+	os.Rename(filepath.Join(configDir, "first.yaml"), filepath.Join(configDir, "renamed.yaml"))
+	restartedManager := NewReaperManager(context.Background())
+	defer restartedManager.stopReapers()
+	restartedManager.LoadState(store)
+	watcher := newConfigWatcher(configDir, restartedManager)
+	watcher.reconcile()
+
+	expectedUUIDs := []string{"UUID_1", "UUID_3"}
+	if uuids := restartedManager.ListReaperUUIDs(); !reflect.DeepEqual(uuids, expectedUUIDs) {
+		t.Errorf("Expected reapers %v after the restart, got %v", expectedUUIDs, uuids)
+	}
+	expectedConfigFiles := map[string]string{"renamed.yaml": "UUID_1"}
+	if configFiles := restartedManager.configFiles(); !reflect.DeepEqual(configFiles, expectedConfigFiles) {
+		t.Errorf("Expected config files %v, got %v", expectedConfigFiles, configFiles)
+	}
+
+	os.Remove(filepath.Join(configDir, "renamed.yaml"))
+	watcher.reconcile()
+	if uuids := restartedManager.ListReaperUUIDs(); !reflect.DeepEqual(uuids, []string{"UUID_3"}) {
+		t.Errorf("Expected only the reaper added without a config file to remain, got %v", uuids)
+	}
+}
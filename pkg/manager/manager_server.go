@@ -19,23 +19,44 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"sync"
 
 	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/history"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/logger"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/reaper"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/state"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
 	"google.golang.org/api/option"
 	"google.golang.org/grpc"
 )
 
 // reaperManagerServer is the gRPC server for interacting with the reaper
-// manager.
+// manager. Its lock guards starting and shutting down the manager.
 type reaperManagerServer struct {
-	Manager       *ReaperManager
-	clientOptions []option.ClientOption
+	mu                sync.Mutex
+	Manager           *ReaperManager
+	options           ServerOptions
+	stopConfigWatcher context.CancelFunc
+}
+
+// ServerOptions configure the reaper manager run by the gRPC server.
+type ServerOptions struct {
+	// Store, if set, is where the reaper manager restores its reapers from when it starts,
+	// and saves them to.
+	Store state.Store
+	// History, if set, is where the deletions attempted by reapers are recorded. Otherwise the
+	// deletion history is only kept in memory.
+	History *history.Store
+	// ConfigDir, if set, is a directory of ReaperConfig files that the reaper manager keeps
+	// its reapers in sync with. The reaper manager is started along with the server.
+	ConfigDir string
+	// ClientOptions are used by all reapers to authenticate with GCP.
+	ClientOptions []option.ClientOption
 }
 
 // StartServer starts the gRPC server listing on the given address and port.
-func StartServer(port string, clientOptions ...option.ClientOption) {
+func StartServer(port string, options ServerOptions) {
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
 	if err != nil {
 		logger.Error(err)
@@ -46,85 +67,226 @@ func StartServer(port string, clientOptions ...option.ClientOption) {
 	defer logger.Log("------------------ Shutting down gRPC Server ------------------")
 
 	server := grpc.NewServer()
-	reaperconfig.RegisterReaperManagerServer(server, &reaperManagerServer{})
+	managerServer := &reaperManagerServer{options: options}
+	reaperconfig.RegisterReaperManagerServer(server, managerServer)
+	if len(options.ConfigDir) > 0 {
+		if _, err := managerServer.StartManager(context.Background(), new(empty.Empty)); err != nil {
+			logger.Error(err)
+			os.Exit(1)
+		}
+	}
 	server.Serve(lis)
 }
 
 // AddReaper adds a new reaper to the manager with the given config, and returns the UUID if the
 // add was successful.
 func (s *reaperManagerServer) AddReaper(ctx context.Context, config *reaperconfig.ReaperConfig) (*reaperconfig.Reaper, error) {
-	if s.Manager == nil {
-		return nil, fmt.Errorf("Reaper manager not started")
+	manager, err := s.getManager()
+	if err != nil {
+		return nil, err
 	}
-
-	if watchedReaper := s.Manager.GetReaper(config.GetUuid()); watchedReaper != nil {
-		err := fmt.Errorf("Reaper with UUID %s already exists", watchedReaper.UUID)
+	if err := manager.AddReaperFromConfig(config); err != nil {
 		return nil, err
 	}
-	s.Manager.AddReaperFromConfig(config)
 	return &reaperconfig.Reaper{Uuid: config.GetUuid()}, nil
 }
 
 // UpdateReaper updates the reaper with the UUID given in the config with the data in the config, and returns
 // the UUID if the update was successful.
 func (s *reaperManagerServer) UpdateReaper(ctx context.Context, config *reaperconfig.ReaperConfig) (*reaperconfig.Reaper, error) {
-	if s.Manager == nil {
-		return nil, fmt.Errorf("Reaper manager not started")
+	manager, err := s.getManager()
+	if err != nil {
+		return nil, err
 	}
-
-	if watchedReaper := s.Manager.GetReaper(config.GetUuid()); watchedReaper == nil {
-		err := fmt.Errorf("Reaper with UUID %s does not exist", watchedReaper.UUID)
+	if err := manager.UpdateReaper(config); err != nil {
 		return nil, err
 	}
-	s.Manager.UpdateReaper(config)
 	return &reaperconfig.Reaper{Uuid: config.GetUuid()}, nil
 }
 
 // DeleteReaper deletes the reaper with the given UUID, and returns the UUID if the delete was successful.
 func (s *reaperManagerServer) DeleteReaper(ctx context.Context, reaperToDelete *reaperconfig.Reaper) (*reaperconfig.Reaper, error) {
-	if s.Manager == nil {
-		return nil, fmt.Errorf("Reaper manager not started")
+	manager, err := s.getManager()
+	if err != nil {
+		return nil, err
 	}
-
-	if watchedReaper := s.Manager.GetReaper(reaperToDelete.GetUuid()); watchedReaper == nil {
-		err := fmt.Errorf("Reaper with UUID %s does not exist", reaperToDelete.GetUuid())
+	if err := manager.DeleteReaper(reaperToDelete.GetUuid()); err != nil {
 		return nil, err
 	}
-	s.Manager.DeleteReaper(reaperToDelete.GetUuid())
 	return &reaperconfig.Reaper{Uuid: reaperToDelete.GetUuid()}, nil
 }
 
 // ListRunningReapers returns a list of UUIDs of all the running reapers.
 func (s *reaperManagerServer) ListRunningReapers(ctx context.Context, req *empty.Empty) (*reaperconfig.ReaperCluster, error) {
-	if s.Manager == nil {
-		return nil, fmt.Errorf("Reaper manager not started")
+	manager, err := s.getManager()
+	if err != nil {
+		return nil, err
 	}
 
 	reaperCluster := &reaperconfig.ReaperCluster{}
-	for _, watchedReaper := range s.Manager.Reapers {
-		reaper := &reaperconfig.Reaper{Uuid: watchedReaper.UUID}
-		reaperCluster.Reapers = append(reaperCluster.Reapers, reaper)
+	for _, uuid := range manager.ListReaperUUIDs() {
+		reaperCluster.Reapers = append(reaperCluster.Reapers, &reaperconfig.Reaper{Uuid: uuid})
 	}
 	return reaperCluster, nil
 }
 
+// GetDryRunReport returns the resources the reaper with the given UUID would have deleted
+// on its last dry run.
+func (s *reaperManagerServer) GetDryRunReport(ctx context.Context, req *reaperconfig.Reaper) (*reaperconfig.DryRunReport, error) {
+	manager, err := s.getManager()
+	if err != nil {
+		return nil, err
+	}
+
+	return manager.GetDryRunReport(req.GetUuid())
+}
+
+// OverrideDeletionLimits allows the next sweep of the tripped reaper with the given UUID to
+// proceed regardless of its deletion limits.
+func (s *reaperManagerServer) OverrideDeletionLimits(ctx context.Context, req *reaperconfig.Reaper) (*reaperconfig.Reaper, error) {
+	manager, err := s.getManager()
+	if err != nil {
+		return nil, err
+	}
+
+	err = manager.WithReaper(ctx, req.GetUuid(), func(watchedReaper *reaper.Reaper) error {
+		return watchedReaper.OverrideDeletionLimits()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &reaperconfig.Reaper{Uuid: req.GetUuid()}, nil
+}
+
+// RunReaper runs the reaper with the given UUID right away, and returns the summary of its sweep.
+func (s *reaperManagerServer) RunReaper(ctx context.Context, req *reaperconfig.Reaper) (*reaperconfig.SweepSummary, error) {
+	manager, err := s.getManager()
+	if err != nil {
+		return nil, err
+	}
+	return manager.RunReaper(ctx, req.GetUuid())
+}
+
+// PauseReaper pauses the reaper with the given UUID, and returns the UUID if the pause was successful.
+func (s *reaperManagerServer) PauseReaper(ctx context.Context, req *reaperconfig.Reaper) (*reaperconfig.Reaper, error) {
+	manager, err := s.getManager()
+	if err != nil {
+		return nil, err
+	}
+	if err := manager.PauseReaper(req.GetUuid()); err != nil {
+		return nil, err
+	}
+	return &reaperconfig.Reaper{Uuid: req.GetUuid()}, nil
+}
+
+// ResumeReaper resumes the reaper with the given UUID, and returns the UUID if the resume was successful.
+func (s *reaperManagerServer) ResumeReaper(ctx context.Context, req *reaperconfig.Reaper) (*reaperconfig.Reaper, error) {
+	manager, err := s.getManager()
+	if err != nil {
+		return nil, err
+	}
+	if err := manager.ResumeReaper(req.GetUuid()); err != nil {
+		return nil, err
+	}
+	return &reaperconfig.Reaper{Uuid: req.GetUuid()}, nil
+}
+
+// PauseManager pauses all reapers.
+func (s *reaperManagerServer) PauseManager(ctx context.Context, req *empty.Empty) (*empty.Empty, error) {
+	manager, err := s.getManager()
+	if err != nil {
+		return nil, err
+	}
+	manager.PauseAll()
+	return new(empty.Empty), nil
+}
+
+// ResumeManager resumes all reapers that are not paused on their own.
+func (s *reaperManagerServer) ResumeManager(ctx context.Context, req *empty.Empty) (*empty.Empty, error) {
+	manager, err := s.getManager()
+	if err != nil {
+		return nil, err
+	}
+	manager.ResumeAll()
+	return new(empty.Empty), nil
+}
+
+// GetReaper returns the config and status of the reaper with the given UUID.
+func (s *reaperManagerServer) GetReaper(ctx context.Context, req *reaperconfig.Reaper) (*reaperconfig.ReaperStatus, error) {
+	manager, err := s.getManager()
+	if err != nil {
+		return nil, err
+	}
+	return manager.GetReaperStatus(req.GetUuid())
+}
+
+// GetWatchlist returns the resources watched by one or all reapers, filtered and sorted as requested.
+func (s *reaperManagerServer) GetWatchlist(ctx context.Context, req *reaperconfig.WatchlistRequest) (*reaperconfig.Watchlist, error) {
+	manager, err := s.getManager()
+	if err != nil {
+		return nil, err
+	}
+	return manager.GetWatchlist(req)
+}
+
+// ListDeletions returns the page of the deletion history that matches the request.
+func (s *reaperManagerServer) ListDeletions(ctx context.Context, req *reaperconfig.ListDeletionsRequest) (*reaperconfig.ListDeletionsResponse, error) {
+	manager, err := s.getManager()
+	if err != nil {
+		return nil, err
+	}
+	return manager.ListDeletions(req)
+}
+
 // StartManager begins the reaper manager process. This must be called before any reaper operations
 // are invokved.
 func (s *reaperManagerServer) StartManager(ctx context.Context, req *empty.Empty) (*empty.Empty, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if s.Manager != nil {
 		return new(empty.Empty), fmt.Errorf("reaper manager already running")
 	}
-	s.Manager = NewReaperManager(context.Background(), s.clientOptions...)
+	reaperManager := NewReaperManager(context.Background(), s.options.ClientOptions...)
+	if s.options.History != nil {
+		reaperManager.SetHistory(s.options.History)
+	}
+	if s.options.Store != nil {
+		if err := reaperManager.LoadState(s.options.Store); err != nil {
+			return new(empty.Empty), fmt.Errorf("restoring reapers failed with the following error: %s", err.Error())
+		}
+	}
+	s.Manager = reaperManager
 	go s.Manager.MonitorReapers()
+	if len(s.options.ConfigDir) > 0 {
+		watcherCtx, cancel := context.WithCancel(context.Background())
+		s.stopConfigWatcher = cancel
+		go newConfigWatcher(s.options.ConfigDir, s.Manager).watch(watcherCtx)
+	}
 	return new(empty.Empty), nil
 }
 
 // ShutdownManager ends the reaper manager process. This deletes all currently running reapers.
 func (s *reaperManagerServer) ShutdownManager(ctx context.Context, req *empty.Empty) (*empty.Empty, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if s.Manager == nil {
 		return new(empty.Empty), fmt.Errorf("reaper manager already shutdown")
 	}
+	if s.stopConfigWatcher != nil {
+		s.stopConfigWatcher()
+		s.stopConfigWatcher = nil
+	}
 	s.Manager.Shutdown()
 	s.Manager = nil
 	return new(empty.Empty), nil
 }
+
+// getManager returns the running reaper manager, or an error if the manager is not started.
+func (s *reaperManagerServer) getManager() (*ReaperManager, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Manager == nil {
+		return nil, fmt.Errorf("Reaper manager not started")
+	}
+	return s.Manager, nil
+}
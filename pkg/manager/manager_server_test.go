@@ -20,7 +20,6 @@ import (
 	"net"
 	"strings"
 	"testing"
-	"time"
 
 	"github.com/golang/protobuf/ptypes/empty"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/reaper"
@@ -101,7 +100,6 @@ func TestAddReaper(t *testing.T) {
 		} else if testCase.Expected == nil && err == nil {
 			t.Fatalf("Expected error to be thrown since name already exists")
 		}
-		time.Sleep(time.Second * 2)
 	}
 }
 
@@ -17,25 +17,40 @@ package manager
 import (
 	"context"
 	"fmt"
-	"strings"
-	"time"
+	"sync"
 
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/history"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/logger"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/reaper"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/state"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"github.com/robfig/cron/v3"
 	"google.golang.org/api/option"
 )
 
-// ReaperManager is a controller for all running reapers.
+// ReaperManager is a controller for all running reapers. Each reaper runs on its own
+// schedule, and a reaper never runs more than once at a time. The manager is safe for
+// concurrent use: adds, updates and deletes of reapers take effect before they return.
 type ReaperManager struct {
-	Reapers []*reaper.Reaper
-
 	ctx           context.Context
 	clientOptions []option.ClientOption
-	newReaper     chan *reaper.Reaper
-	deleteReaper  chan string
-	updateReaper  chan *reaperconfig.ReaperConfig
+	scheduler     *cron.Cron
+	runs          sync.WaitGroup
 	quit          chan bool
+
+	// mu guards the managed reapers, their schedules and their saved state, whether all
+	// reapers are paused, and the deletion history.
+	mu      sync.Mutex
+	reapers []*managedReaper
+	paused  bool
+	history *history.Store
+
+	// saveMu serializes saves to the store, so that an older state never overwrites a
+	// newer one.
+	saveMu sync.Mutex
+	store  state.Store
 }
 
 // NewReaperManager creates a new reaper manager.
@@ -43,84 +58,346 @@ func NewReaperManager(ctx context.Context, clientOptions ...option.ClientOption)
 	return &ReaperManager{
 		ctx:           ctx,
 		clientOptions: clientOptions,
-		newReaper:     make(chan *reaper.Reaper, 3),
-		deleteReaper:  make(chan string, 3),
-		updateReaper:  make(chan *reaperconfig.ReaperConfig, 3),
+		scheduler:     cron.New(),
 		quit:          make(chan bool, 1),
+		history:       history.NewMemoryStore(),
 	}
 }
 
-// MonitorReapers is the controller for all running reapers. It continuously
-// cycles between all running reapers to run a sweep. The method also checks
-// whether a new reaper has been added to the manager, or if the the manager
-// should be stopped. Note that MonitorReapers should be called in a separate
-// goroutine.
+// SetHistory sets the store the deletions attempted by the manager's reapers are recorded
+// in. By default, the history is only kept in memory.
+func (manager *ReaperManager) SetHistory(store *history.Store) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	manager.history = store
+}
+
+// ListDeletions returns the page of the deletion history that matches the request.
+func (manager *ReaperManager) ListDeletions(req *reaperconfig.ListDeletionsRequest) (*reaperconfig.ListDeletionsResponse, error) {
+	manager.mu.Lock()
+	store := manager.history
+	manager.mu.Unlock()
+	return store.List(req)
+}
+
+// recordDeletions adds the given deletion records to the deletion history. Failing to
+// record is logged.
+func (manager *ReaperManager) recordDeletions(deletions []*reaperconfig.DeletionRecord) {
+	manager.mu.Lock()
+	store := manager.history
+	manager.mu.Unlock()
+	if err := store.Append(deletions...); err != nil {
+		logger.Error(fmt.Errorf("recording deletion history failed with the following error: %s", err.Error()))
+	}
+}
+
+// MonitorReapers is the controller for all running reapers. It starts the scheduler that
+// runs each reaper on its schedule, and blocks until the manager is shut down or its
+// context is cancelled. Shutting down cancels the reapers that are running, and waits for
+// them to finish. Note that MonitorReapers should be called in a separate goroutine.
 func (manager *ReaperManager) MonitorReapers() {
 	logger.Log("Starting Reaper Manager")
-	for {
-		select {
-		case <-manager.quit:
-			logger.Log("Quitting reaper manager")
-			return
-		default:
-			manager.sweepReapers()
+	manager.scheduler.Start()
+	select {
+	case <-manager.quit:
+	case <-manager.ctx.Done():
+	}
+	logger.Log("Quitting reaper manager")
+	manager.stopReapers()
+}
+
+// AddReaper adds a reaper to the manager and schedules it. An error is returned if the
+// manager already has a reaper with the same UUID.
+func (manager *ReaperManager) AddReaper(newReaper *reaper.Reaper) error {
+	manager.mu.Lock()
+	if manager.findReaper(newReaper.UUID) != nil {
+		manager.mu.Unlock()
+		return fmt.Errorf("Reaper with UUID %s already exists", newReaper.UUID)
+	}
+	manager.addManagedReaper(newReaper, false, "")
+	manager.mu.Unlock()
+
+	logger.Logf("Added new reaper with UUID: %s", newReaper.UUID)
+	manager.saveState()
+	return nil
+}
+
+// AddReaperFromConfig adds a reaper to the manager from a ReaperConfig.
+func (manager *ReaperManager) AddReaperFromConfig(newReaperConfig *reaperconfig.ReaperConfig) error {
+	newReaper := reaper.NewReaper()
+	if err := newReaper.UpdateReaperConfig(newReaperConfig); err != nil {
+		return fmt.Errorf("error adding reaper: %v", err)
+	}
+	return manager.AddReaper(newReaper)
+}
+
+// DeleteReaper deletes the reaper with the given UUID, and cancels its run if it is running.
+// Once the run stopped, the lifecycle rules the reaper applied to buckets are removed.
+func (manager *ReaperManager) DeleteReaper(uuid string) error {
+	manager.mu.Lock()
+	var deleted *managedReaper
+	for idx, managed := range manager.reapers {
+		if managed.uuid == uuid {
+			manager.unscheduleReaper(managed)
+			manager.reapers = append(manager.reapers[:idx], manager.reapers[idx+1:]...)
+			deleted = managed
+			break
 		}
-		time.Sleep(time.Second)
 	}
+	manager.mu.Unlock()
+	if deleted == nil {
+		return fmt.Errorf("Reaper with UUID %s does not exist", uuid)
+	}
+
+	deleted.running <- struct{}{}
+	deleted.reaper.RemoveLifecycleRules(manager.ctx, manager.clientOptions...)
+	<-deleted.running
+
+	logger.Logf("Reaper with UUID %s successfully deleted", uuid)
+	manager.saveState()
+	return nil
 }
 
-// sweep handles the logic for a single sweep of all the reapers monitored
-// by the manager. Note that this does not handle top-levek manager operations
-// such as a shutdown.
-func (manager *ReaperManager) sweepReapers() {
+// UpdateReaper updates the reaper with the UUID given in the config. If the reaper is
+// running, the update waits for the run to finish, so that a reaper never changes in the
+// middle of a run.
+func (manager *ReaperManager) UpdateReaper(config *reaperconfig.ReaperConfig) error {
+	if err := reaper.NewReaper().UpdateReaperConfig(config); err != nil {
+		return fmt.Errorf("error updating reaper: %v", err)
+	}
+
+	manager.mu.Lock()
+	managed := manager.findReaper(config.GetUuid())
+	manager.mu.Unlock()
+	if managed == nil {
+		return fmt.Errorf("Reaper with UUID %s does not exist", config.GetUuid())
+	}
+
+	managed.running <- struct{}{}
+	defer func() { <-managed.running }()
+	manager.mu.Lock()
+	if manager.findReaper(config.GetUuid()) != managed {
+		manager.mu.Unlock()
+		return fmt.Errorf("Reaper with UUID %s does not exist", config.GetUuid())
+	}
+	err := managed.reaper.UpdateReaperConfig(config)
+	manager.snapshot(managed)
+	manager.unscheduleReaper(managed)
+	manager.scheduleReaper(managed)
+	manager.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	logger.Logf("Reaper with UUID %s successfully updated", config.GetUuid())
+	manager.saveState()
+	return nil
+}
+
+// WithReaper calls the given function with the reaper with the given UUID, once the reaper
+// is not running, and returns the function's error. If the given context is cancelled while
+// waiting for a run to finish, the context's error is returned instead. The status of the
+// reaper is updated with any change the function made.
+func (manager *ReaperManager) WithReaper(ctx context.Context, uuid string, withReaper func(*reaper.Reaper) error) error {
+	manager.mu.Lock()
+	managed := manager.findReaper(uuid)
+	manager.mu.Unlock()
+	if managed == nil {
+		return fmt.Errorf("Reaper with UUID %s does not exist", uuid)
+	}
+
 	select {
-	case newReaper := <-manager.newReaper:
-		manager.Reapers = append(manager.Reapers, newReaper)
-		logger.Logf("Added new reaper with UUID: %s", newReaper.UUID)
-	case reaperUUID := <-manager.deleteReaper:
-		deleteSuccess := manager.handleDeleteReaper(reaperUUID)
-		if deleteSuccess {
-			logger.Logf("Reaper with UUID %s successfully deleted", reaperUUID)
-		} else {
-			logger.Logf("Reaper with UUID %s does not exist", reaperUUID)
-		}
-	case newReaperConfig := <-manager.updateReaper:
-		err := manager.handleUpdateReaper(newReaperConfig)
-		if err != nil {
-			logger.Error(err)
-		}
-		logger.Logf("Reaper with UUID %s successfully updated", newReaperConfig.Uuid)
-	default:
-		for _, reaper := range manager.Reapers {
-			reaper.RunOnSchedule(manager.ctx, manager.clientOptions...)
+	case managed.running <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-managed.running }()
+	err := withReaper(managed.reaper)
+	manager.mu.Lock()
+	manager.snapshot(managed)
+	manager.mu.Unlock()
+	return err
+}
+
+// GetDryRunReport returns the dry run report of the reaper with the given UUID, as of the
+// end of its last run. It does not wait for a run in progress to finish.
+func (manager *ReaperManager) GetDryRunReport(uuid string) (*reaperconfig.DryRunReport, error) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	managed := manager.findReaper(uuid)
+	if managed == nil {
+		return nil, fmt.Errorf("Reaper with UUID %s does not exist", uuid)
+	}
+	return managed.dryRunReport, nil
+}
+
+// RunReaper runs the reaper with the given UUID right away, regardless of its schedule, and
+// returns the summary of its sweep. If the reaper is already running, the run waits for that
+// run to finish, unless the given context is cancelled first. Cancelling the given context,
+// deleting the reaper, or shutting down the manager cancels the run.
+func (manager *ReaperManager) RunReaper(ctx context.Context, uuid string) (*reaperconfig.SweepSummary, error) {
+	manager.mu.Lock()
+	managed := manager.findReaper(uuid)
+	manager.mu.Unlock()
+	if managed == nil {
+		return nil, fmt.Errorf("Reaper with UUID %s does not exist", uuid)
+	}
+
+	select {
+	case managed.running <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	manager.mu.Lock()
+	reaperCtx := managed.ctx
+	if manager.findReaper(uuid) != managed || !managed.scheduled {
+		manager.mu.Unlock()
+		<-managed.running
+		return nil, fmt.Errorf("Reaper with UUID %s does not exist", uuid)
+	}
+	manager.mu.Unlock()
+
+	// The run is cancelled along with either the reaper's context or the given context.
+	runCtx, cancel := context.WithCancel(reaperCtx)
+	defer cancel()
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-runCtx.Done():
 		}
+	}()
+
+	manager.applyPause(managed)
+	managed.reaper.Run(runCtx, manager.clientOptions...)
+	summary := managed.reaper.LastSweepReport()
+	deletions := managed.reaper.LastDeletions()
+	manager.mu.Lock()
+	manager.snapshot(managed)
+	manager.mu.Unlock()
+	<-managed.running
+	manager.recordDeletions(deletions)
+	manager.saveState()
+
+	if err := runCtx.Err(); err != nil {
+		return nil, fmt.Errorf("run of reaper with UUID %s was cancelled: %v", uuid, err)
 	}
+	return summary, nil
 }
 
-// AddReaper adds a reaper to the manager.
-func (manager *ReaperManager) AddReaper(newReaper *reaper.Reaper) {
-	manager.newReaper <- newReaper
+// PauseReaper pauses the reaper with the given UUID. A paused reaper still lists its resources
+// on its schedule, but only reports what it would have deleted. A sweep that is in progress
+// stops before its next delete, and the resources it did not get to stay on its watchlist.
+func (manager *ReaperManager) PauseReaper(uuid string) error {
+	return manager.setReaperPaused(uuid, true)
 }
 
-// AddReaperFromConfig adds a reaper to the manager from a ReaperConfig.
-func (manager *ReaperManager) AddReaperFromConfig(newReaperConfig *reaperconfig.ReaperConfig) {
-	newReaper := reaper.NewReaper()
-	err := newReaper.UpdateReaperConfig(newReaperConfig)
-	if err != nil {
-		logger.Error(fmt.Errorf("error adding reaper: %v\n", err))
-		return
+// ResumeReaper resumes the reaper with the given UUID. The reaper stays paused while the
+// manager is paused.
+func (manager *ReaperManager) ResumeReaper(uuid string) error {
+	return manager.setReaperPaused(uuid, false)
+}
+
+func (manager *ReaperManager) setReaperPaused(uuid string, paused bool) error {
+	manager.mu.Lock()
+	managed := manager.findReaper(uuid)
+	if managed == nil {
+		manager.mu.Unlock()
+		return fmt.Errorf("Reaper with UUID %s does not exist", uuid)
+	}
+	managed.paused = paused
+	// A run in progress stops before its next delete once the reaper is paused.
+	managed.reaper.SetPaused(managed.paused || manager.paused)
+	// The saved state may be in the middle of a save, so it is replaced rather than changed.
+	pausedState := proto.Clone(managed.state).(*reaperconfig.ReaperState)
+	pausedState.Paused = paused
+	managed.state = pausedState
+	manager.mu.Unlock()
+
+	if paused {
+		logger.Logf("Reaper with UUID %s paused", uuid)
+	} else {
+		logger.Logf("Reaper with UUID %s resumed", uuid)
 	}
-	manager.newReaper <- newReaper
+	manager.saveState()
+	return nil
 }
 
-// DeleteReaper sends a signal to delete a reaper with the given UUID.
-func (manager *ReaperManager) DeleteReaper(uuid string) {
-	manager.deleteReaper <- uuid
+// setConfigFile records the name of the config file that configures the reaper with the
+// given UUID, so that the reaper can be deleted if the file is removed while the manager
+// is not running.
+func (manager *ReaperManager) setConfigFile(uuid, configFile string) error {
+	manager.mu.Lock()
+	managed := manager.findReaper(uuid)
+	if managed == nil {
+		manager.mu.Unlock()
+		return fmt.Errorf("Reaper with UUID %s does not exist", uuid)
+	}
+	if managed.configFile == configFile {
+		manager.mu.Unlock()
+		return nil
+	}
+	managed.configFile = configFile
+	// The saved state may be in the middle of a save, so it is replaced rather than changed.
+	configFileState := proto.Clone(managed.state).(*reaperconfig.ReaperState)
+	configFileState.ConfigFile = configFile
+	managed.state = configFileState
+	manager.mu.Unlock()
+
+	manager.saveState()
+	return nil
+}
+
+// configFiles returns the UUIDs of the reapers configured by config files, by the name of
+// their config file.
+func (manager *ReaperManager) configFiles() map[string]string {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	configFiles := make(map[string]string)
+	for _, managed := range manager.reapers {
+		if len(managed.configFile) > 0 {
+			configFiles[managed.configFile] = managed.uuid
+		}
+	}
+	return configFiles
+}
+
+// PauseAll pauses all reapers, including the reapers added while the manager is paused.
+func (manager *ReaperManager) PauseAll() {
+	manager.setPaused(true)
 }
 
-// UpdateReaper sends a signal to update a reaper with UUID given in the config.
-func (manager *ReaperManager) UpdateReaper(config *reaperconfig.ReaperConfig) {
-	manager.updateReaper <- config
+// ResumeAll resumes all reapers, other than the reapers that are paused on their own.
+func (manager *ReaperManager) ResumeAll() {
+	manager.setPaused(false)
+}
+
+func (manager *ReaperManager) setPaused(paused bool) {
+	manager.mu.Lock()
+	manager.paused = paused
+	for _, managed := range manager.reapers {
+		managed.reaper.SetPaused(managed.paused || manager.paused)
+	}
+	manager.mu.Unlock()
+
+	if paused {
+		logger.Log("All reapers paused")
+	} else {
+		logger.Log("All reapers resumed")
+	}
+	manager.saveState()
+}
+
+// IsPaused returns whether the reaper with the given UUID is paused, either on its own or
+// because the manager is paused.
+func (manager *ReaperManager) IsPaused(uuid string) (bool, error) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	managed := manager.findReaper(uuid)
+	if managed == nil {
+		return false, fmt.Errorf("Reaper with UUID %s does not exist", uuid)
+	}
+	return managed.paused || manager.paused, nil
 }
 
 // Shutdown ends the reaper manager process.
@@ -128,42 +405,116 @@ func (manager *ReaperManager) Shutdown() {
 	manager.quit <- true
 }
 
-// handleDeleteReaper deletes the reaper with the given UUID, and returns whether the delete
-// was successful. Note that false is returned if no reaper exists with the given UUID.
-func (manager *ReaperManager) handleDeleteReaper(uuid string) bool {
-	for idx, watchedReaper := range manager.Reapers {
-		if strings.Compare(watchedReaper.UUID, uuid) == 0 {
-			watchedReaper = nil
-			manager.Reapers = append(manager.Reapers[:idx], manager.Reapers[idx+1:]...)
-			return true
+// LoadState adds the reapers persisted in the given store to the manager, and from then on
+// saves the state of the manager's reapers to the store whenever it changes.
+func (manager *ReaperManager) LoadState(store state.Store) error {
+	managerState, err := store.Load(manager.ctx)
+	if err != nil {
+		return err
+	}
+	manager.mu.Lock()
+	manager.paused = manager.paused || managerState.GetPaused()
+	for _, reaperState := range managerState.GetReapers() {
+		restoredReaper, err := reaper.NewReaperFromState(reaperState)
+		if err != nil {
+			logger.Error(err)
+			continue
+		}
+		if manager.findReaper(restoredReaper.UUID) != nil {
+			logger.Logf("Reaper with UUID %s is already running, and was not restored", restoredReaper.UUID)
+			continue
 		}
+		manager.addManagedReaper(restoredReaper, reaperState.GetPaused(), reaperState.GetConfigFile())
+		logger.Logf("Restored reaper with UUID: %s", restoredReaper.UUID)
 	}
-	return false
+	manager.mu.Unlock()
+
+	manager.saveMu.Lock()
+	manager.store = store
+	manager.saveMu.Unlock()
+	return nil
 }
 
-// handleUpdateReaper updates the reaper with the given UUID from the config, and returns
-// whether the update was successful.
-func (manager *ReaperManager) handleUpdateReaper(config *reaperconfig.ReaperConfig) error {
-	for _, watchedReaper := range manager.Reapers {
-		if strings.Compare(watchedReaper.UUID, config.GetUuid()) == 0 {
-			err := watchedReaper.UpdateReaperConfig(config)
-			return err
-		}
+// saveState saves the state of all of the manager's reapers to the manager's store, if it
+// has one. Failing to save is logged, and the state is saved again on the next change.
+func (manager *ReaperManager) saveState() {
+	manager.saveMu.Lock()
+	defer manager.saveMu.Unlock()
+	if manager.store == nil {
+		return
+	}
+
+	manager.mu.Lock()
+	managerState := &reaperconfig.ManagerState{Paused: manager.paused}
+	for _, managed := range manager.reapers {
+		managerState.Reapers = append(managerState.Reapers, managed.state)
+	}
+	manager.mu.Unlock()
+	if err := manager.store.Save(manager.ctx, managerState); err != nil {
+		logger.Error(fmt.Errorf("saving reaper manager state failed with the following error: %s", err.Error()))
 	}
-	return fmt.Errorf("Reaper with UUID %s does not exist", config.GetUuid())
 }
 
 // ListReapers returns a list of reapers being managed by the ReaperManager.
 func (manager *ReaperManager) ListReapers() []*reaper.Reaper {
-	return manager.Reapers
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	reapers := make([]*reaper.Reaper, 0, len(manager.reapers))
+	for _, managed := range manager.reapers {
+		reapers = append(reapers, managed.reaper)
+	}
+	return reapers
+}
+
+// ListReaperUUIDs returns the UUIDs of the reapers being managed by the ReaperManager.
+func (manager *ReaperManager) ListReaperUUIDs() []string {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	uuids := make([]string, 0, len(manager.reapers))
+	for _, managed := range manager.reapers {
+		uuids = append(uuids, managed.uuid)
+	}
+	return uuids
 }
 
 // GetReaper returns the reaper with the given UUID, or returns nil
 // if no such reaper exists.
 func (manager *ReaperManager) GetReaper(uuid string) *reaper.Reaper {
-	for _, watchedReaper := range manager.Reapers {
-		if strings.Compare(watchedReaper.UUID, uuid) == 0 {
-			return watchedReaper
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	if managed := manager.findReaper(uuid); managed != nil {
+		return managed.reaper
+	}
+	return nil
+}
+
+// GetReaperStatus returns the config and status of the reaper with the given UUID, as of
+// the end of its last run or change. It does not wait for a run in progress to finish.
+func (manager *ReaperManager) GetReaperStatus(uuid string) (*reaperconfig.ReaperStatus, error) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	managed := manager.findReaper(uuid)
+	if managed == nil {
+		return nil, fmt.Errorf("Reaper with UUID %s does not exist", uuid)
+	}
+	status := proto.Clone(managed.status).(*reaperconfig.ReaperStatus)
+	status.Paused = managed.paused || manager.paused
+	if managed.reaper.Schedule != nil {
+		nextRun, err := ptypes.TimestampProto(managed.reaper.NextRun())
+		if err != nil {
+			return nil, fmt.Errorf("getting the next run of reaper %s failed with the following error: %s", uuid, err.Error())
+		}
+		status.NextRun = nextRun
+	}
+	return status, nil
+}
+
+// findReaper returns the managed reaper with the given UUID, or nil if no such reaper
+// exists. The caller must hold the manager's lock.
+func (manager *ReaperManager) findReaper(uuid string) *managedReaper {
+	for _, managed := range manager.reapers {
+		if managed.uuid == uuid {
+			return managed
 		}
 	}
 	return nil
@@ -16,15 +16,26 @@ package manager
 
 import (
 	"context"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
-	"reflect"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/logger"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/reaper"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/state"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/utils"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"github.com/robfig/cron/v3"
 	"google.golang.org/api/option"
 )
 
@@ -37,80 +48,540 @@ type OperationType int
 const (
 	Add    OperationType = 0
 	Delete OperationType = 1
-	Run    OperationType = 2
+	Update OperationType = 2
 )
 
-type SweepReapersTestCase struct {
-	Type   OperationType
-	Reaper *reaper.Reaper
-	UUID   string
+type ApplyOperationsTestCase struct {
+	Type          OperationType
+	Config        *reaperconfig.ReaperConfig
+	ExpectedError bool
 }
 
-var sweepReapersTestCases = []SweepReapersTestCase{
-	SweepReapersTestCase{Add, createTestReaper(reaper.NewReaperConfig(nil, "* * * * *", "testProject", "UUID_1")), ""},
-	SweepReapersTestCase{Delete, nil, "UUID"},
-	SweepReapersTestCase{Run, nil, ""},
+var applyOperationsTestCases = []ApplyOperationsTestCase{
+	ApplyOperationsTestCase{Add, reaper.NewReaperConfig(nil, "* * * * *", "testProject", "UUID_6"), false},
+	ApplyOperationsTestCase{Add, reaper.NewReaperConfig(nil, "* * * * *", "testProject", "UUID_1"), true},
+	ApplyOperationsTestCase{Add, reaper.NewReaperConfig(nil, "invalid schedule", "testProject", "UUID_6"), true},
+	ApplyOperationsTestCase{Update, reaper.NewReaperConfig(nil, "@every 1h", "testProject", "UUID_1"), false},
+	ApplyOperationsTestCase{Update, reaper.NewReaperConfig(nil, "@every 1h", "testProject", "UUID_6"), true},
+	ApplyOperationsTestCase{Update, reaper.NewReaperConfig(nil, "invalid schedule", "testProject", "UUID_1"), true},
+	ApplyOperationsTestCase{Delete, reaper.NewReaperConfig(nil, "", "", "UUID_1"), false},
+	ApplyOperationsTestCase{Delete, reaper.NewReaperConfig(nil, "", "", "UUID_6"), true},
 }
 
-func TestMonitorReapers(t *testing.T) {
+func TestApplyOperations(t *testing.T) {
 	server := createServer(serverHandler)
 	defer server.Close()
 
 	testClientOptions := getTestClientOptions(server)
 
-	for _, testCase := range sweepReapersTestCases {
-		testManager := NewReaperManager(context.Background(), testClientOptions...)
+	for _, testCase := range applyOperationsTestCases {
+		testManager := newTestManager(testClientOptions...)
+		uuid := testCase.Config.GetUuid()
 
+		var err error
 		switch testCase.Type {
 		case Add:
-			testManager.AddReaper(testCase.Reaper)
-			if len(testManager.newReaper) == 0 {
-				t.Error("Reaper not added to channel")
-			}
-			testManager.sweepReapers()
-			if !testManager.isReaperMonitored(testCase.Reaper) {
+			err = testManager.AddReaperFromConfig(testCase.Config)
+			if err == nil && testManager.GetReaper(uuid) == nil {
 				t.Error("Reaper not added to monitored reapers")
 			}
+		case Update:
+			err = testManager.UpdateReaper(testCase.Config)
+			if err == nil && testManager.GetReaper(uuid).Schedule != cron.Every(time.Hour) {
+				t.Error("Reaper not updated")
+			}
 		case Delete:
-			testManager.DeleteReaper(testCase.UUID)
-			if len(testManager.deleteReaper) == 0 {
-				t.Error("Reaper to delete UUID not added to channel")
+			err = testManager.DeleteReaper(uuid)
+			if testManager.GetReaper(uuid) != nil {
+				t.Error("Reaper not deleted")
 			}
-			testManager.sweepReapers()
-		case Run:
-			if len(testManager.newReaper) > 0 || len(testManager.deleteReaper) > 0 || len(testManager.quit) > 0 {
-				t.Error("One of the manager channels is set")
+		}
+		if gotError := err != nil; gotError != testCase.ExpectedError {
+			t.Errorf("Expected error %v for %v of reaper %s, got %v", testCase.ExpectedError, testCase.Type, uuid, err)
+		}
+		for _, managed := range testManager.reapers {
+			if !managed.scheduled {
+				t.Errorf("Reaper with UUID %s not scheduled", managed.uuid)
+			}
+		}
+		testManager.stopReapers()
+	}
+}
+
+func TestConcurrentAddReaper(t *testing.T) {
+	testManager := NewReaperManager(context.Background())
+	defer testManager.stopReapers()
+
+	var added int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			config := reaper.NewReaperConfig(nil, "@every 1h", "testProject", "UUID_1")
+			if err := testManager.AddReaperFromConfig(config); err == nil {
+				atomic.AddInt32(&added, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if added != 1 {
+		t.Errorf("Expected exactly one add of the same UUID to succeed, got %d", added)
+	}
+	if reapers := testManager.ListReapers(); len(reapers) != 1 {
+		t.Errorf("Expected 1 reaper, got %d", len(reapers))
+	}
+}
+
+func TestConcurrentOperations(t *testing.T) {
+	testManager := NewReaperManager(context.Background())
+	go testManager.MonitorReapers()
+	defer testManager.Shutdown()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		uuid := fmt.Sprintf("UUID_%d", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := testManager.AddReaperFromConfig(reaper.NewReaperConfig(nil, "@every 1s", "testProject", uuid)); err != nil {
+				t.Error(err)
+			}
+			if err := testManager.UpdateReaper(reaper.NewReaperConfig(nil, "@every 1h", "testProject", uuid)); err != nil {
+				t.Error(err)
+			}
+			testManager.ListReaperUUIDs()
+			if err := testManager.WithReaper(context.Background(), uuid, func(*reaper.Reaper) error { return nil }); err != nil {
+				t.Error(err)
+			}
+			if err := testManager.DeleteReaper(uuid); err != nil {
+				t.Error(err)
+			}
+			if err := testManager.DeleteReaper(uuid); err == nil {
+				t.Errorf("Reaper with UUID %s deleted twice", uuid)
+			}
+		}()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, listedReaper := range testManager.ListReapers() {
+				testManager.GetReaper(listedReaper.UUID)
+			}
+		}()
+	}
+	wg.Wait()
+	if uuids := testManager.ListReaperUUIDs(); len(uuids) != 0 {
+		t.Errorf("Expected all reapers to be deleted, got %v", uuids)
+	}
+}
+
+func TestMonitorReapers(t *testing.T) {
+	var requests int32
+	server := createServer(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		serverHandler(w, req)
+	})
+	defer server.Close()
+
+	resources := []*reaperconfig.ResourceConfig{
+		reaper.NewResourceConfig(reaperconfig.ResourceType_GCE_VM, []string{"testZone"}, "test", "", "1h"),
+	}
+	testManager := NewReaperManager(context.Background(), getTestClientOptions(server)...)
+	testManager.AddReaper(createTestReaper(reaper.NewReaperConfig(resources, "@every 1s", "testProject", "UUID_1")))
+	done := make(chan bool)
+	go func() {
+		testManager.MonitorReapers()
+		done <- true
+	}()
+
+	time.Sleep(1500 * time.Millisecond)
+	testManager.Shutdown()
+	<-done
+	runs := atomic.LoadInt32(&requests)
+	if runs < 2 {
+		t.Errorf("Expected the reaper to run right away and on its schedule, got %d runs", runs)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if atomic.LoadInt32(&requests) != runs {
+		t.Error("Reaper ran after the manager was shut down")
+	}
+}
+
+func TestRunReaperSkipsOverlappingRuns(t *testing.T) {
+	var requests int32
+	server := createServer(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		serverHandler(w, req)
+	})
+	defer server.Close()
+
+	resources := []*reaperconfig.ResourceConfig{
+		reaper.NewResourceConfig(reaperconfig.ResourceType_GCE_VM, []string{"testZone"}, "test", "", "1h"),
+	}
+	testManager := NewReaperManager(context.Background(), getTestClientOptions(server)...)
+	ctx, cancel := context.WithCancel(context.Background())
+	managed := &managedReaper{
+		uuid:    "UUID_1",
+		reaper:  createTestReaper(reaper.NewReaperConfig(resources, "@every 1h", "testProject", "UUID_1")),
+		running: make(chan struct{}, 1),
+	}
+
+	managed.running <- struct{}{}
+	testManager.runReaper(ctx, managed, false)
+	if atomic.LoadInt32(&requests) != 0 {
+		t.Error("Reaper ran while it was already running")
+	}
+	<-managed.running
+	testManager.runReaper(ctx, managed, false)
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("Expected the reaper to run once, got %d list requests", requests)
+	}
+	cancel()
+	testManager.runReaper(ctx, managed, false)
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Error("Reaper ran after it was cancelled")
+	}
+}
+
+func TestRunReaper(t *testing.T) {
+	server := createServer(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet {
+			w.Write([]byte(`{"items": [{"name": "test-vm", "creationTimestamp": "2000-01-01T00:00:00Z"}]}`))
+			return
+		}
+		serverHandler(w, req)
+	})
+	defer server.Close()
+
+	resources := []*reaperconfig.ResourceConfig{
+		reaper.NewResourceConfig(reaperconfig.ResourceType_GCE_VM, []string{"testZone"}, "test", "", "1h"),
+	}
+	testManager := NewReaperManager(context.Background(), getTestClientOptions(server)...)
+	defer testManager.stopReapers()
+	testManager.AddReaperFromConfig(reaper.NewReaperConfig(resources, "@every 1h", "testProject", "UUID_1"))
+
+	summary, err := testManager.RunReaper(context.Background(), "UUID_1")
+	if err != nil {
+		t.Fatalf("RunReaper failed with the following error: %s", err.Error())
+	}
+	if summary.GetUuid() != "UUID_1" || summary.GetListed() != 1 || summary.GetDeleted() != 1 || summary.GetRunTime() == nil {
+		t.Errorf("Expected one listed and deleted resource, got %v", summary)
+	}
+	deletions, err := testManager.ListDeletions(&reaperconfig.ListDeletionsRequest{Uuid: "UUID_1"})
+	if err != nil || len(deletions.GetRecords()) == 0 {
+		t.Fatalf("Expected the deletion to be recorded, got %v and error %v", deletions, err)
+	}
+	for _, record := range deletions.GetRecords() {
+		if record.GetResource().GetName() != "test-vm" || record.GetOutcome() != reaperconfig.DeletionOutcome_DELETED || record.GetMatchedConfig().GetNameFilter() != "test" {
+			t.Errorf("Expected deletion of test-vm matched by its config, got %v", record)
+		}
+	}
+
+	if _, err := testManager.RunReaper(context.Background(), "UUID_2"); err == nil {
+		t.Error("Expected error running a reaper that does not exist")
+	}
+
+	testManager.mu.Lock()
+	managed := testManager.findReaper("UUID_1")
+	testManager.mu.Unlock()
+	managed.running <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := testManager.RunReaper(ctx, "UUID_1"); err == nil {
+		t.Error("Reaper ran while it was already running")
+	}
+	<-managed.running
+}
+
+func TestRunReaperCancelled(t *testing.T) {
+	var block int32
+	var deletes int32
+	blocked := make(chan struct{}, 1)
+	server := createServer(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet {
+			if atomic.LoadInt32(&block) == 1 {
+				select {
+				case blocked <- struct{}{}:
+				default:
+				}
+				select {
+				case <-req.Context().Done():
+				case <-time.After(5 * time.Second):
+				}
 			}
-			testManager.sweepReapers()
+			w.Write([]byte(`{"items": [{"name": "test-vm", "creationTimestamp": "2000-01-01T00:00:00Z"}]}`))
+			return
+		}
+		atomic.AddInt32(&deletes, 1)
+		serverHandler(w, req)
+	})
+	defer server.Close()
+
+	resources := []*reaperconfig.ResourceConfig{
+		reaper.NewResourceConfig(reaperconfig.ResourceType_GCE_VM, []string{"testZone"}, "test", "", "1h"),
+	}
+	testManager := NewReaperManager(context.Background(), getTestClientOptions(server)...)
+	defer testManager.stopReapers()
+	testManager.AddReaperFromConfig(reaper.NewReaperConfig(resources, "@every 1h", "testProject", "UUID_1"))
+	if _, err := testManager.RunReaper(context.Background(), "UUID_1"); err != nil {
+		t.Fatalf("RunReaper failed with the following error: %s", err.Error())
+	}
+
+	atomic.StoreInt32(&block, 1)
+	deletesBefore := atomic.LoadInt32(&deletes)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-blocked
+		cancel()
+	}()
+	start := time.Now()
+	if _, err := testManager.RunReaper(ctx, "UUID_1"); err == nil {
+		t.Error("Expected error when the run is cancelled")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Cancelled run took %v to return", elapsed)
+	}
+	if atomic.LoadInt32(&deletes) != deletesBefore {
+		t.Error("Reaper deleted resources after its run was cancelled")
+	}
+	if testManager.GetReaper("UUID_1") == nil {
+		t.Error("Cancelling a run should not delete the reaper")
+	}
+}
+
+func TestReaperAccessWhileRunning(t *testing.T) {
+	testManager := NewReaperManager(context.Background())
+	defer testManager.stopReapers()
+	testManager.AddReaper(createTestReaper(reaper.NewReaperConfig(nil, "@every 1h", "testProject", "UUID_1")))
+
+	testManager.mu.Lock()
+	managed := testManager.findReaper("UUID_1")
+	testManager.mu.Unlock()
+	managed.running <- struct{}{}
+	defer func() { <-managed.running }()
+
+	if report, err := testManager.GetDryRunReport("UUID_1"); err != nil || report.GetUuid() != "UUID_1" {
+		t.Errorf("Expected the dry run report of a running reaper, got %v and error %v", report, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := testManager.WithReaper(ctx, "UUID_1", func(*reaper.Reaper) error {
+		t.Error("Reaper changed while it was running")
+		return nil
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected waiting for a running reaper to stop with the context, got %v", err)
+	}
+}
+
+func TestGetReaperStatus(t *testing.T) {
+	server := createServer(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet {
+			w.Write([]byte(`{"items": [{"name": "test-vm", "creationTimestamp": "2000-01-01T00:00:00Z"}, {"name": "test-new", "creationTimestamp": "2100-01-01T00:00:00Z"}]}`))
+			return
+		}
+		serverHandler(w, req)
+	})
+	defer server.Close()
+
+	resources := []*reaperconfig.ResourceConfig{
+		reaper.NewResourceConfig(reaperconfig.ResourceType_GCE_VM, []string{"testZone"}, "test", "", "1h"),
+	}
+	config := reaper.NewReaperConfig(resources, "@every 1h", "testProject", "UUID_1")
+	testManager := NewReaperManager(context.Background(), getTestClientOptions(server)...)
+	defer testManager.stopReapers()
+	testManager.AddReaperFromConfig(config)
+	testManager.RunReaper(context.Background(), "UUID_1")
+	testManager.PauseReaper("UUID_1")
+
+	status, err := testManager.GetReaperStatus("UUID_1")
+	if err != nil {
+		t.Fatalf("GetReaperStatus failed with the following error: %s", err.Error())
+	}
+	if !proto.Equal(status.GetConfig(), config) {
+		t.Errorf("Expected config %v, got %v", config, status.GetConfig())
+	}
+	nextRun, _ := ptypes.Timestamp(status.GetNextRun())
+	if nextRun.Before(time.Now()) || nextRun.After(time.Now().Add(time.Hour)) {
+		t.Errorf("Expected next run within the hour, got %v", nextRun)
+	}
+	if status.GetLastRun() == nil || status.GetLastSweep().GetListed() != 2 || status.GetLastSweep().GetDeleted() != 1 {
+		t.Errorf("Expected last sweep to list 2 resources and delete 1, got %v", status.GetLastSweep())
+	}
+	if status.GetWatchlistSize() != 1 || !status.GetPaused() || status.GetTripped() {
+		t.Errorf("Expected paused reaper watching 1 resource, got %v", status)
+	}
+
+	if _, err := testManager.GetReaperStatus("UUID_2"); err == nil {
+		t.Error("Expected error getting the status of a reaper that does not exist")
+	}
+}
+
+func TestPauseReaper(t *testing.T) {
+	var deletes int32
+	server := createServer(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet {
+			w.Write([]byte(`{"items": [{"name": "test-vm", "creationTimestamp": "2000-01-01T00:00:00Z"}]}`))
+			return
+		}
+		atomic.AddInt32(&deletes, 1)
+		serverHandler(w, req)
+	})
+	defer server.Close()
+
+	tempDir, err := ioutil.TempDir("", "manager")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	store := state.NewFileStore(filepath.Join(tempDir, "state.json"))
+
+	resources := []*reaperconfig.ResourceConfig{
+		reaper.NewResourceConfig(reaperconfig.ResourceType_GCE_VM, []string{"testZone"}, "test", "", "1h"),
+	}
+	testManager := NewReaperManager(context.Background(), getTestClientOptions(server)...)
+	defer testManager.stopReapers()
+	testManager.LoadState(store)
+	testManager.PauseAll()
+	testManager.AddReaperFromConfig(reaper.NewReaperConfig(resources, "@every 1h", "testProject", "UUID_1"))
+
+	summary, err := testManager.RunReaper(context.Background(), "UUID_1")
+	if err != nil {
+		t.Fatalf("RunReaper failed with the following error: %s", err.Error())
+	}
+	if !summary.GetPaused() || summary.GetListed() != 1 || summary.GetDeleted() != 0 || atomic.LoadInt32(&deletes) != 0 {
+		t.Errorf("Expected paused reaper to list without deleting, got %v", summary)
+	}
+	report, err := testManager.GetDryRunReport("UUID_1")
+	if err != nil || len(report.GetResources()) != 1 {
+		t.Errorf("Expected paused reaper to report 1 resource it would have deleted, got %v and error %v", report, err)
+	}
+
+	testManager.PauseReaper("UUID_1")
+	testManager.ResumeAll()
+	if paused, _ := testManager.IsPaused("UUID_1"); !paused {
+		t.Error("Reaper paused on its own resumed with the manager")
+	}
+	testManager.RunReaper(context.Background(), "UUID_1")
+	if atomic.LoadInt32(&deletes) != 0 {
+		t.Error("Paused reaper deleted resources")
+	}
+
+	restartedManager := NewReaperManager(context.Background())
+	defer restartedManager.stopReapers()
+	restartedManager.LoadState(store)
+	if paused, _ := restartedManager.IsPaused("UUID_1"); !paused || restartedManager.paused {
+		t.Error("Pauses not restored after restarting the manager")
+	}
+
+	testManager.ResumeReaper("UUID_1")
+	summary, _ = testManager.RunReaper(context.Background(), "UUID_1")
+	if summary.GetPaused() || summary.GetDeleted() != 1 {
+		t.Errorf("Expected resumed reaper to delete, got %v", summary)
+	}
+	if err := testManager.PauseReaper("UUID_2"); err == nil {
+		t.Error("Expected error pausing a reaper that does not exist")
+	}
+}
+
+func TestPauseReaperDuringRun(t *testing.T) {
+	var deletes int32
+	var listOnce sync.Once
+	listing := make(chan bool)
+	paused := make(chan bool)
+	server := createServer(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet {
+			// The first run is paused while it lists its resources.
+			listOnce.Do(func() {
+				close(listing)
+				<-paused
+			})
+			w.Write([]byte(`{"items": [{"name": "test-vm", "creationTimestamp": "2000-01-01T00:00:00Z"}]}`))
+			return
 		}
+		atomic.AddInt32(&deletes, 1)
+		serverHandler(w, req)
+	})
+	defer server.Close()
+
+	resources := []*reaperconfig.ResourceConfig{
+		reaper.NewResourceConfig(reaperconfig.ResourceType_GCE_VM, []string{"testZone"}, "test", "", "1h"),
+	}
+	testManager := NewReaperManager(context.Background(), getTestClientOptions(server)...)
+	defer testManager.stopReapers()
+	testManager.AddReaperFromConfig(reaper.NewReaperConfig(resources, "@every 1h", "testProject", "UUID_1"))
+
+	<-listing
+	testManager.PauseReaper("UUID_1")
+	close(paused)
+
+	// The run waits for the paused run to finish.
+	summary, err := testManager.RunReaper(context.Background(), "UUID_1")
+	if err != nil {
+		t.Fatalf("RunReaper failed with the following error: %s", err.Error())
+	}
+	if !summary.GetPaused() || atomic.LoadInt32(&deletes) != 0 {
+		t.Errorf("Expected reaper paused during its run to stop deleting, got %v", summary)
+	}
+}
+
+func TestManagerStatePersisted(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "manager")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	store := state.NewFileStore(filepath.Join(tempDir, "state.json"))
+
+	testManager := NewReaperManager(context.Background())
+	defer testManager.stopReapers()
+	if err := testManager.LoadState(store); err != nil {
+		t.Fatalf("LoadState failed with the following error: %s", err.Error())
+	}
+	testManager.AddReaper(createTestReaper(reaper.NewReaperConfig(nil, "* * * * *", "testProject", "UUID_1")))
+
+	restartedManager := NewReaperManager(context.Background())
+	if err := restartedManager.LoadState(store); err != nil {
+		t.Fatalf("LoadState failed with the following error: %s", err.Error())
+	}
+	defer restartedManager.stopReapers()
+	if !areReaperListsEqual(restartedManager.ListReapers(), testManager.ListReapers()) {
+		t.Error("Reapers not restored after restarting the manager")
+	}
+
+	testManager.DeleteReaper("UUID_1")
+	restartedManager = NewReaperManager(context.Background())
+	restartedManager.LoadState(store)
+	if len(restartedManager.ListReapers()) != 0 {
+		t.Error("Deleted reaper restored after restarting the manager")
 	}
 }
 
-type HandleDeleteTestCase struct {
+type DeleteReaperTestCase struct {
 	UUID            string
 	ExpectedReapers []*reaper.Reaper
 	Expected        bool
 }
 
-var handleDeleteTestCases = []HandleDeleteTestCase{
-	HandleDeleteTestCase{"UUID_4", append(getTestReapers()[:3], getTestReapers()[4]), true},
-	HandleDeleteTestCase{"UUID_1", getTestReapers()[1:], true},
-	HandleDeleteTestCase{"UUID_3", append(getTestReapers()[:2], getTestReapers()[3:]...), true},
-	HandleDeleteTestCase{"UUID_6", getTestReapers(), false},
-	HandleDeleteTestCase{"", getTestReapers(), false},
+var deleteReaperTestCases = []DeleteReaperTestCase{
+	DeleteReaperTestCase{"UUID_4", append(getTestReapers()[:3], getTestReapers()[4]), true},
+	DeleteReaperTestCase{"UUID_1", getTestReapers()[1:], true},
+	DeleteReaperTestCase{"UUID_3", append(getTestReapers()[:2], getTestReapers()[3:]...), true},
+	DeleteReaperTestCase{"UUID_6", getTestReapers(), false},
+	DeleteReaperTestCase{"", getTestReapers(), false},
 }
 
-func TestHandleDeleteReaper(t *testing.T) {
-	testManager := &ReaperManager{}
-	for _, testCase := range handleDeleteTestCases {
-		testManager.Reapers = getTestReapers()
-		result := testManager.handleDeleteReaper(testCase.UUID)
+func TestDeleteReaper(t *testing.T) {
+	for _, testCase := range deleteReaperTestCases {
+		testManager := newTestManager()
+		result := testManager.DeleteReaper(testCase.UUID) == nil
 		if result != testCase.Expected {
-			t.Errorf("Error in handleDelete: expected %v, got %v", testCase.Expected, result)
+			t.Errorf("Error in DeleteReaper: expected %v, got %v", testCase.Expected, result)
 		}
-		if !areReaperListsEqual(testCase.ExpectedReapers, testManager.Reapers) {
+		if !areReaperListsEqual(testCase.ExpectedReapers, testManager.ListReapers()) {
 			t.Error("Reaper deletion not handled correctly my manager")
 		}
+		testManager.stopReapers()
 	}
 }
 
@@ -128,8 +599,8 @@ var getReaperTestCases = []GetReaperTestCase{
 }
 
 func TestGetReaper(t *testing.T) {
-	testManager := &ReaperManager{}
-	testManager.Reapers = getTestReapers()
+	testManager := newTestManager()
+	defer testManager.stopReapers()
 	for _, testCase := range getReaperTestCases {
 		result := testManager.GetReaper(testCase.UUID)
 		if result == nil && testCase.Expected != nil {
@@ -172,21 +643,21 @@ func areReaperListsEqual(reapersA, reapersB []*reaper.Reaper) bool {
 	return true
 }
 
-func (manager *ReaperManager) isReaperMonitored(testReaper *reaper.Reaper) bool {
-	for _, monitoredReaper := range manager.Reapers {
-		if reflect.DeepEqual(monitoredReaper, testReaper) {
-			return true
-		}
+// newTestManager returns a reaper manager with the test reapers.
+func newTestManager(clientOptions ...option.ClientOption) *ReaperManager {
+	testManager := NewReaperManager(context.Background(), clientOptions...)
+	for _, testReaper := range getTestReapers() {
+		testManager.AddReaper(testReaper)
 	}
-	return false
+	return testManager
 }
 
 func createServer(handler http.HandlerFunc) *httptest.Server {
-	return httptest.NewServer(http.HandlerFunc(handler))
+	return httptest.NewServer(utils.BatchHandler(handler))
 }
 
 func serverHandler(w http.ResponseWriter, req *http.Request) {
-	w.Write([]byte(`{"success": true}`))
+	w.Write([]byte(`{"success": true, "status": "DONE"}`))
 }
 
 func getTestClientOptions(server *httptest.Server) []option.ClientOption {
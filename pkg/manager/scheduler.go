@@ -0,0 +1,174 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"context"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/logger"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/reaper"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"github.com/robfig/cron/v3"
+)
+
+// managedReaper is a reaper run by the manager on its own schedule. Its fields other than
+// running are guarded by the manager's lock.
+type managedReaper struct {
+	uuid      string
+	reaper    *reaper.Reaper
+	scheduled bool
+	entryID   cron.EntryID
+	ctx       context.Context
+	cancel    context.CancelFunc
+	// running holds a token while the reaper runs or changes, so that a reaper never runs
+	// twice at once, and never changes in the middle of a run.
+	running chan struct{}
+	// paused is whether the reaper is paused on its own, regardless of whether the manager
+	// is paused.
+	paused bool
+	// state is the state of the reaper as of the end of its last run or change, which is
+	// saved to the manager's store.
+	state *reaperconfig.ReaperState
+	// status is the status of the reaper as of the end of its last run or change.
+	status *reaperconfig.ReaperStatus
+	// dryRunReport is the dry run report of the reaper as of the end of its last run.
+	dryRunReport *reaperconfig.DryRunReport
+	// configFile is the name of the file in the config directory that configures the reaper,
+	// or empty if the reaper was not added from a config file.
+	configFile string
+}
+
+// addManagedReaper adds the reaper to the managed reapers, paused or not, along with the
+// name of its config file, if any, and schedules it. The caller must hold the manager's lock.
+func (manager *ReaperManager) addManagedReaper(newReaper *reaper.Reaper, paused bool, configFile string) {
+	managed := &managedReaper{
+		uuid:       newReaper.UUID,
+		reaper:     newReaper,
+		running:    make(chan struct{}, 1),
+		paused:     paused,
+		configFile: configFile,
+	}
+	manager.snapshot(managed)
+	manager.reapers = append(manager.reapers, managed)
+	manager.scheduleReaper(managed)
+}
+
+// scheduleReaper adds the reaper to the manager's scheduler, so that it runs on its schedule
+// until it is unscheduled. If the reaper is already due to run, such as a reaper that never
+// ran, it also starts a run right away. The caller must hold the manager's lock.
+func (manager *ReaperManager) scheduleReaper(managed *managedReaper) {
+	if managed.reaper.Schedule == nil {
+		logger.Logf("Reaper with UUID %s has no valid schedule, and will not run", managed.uuid)
+		return
+	}
+	ctx, cancel := context.WithCancel(manager.ctx)
+	managed.ctx = ctx
+	managed.cancel = cancel
+	managed.entryID = manager.scheduler.Schedule(managed.reaper.Schedule, cron.FuncJob(func() {
+		manager.runReaper(ctx, managed, false)
+	}))
+	managed.scheduled = true
+
+	manager.runs.Add(1)
+	go func() {
+		defer manager.runs.Done()
+		manager.runReaper(ctx, managed, true)
+	}()
+}
+
+// unscheduleReaper removes the reaper from the scheduler, and cancels its context, which
+// stops its current run. The caller must hold the manager's lock.
+func (manager *ReaperManager) unscheduleReaper(managed *managedReaper) {
+	if !managed.scheduled {
+		return
+	}
+	manager.scheduler.Remove(managed.entryID)
+	managed.cancel()
+	managed.scheduled = false
+}
+
+// runReaper runs the reaper with the given context, unless the context is cancelled. Runs
+// started by the scheduler are skipped if the reaper is already running. Catch up runs wait
+// for the reaper to be free, and only run if the reaper is due. The deletions attempted are
+// recorded in the deletion history, and the manager's state is saved after each run.
+func (manager *ReaperManager) runReaper(ctx context.Context, managed *managedReaper, catchUp bool) {
+	if catchUp {
+		select {
+		case managed.running <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+	} else {
+		select {
+		case managed.running <- struct{}{}:
+		default:
+			logger.Logf("Reaper with UUID %s is still running, skipping this run", managed.uuid)
+			return
+		}
+	}
+	if ctx.Err() != nil {
+		<-managed.running
+		return
+	}
+	manager.applyPause(managed)
+
+	if catchUp {
+		if !managed.reaper.RunOnSchedule(ctx, manager.clientOptions...) {
+			<-managed.running
+			return
+		}
+	} else {
+		managed.reaper.Run(ctx, manager.clientOptions...)
+	}
+	deletions := managed.reaper.LastDeletions()
+	manager.mu.Lock()
+	manager.snapshot(managed)
+	manager.mu.Unlock()
+	<-managed.running
+	manager.recordDeletions(deletions)
+	manager.saveState()
+}
+
+// applyPause pauses the reaper if either it or the manager is paused, and resumes it
+// otherwise. The caller must hold the reaper's running token, and not the manager's lock.
+func (manager *ReaperManager) applyPause(managed *managedReaper) {
+	manager.mu.Lock()
+	paused := managed.paused || manager.paused
+	manager.mu.Unlock()
+	managed.reaper.SetPaused(paused)
+}
+
+// snapshot updates the saved state, the status and the dry run report of the reaper. The caller
+// must hold the manager's lock, and the reaper must not be running.
+func (manager *ReaperManager) snapshot(managed *managedReaper) {
+	managed.state = managed.reaper.State()
+	managed.state.Paused = managed.paused
+	managed.state.ConfigFile = managed.configFile
+	managed.status = managed.reaper.Status()
+	managed.dryRunReport = managed.reaper.DryRunReport()
+}
+
+// stopReapers stops the scheduler and cancels all reapers, and waits for the reapers that
+// are running to finish.
+func (manager *ReaperManager) stopReapers() {
+	stopped := manager.scheduler.Stop()
+	manager.mu.Lock()
+	for _, managed := range manager.reapers {
+		manager.unscheduleReaper(managed)
+	}
+	manager.mu.Unlock()
+	<-stopped.Done()
+	manager.runs.Wait()
+}
@@ -0,0 +1,168 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+)
+
+// GetWatchlist returns the resources watched by the reaper with the UUID given in the request,
+// or by all reapers if no UUID is given, as of the end of each reaper's last run or change.
+// Only the resources matching all of the request's filters are returned, sorted as requested.
+func (manager *ReaperManager) GetWatchlist(req *reaperconfig.WatchlistRequest) (*reaperconfig.Watchlist, error) {
+	filter, err := newWatchlistFilter(req)
+	if err != nil {
+		return nil, err
+	}
+
+	watchlist := &reaperconfig.Watchlist{}
+	manager.mu.Lock()
+	if len(req.GetUuid()) > 0 && manager.findReaper(req.GetUuid()) == nil {
+		manager.mu.Unlock()
+		return nil, fmt.Errorf("Reaper with UUID %s does not exist", req.GetUuid())
+	}
+	for _, managed := range manager.reapers {
+		if len(req.GetUuid()) > 0 && managed.uuid != req.GetUuid() {
+			continue
+		}
+		for _, resource := range managed.state.GetWatchlist() {
+			if filter.matches(resource) {
+				watchlist.Entries = append(watchlist.Entries, &reaperconfig.WatchlistEntry{ReaperUuid: managed.uuid, Resource: resource})
+			}
+		}
+	}
+	manager.mu.Unlock()
+
+	sortWatchlist(watchlist.Entries, req.GetSortBy(), req.GetDescending())
+	return watchlist, nil
+}
+
+// watchlistFilter matches the watched resources that pass all of the filters of a
+// WatchlistRequest.
+type watchlistFilter struct {
+	req           *reaperconfig.WatchlistRequest
+	resourceTypes map[reaperconfig.ResourceType]bool
+	nameFilter    *regexp.Regexp
+}
+
+func newWatchlistFilter(req *reaperconfig.WatchlistRequest) (*watchlistFilter, error) {
+	filter := &watchlistFilter{req: req, resourceTypes: make(map[reaperconfig.ResourceType]bool)}
+	for _, resourceType := range req.GetResourceTypes() {
+		filter.resourceTypes[resourceType] = true
+	}
+	if len(req.GetNameFilter()) > 0 {
+		nameFilter, err := regexp.Compile(req.GetNameFilter())
+		if err != nil {
+			return nil, fmt.Errorf("invalid name filter %s: %v", req.GetNameFilter(), err)
+		}
+		filter.nameFilter = nameFilter
+	}
+	if req.GetDeletedBefore() != nil {
+		if _, err := ptypes.Timestamp(req.GetDeletedBefore()); err != nil {
+			return nil, fmt.Errorf("invalid deleted before time: %v", err)
+		}
+	}
+	return filter, nil
+}
+
+func (filter *watchlistFilter) matches(resource *reaperconfig.WatchedResource) bool {
+	if len(filter.resourceTypes) > 0 && !filter.resourceTypes[resource.GetResourceType()] {
+		return false
+	}
+	if len(filter.req.GetProjectId()) > 0 && resource.GetProjectId() != filter.req.GetProjectId() {
+		return false
+	}
+	if len(filter.req.GetZone()) > 0 && !strings.EqualFold(resource.GetZone(), filter.req.GetZone()) {
+		return false
+	}
+	if filter.nameFilter != nil && !filter.nameFilter.MatchString(resource.GetName()) {
+		return false
+	}
+	if filter.req.GetDeletedBefore() != nil {
+		// Resources with a TTL that could not be parsed have no deletion time, and are never
+		// deleted.
+		if resource.GetDeletionTime() == nil {
+			return false
+		}
+		deletionTime, _ := ptypes.Timestamp(resource.GetDeletionTime())
+		deletedBefore, _ := ptypes.Timestamp(filter.req.GetDeletedBefore())
+		if !deletionTime.Before(deletedBefore) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortWatchlist sorts the entries by the given field. Entries that are equal in that field
+// are sorted by reaper, type, zone and name, so that the order is deterministic. Resources
+// without a deletion time sort after all others when sorting by deletion time, in either
+// order.
+func sortWatchlist(entries []*reaperconfig.WatchlistEntry, sortBy reaperconfig.WatchlistSortField, descending bool) {
+	compare := func(a, b *reaperconfig.WatchedResource) int {
+		switch sortBy {
+		case reaperconfig.WatchlistSortField_TIME_CREATED:
+			return compareTimestamps(a.GetTimeCreated(), b.GetTimeCreated())
+		case reaperconfig.WatchlistSortField_NAME:
+			return strings.Compare(a.GetName(), b.GetName())
+		case reaperconfig.WatchlistSortField_TYPE:
+			return int(a.GetResourceType()) - int(b.GetResourceType())
+		case reaperconfig.WatchlistSortField_ZONE:
+			return strings.Compare(a.GetZone(), b.GetZone())
+		default:
+			return compareTimestamps(a.GetDeletionTime(), b.GetDeletionTime())
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i].GetResource(), entries[j].GetResource()
+		if sortBy == reaperconfig.WatchlistSortField_DELETION_TIME && (a.GetDeletionTime() == nil) != (b.GetDeletionTime() == nil) {
+			return b.GetDeletionTime() == nil
+		}
+		if result := compare(a, b); result != 0 {
+			return (result < 0) != descending
+		}
+		if entries[i].GetReaperUuid() != entries[j].GetReaperUuid() {
+			return entries[i].GetReaperUuid() < entries[j].GetReaperUuid()
+		}
+		if a.GetResourceType() != b.GetResourceType() {
+			return a.GetResourceType() < b.GetResourceType()
+		}
+		if a.GetZone() != b.GetZone() {
+			return a.GetZone() < b.GetZone()
+		}
+		return a.GetName() < b.GetName()
+	})
+}
+
+// compareTimestamps returns a negative number if a is before b, a positive number if a is
+// after b, and zero if they are equal.
+func compareTimestamps(a, b *timestamp.Timestamp) int {
+	timeA, _ := ptypes.Timestamp(a)
+	timeB, _ := ptypes.Timestamp(b)
+	switch {
+	case timeA.Before(timeB):
+		return -1
+	case timeA.After(timeB):
+		return 1
+	default:
+		return 0
+	}
+}
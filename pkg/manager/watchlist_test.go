@@ -0,0 +1,140 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/reaper"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+)
+
+var watchlistTime = time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+type GetWatchlistTestCase struct {
+	Request       *reaperconfig.WatchlistRequest
+	ExpectedNames []string
+	ExpectedError bool
+}
+
+var getWatchlistTestCases = []GetWatchlistTestCase{
+	GetWatchlistTestCase{
+		&reaperconfig.WatchlistRequest{},
+		[]string{"vm-a", "vm-c", "obj-b", "vm-d"},
+		false,
+	},
+	GetWatchlistTestCase{
+		&reaperconfig.WatchlistRequest{Uuid: "UUID_2"},
+		[]string{"vm-c", "vm-d"},
+		false,
+	},
+	GetWatchlistTestCase{
+		&reaperconfig.WatchlistRequest{ResourceTypes: []reaperconfig.ResourceType{reaperconfig.ResourceType_GCE_VM}, Descending: true},
+		[]string{"vm-c", "vm-a", "vm-d"},
+		false,
+	},
+	GetWatchlistTestCase{
+		&reaperconfig.WatchlistRequest{ProjectId: "project1", SortBy: reaperconfig.WatchlistSortField_NAME},
+		[]string{"obj-b", "vm-a"},
+		false,
+	},
+	GetWatchlistTestCase{
+		&reaperconfig.WatchlistRequest{Zone: "ZONE1"},
+		[]string{"vm-a"},
+		false,
+	},
+	GetWatchlistTestCase{
+		&reaperconfig.WatchlistRequest{NameFilter: "^vm-[cd]$", SortBy: reaperconfig.WatchlistSortField_TIME_CREATED},
+		[]string{"vm-d", "vm-c"},
+		false,
+	},
+	GetWatchlistTestCase{
+		&reaperconfig.WatchlistRequest{DeletedBefore: watchlistTimestamp(100 * time.Minute)},
+		[]string{"vm-a", "vm-c"},
+		false,
+	},
+	GetWatchlistTestCase{
+		&reaperconfig.WatchlistRequest{SortBy: reaperconfig.WatchlistSortField_ZONE, Descending: true},
+		[]string{"vm-c", "vm-d", "vm-a", "obj-b"},
+		false,
+	},
+	GetWatchlistTestCase{&reaperconfig.WatchlistRequest{Uuid: "UUID_3"}, nil, true},
+	GetWatchlistTestCase{&reaperconfig.WatchlistRequest{NameFilter: "["}, nil, true},
+}
+
+func TestGetWatchlist(t *testing.T) {
+	testManager := NewReaperManager(context.Background())
+	defer testManager.stopReapers()
+	addWatchlistReaper(t, testManager, "UUID_1",
+		watchlistResource("vm-a", "zone1", "project1", reaperconfig.ResourceType_GCE_VM, 0, "1h"),
+		watchlistResource("obj-b", "bucket", "project1", reaperconfig.ResourceType_GCS_OBJECT, -time.Hour, "3h"),
+	)
+	addWatchlistReaper(t, testManager, "UUID_2",
+		watchlistResource("vm-c", "zone2", "project2", reaperconfig.ResourceType_GCE_VM, time.Hour, "30m"),
+		watchlistResource("vm-d", "zone2", "project2", reaperconfig.ResourceType_GCE_VM, -2*time.Hour, "invalid"),
+	)
+
+	for _, testCase := range getWatchlistTestCases {
+		watchlist, err := testManager.GetWatchlist(testCase.Request)
+		if gotError := err != nil; gotError != testCase.ExpectedError {
+			t.Errorf("Expected error %v for request %v, got %v", testCase.ExpectedError, testCase.Request, err)
+			continue
+		}
+		var names []string
+		for _, entry := range watchlist.GetEntries() {
+			names = append(names, entry.GetResource().GetName())
+		}
+		if !reflect.DeepEqual(names, testCase.ExpectedNames) {
+			t.Errorf("Expected resources %v for request %v, got %v", testCase.ExpectedNames, testCase.Request, names)
+		}
+	}
+}
+
+// addWatchlistReaper adds a reaper watching the given resources that is not due to run.
+func addWatchlistReaper(t *testing.T, testManager *ReaperManager, uuid string, watchlist ...*reaperconfig.WatchedResource) {
+	lastRun, _ := ptypes.TimestampProto(time.Now())
+	testReaper, err := reaper.NewReaperFromState(&reaperconfig.ReaperState{
+		Config:    reaper.NewReaperConfig(nil, "@every 1h", "testProject", uuid),
+		LastRun:   lastRun,
+		Watchlist: watchlist,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testManager.AddReaper(testReaper); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func watchlistResource(name, zone, projectID string, resourceType reaperconfig.ResourceType, created time.Duration, ttl string) *reaperconfig.WatchedResource {
+	return &reaperconfig.WatchedResource{
+		Name:         name,
+		Zone:         zone,
+		ProjectId:    projectID,
+		ResourceType: resourceType,
+		TimeCreated:  watchlistTimestamp(created),
+		Ttl:          ttl,
+	}
+}
+
+func watchlistTimestamp(offset time.Duration) *timestamp.Timestamp {
+	instant, _ := ptypes.TimestampProto(watchlistTime.Add(offset))
+	return instant
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operations
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// An Operation is a long-running operation returned by a GCP API. Clients whose
+// API returns long-running operations implement this interface for them, so
+// that they can be waited on with a Poller.
+//  - Done returns whether the operation has finished, and the error it finished
+//    with, if any. It does not make any API calls.
+//  - Refresh gets the latest state of the operation from the API.
+//  - Name returns a name of the operation to use in errors.
+type Operation interface {
+	Done() (bool, error)
+	Refresh() error
+	Name() string
+}
+
+// DefaultPollInterval is how often a Poller refreshes an operation by default.
+const DefaultPollInterval = 2 * time.Second
+
+// DefaultTimeout is how long a Poller waits for an operation by default.
+const DefaultTimeout = 10 * time.Minute
+
+// A Poller waits for operations to be done by refreshing them at a fixed interval.
+type Poller struct {
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+// NewPoller constructs a Poller with the default interval and timeout.
+func NewPoller() *Poller {
+	return &Poller{Interval: DefaultPollInterval, Timeout: DefaultTimeout}
+}
+
+// Wait refreshes the operation until it is done, and returns the error the operation
+// finished with, if any. An error is also returned if refreshing the operation fails,
+// the poller times out, or the context is cancelled.
+func (poller *Poller) Wait(ctx context.Context, operation Operation) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, poller.Timeout)
+	defer cancel()
+
+	for {
+		if done, err := operation.Done(); done {
+			return err
+		}
+
+		timer := time.NewTimer(poller.Interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("waiting for operation %s failed with the following error: %w", operation.Name(), ctx.Err())
+		case <-timer.C:
+		}
+
+		if err := operation.Refresh(); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operations
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeOperation is an Operation that is done after a given number of refreshes.
+type fakeOperation struct {
+	refreshesUntilDone int
+	refreshes          int
+	err                error
+	refreshErr         error
+}
+
+func (op *fakeOperation) Done() (bool, error) {
+	if op.refreshes < op.refreshesUntilDone {
+		return false, nil
+	}
+	return true, op.err
+}
+
+func (op *fakeOperation) Refresh() error {
+	op.refreshes++
+	return op.refreshErr
+}
+
+func (op *fakeOperation) Name() string {
+	return "fakeOperation"
+}
+
+type WaitTestCase struct {
+	Operation         *fakeOperation
+	Timeout           time.Duration
+	ExpectedRefreshes int
+	ExpectError       bool
+}
+
+var waitTestCases = []WaitTestCase{
+	// Already done.
+	WaitTestCase{&fakeOperation{}, time.Second, 0, false},
+	// Done after polling.
+	WaitTestCase{&fakeOperation{refreshesUntilDone: 3}, time.Second, 3, false},
+	// Finished with an error.
+	WaitTestCase{&fakeOperation{refreshesUntilDone: 1, err: errors.New("failed")}, time.Second, 1, true},
+	// Refreshing failed.
+	WaitTestCase{&fakeOperation{refreshesUntilDone: 3, refreshErr: errors.New("failed")}, time.Second, 1, true},
+	// Timed out.
+	WaitTestCase{&fakeOperation{refreshesUntilDone: 1000000}, 20 * time.Millisecond, -1, true},
+}
+
+func TestWait(t *testing.T) {
+	for _, testCase := range waitTestCases {
+		poller := &Poller{Interval: time.Millisecond, Timeout: testCase.Timeout}
+		err := poller.Wait(context.Background(), testCase.Operation)
+		if (err != nil) != testCase.ExpectError {
+			t.Errorf("Wait returned error %v; expected error: %v", err, testCase.ExpectError)
+		}
+		if testCase.ExpectedRefreshes >= 0 && testCase.Operation.refreshes != testCase.ExpectedRefreshes {
+			t.Errorf("Operation refreshed %d times; want %d", testCase.Operation.refreshes, testCase.ExpectedRefreshes)
+		}
+	}
+}
+
+func TestWaitCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	poller := &Poller{Interval: time.Hour, Timeout: time.Hour}
+	if err := poller.Wait(ctx, &fakeOperation{refreshesUntilDone: 1}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected waiting with a cancelled context to fail with the context's error, got %v", err)
+	}
+}
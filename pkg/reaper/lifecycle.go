@@ -0,0 +1,200 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reaper
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/clients"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/clients/gcs"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/logger"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"google.golang.org/api/option"
+)
+
+// desiredLifecycleRules returns the lifecycle rules each bucket should have, from the
+// resource configs that use lifecycle rules.
+func (reaper *Reaper) desiredLifecycleRules() (map[string][]gcs.LifecycleRule, error) {
+	desiredRules := make(map[string][]gcs.LifecycleRule)
+	for _, resourceConfig := range reaper.config.GetResources() {
+		if !resourceConfig.GetUseLifecycleRules() {
+			continue
+		}
+		rules, err := gcs.LifecycleRulesFromConfig(resourceConfig)
+		if err != nil {
+			return nil, err
+		}
+		for _, bucket := range resourceConfig.GetZones() {
+			desiredRules[bucket] = append(desiredRules[bucket], rules...)
+		}
+	}
+	return desiredRules, nil
+}
+
+// reconcileLifecycleRules updates the lifecycle rules of the buckets managed through
+// lifecycle rules to match the ReaperConfig, and logs the drift that was found. Only the
+// rules the reaper applied itself are ever removed, including from buckets that are no
+// longer managed through lifecycle rules. In dry run mode, or while the reaper is paused,
+// the drift is only reported.
+func (reaper *Reaper) reconcileLifecycleRules(ctx context.Context, clientOptions ...option.ClientOption) {
+	desiredRules, err := reaper.desiredLifecycleRules()
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	apply := !reaper.config.GetDryRun() && !reaper.IsPaused()
+	reaper.lifecycleDrift = reaper.updateLifecycleRules(ctx, desiredRules, apply, clientOptions...)
+}
+
+// RemoveLifecycleRules removes all the lifecycle rules the reaper applied to buckets, and is
+// used when the reaper is deleted. Rules the reaper did not apply are left untouched.
+func (reaper *Reaper) RemoveLifecycleRules(ctx context.Context, clientOptions ...option.ClientOption) {
+	reaper.updateLifecycleRules(ctx, nil, true, clientOptions...)
+}
+
+// updateLifecycleRules reconciles the lifecycle rules of the buckets with desired rules, and of
+// the buckets the reaper previously applied rules to, and returns the drift found in each bucket.
+// The rules the reaper applied are kept track of, so that they can be removed once no longer
+// desired.
+func (reaper *Reaper) updateLifecycleRules(ctx context.Context, desiredRules map[string][]gcs.LifecycleRule, apply bool, clientOptions ...option.ClientOption) map[string]gcs.LifecycleDrift {
+	bucketSet := make(map[string]bool)
+	for bucket := range desiredRules {
+		bucketSet[bucket] = true
+	}
+	for bucket := range reaper.lifecycleRules {
+		bucketSet[bucket] = true
+	}
+	if len(bucketSet) == 0 {
+		return nil
+	}
+	var buckets []string
+	for bucket := range bucketSet {
+		buckets = append(buckets, bucket)
+	}
+	sort.Strings(buckets)
+
+	lifecycleClient := gcs.NewLifecycleClient()
+	clientOptions, err := clients.CredentialOptions(ctx, reaper.config.GetCredentials(), clientOptions...)
+	if err == nil {
+		err = lifecycleClient.Auth(ctx, clientOptions...)
+	}
+	if err != nil {
+		logger.Error(fmt.Errorf("GCS lifecycle client failed to authenticate with the following error: %s", err.Error()))
+		return nil
+	}
+
+	lifecycleDrift := make(map[string]gcs.LifecycleDrift)
+	if reaper.lifecycleRules == nil {
+		reaper.lifecycleRules = make(map[string][]gcs.LifecycleRule)
+	}
+	for _, bucket := range buckets {
+		drift, appliedRules, err := lifecycleClient.ReconcileLifecycleRules(
+			bucket, reaper.lifecycleRules[bucket], desiredRules[bucket], apply,
+		)
+		if len(appliedRules) > 0 {
+			reaper.lifecycleRules[bucket] = appliedRules
+		} else {
+			delete(reaper.lifecycleRules, bucket)
+		}
+		if err != nil {
+			logger.Error(fmt.Errorf(
+				"reconciling lifecycle rules of bucket %s failed with the following error: %s", bucket, err.Error(),
+			))
+			continue
+		}
+		if drift.IsEmpty() {
+			continue
+		}
+		lifecycleDrift[bucket] = drift
+		logger.Logf(
+			"Reaper %s found lifecycle rule drift in bucket %s, missing rules: %v, extra rules: %v\n",
+			reaper.UUID, bucket, drift.Missing, drift.Extra,
+		)
+		if apply {
+			logger.Logf("Reaper %s updated the lifecycle rules of bucket %s\n", reaper.UUID, bucket)
+		}
+	}
+	return lifecycleDrift
+}
+
+// lifecycleDriftProto converts the lifecycle rule drift of each bucket into its proto
+// representation, sorted by bucket.
+func lifecycleDriftProto(lifecycleDrift map[string]gcs.LifecycleDrift) []*reaperconfig.LifecycleDrift {
+	var buckets []string
+	for bucket := range lifecycleDrift {
+		buckets = append(buckets, bucket)
+	}
+	sort.Strings(buckets)
+
+	var driftProto []*reaperconfig.LifecycleDrift
+	for _, bucket := range buckets {
+		driftProto = append(driftProto, &reaperconfig.LifecycleDrift{
+			Bucket:  bucket,
+			Missing: lifecycleRuleProtos(lifecycleDrift[bucket].Missing),
+			Extra:   lifecycleRuleProtos(lifecycleDrift[bucket].Extra),
+		})
+	}
+	return driftProto
+}
+
+// lifecycleRuleProtos converts lifecycle rules into their proto representation.
+func lifecycleRuleProtos(rules []gcs.LifecycleRule) []*reaperconfig.LifecycleRule {
+	var rulesProto []*reaperconfig.LifecycleRule
+	for _, rule := range rules {
+		rulesProto = append(rulesProto, &reaperconfig.LifecycleRule{
+			AgeDays:  rule.AgeDays,
+			Prefixes: rule.Prefixes,
+			Suffixes: rule.Suffixes,
+		})
+	}
+	return rulesProto
+}
+
+// lifecycleRulesProto converts the lifecycle rules the reaper applied to each bucket into
+// their proto representation, sorted by bucket.
+func lifecycleRulesProto(appliedRules map[string][]gcs.LifecycleRule) []*reaperconfig.BucketLifecycleRules {
+	var buckets []string
+	for bucket := range appliedRules {
+		buckets = append(buckets, bucket)
+	}
+	sort.Strings(buckets)
+
+	var rulesProto []*reaperconfig.BucketLifecycleRules
+	for _, bucket := range buckets {
+		rulesProto = append(rulesProto, &reaperconfig.BucketLifecycleRules{
+			Bucket: bucket,
+			Rules:  lifecycleRuleProtos(appliedRules[bucket]),
+		})
+	}
+	return rulesProto
+}
+
+// lifecycleRulesFromProto converts the proto representation of the lifecycle rules the
+// reaper applied back into lifecycle rules by bucket.
+func lifecycleRulesFromProto(rulesProto []*reaperconfig.BucketLifecycleRules) map[string][]gcs.LifecycleRule {
+	appliedRules := make(map[string][]gcs.LifecycleRule)
+	for _, bucketRules := range rulesProto {
+		for _, rule := range bucketRules.GetRules() {
+			appliedRules[bucketRules.GetBucket()] = append(appliedRules[bucketRules.GetBucket()], gcs.LifecycleRule{
+				AgeDays:  rule.GetAgeDays(),
+				Prefixes: rule.GetPrefixes(),
+				Suffixes: rule.GetSuffixes(),
+			})
+		}
+	}
+	return appliedRules
+}
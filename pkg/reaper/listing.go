@@ -0,0 +1,178 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reaper
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/logger"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+)
+
+// maxConcurrentListings is the max number of list calls a reaper makes at once
+// when getting its resources.
+const maxConcurrentListings = 10
+
+// listTask is a single list call made while getting the reaper's resources. The
+// resources and error are set once the task is done.
+type listTask struct {
+	projectID string
+	config    *reaperconfig.ResourceConfig
+	resources []*resources.Resource
+	err       error
+}
+
+// newListTasks splits the resource configs into list tasks for each of the given projects.
+// Zonal resource types get one task per zone, so that zones are listed in parallel. GCS
+// Buckets are listed for the whole project at once, so they get a single task per config.
+// GCS Objects are listed by bucket and projects are listed by folder, and both are global,
+// so they are only listed in the first project. Configs that use lifecycle rules are not listed.
+func newListTasks(resourceConfigs []*reaperconfig.ResourceConfig, projectIDs []string) []*listTask {
+	var tasks []*listTask
+	if len(projectIDs) == 0 {
+		return tasks
+	}
+	for _, resourceConfig := range resourceConfigs {
+		if resourceConfig.GetUseLifecycleRules() {
+			continue
+		}
+		configProjectIDs := projectIDs
+		switch resourceConfig.GetResourceType() {
+		case reaperconfig.ResourceType_GCS_OBJECT, reaperconfig.ResourceType_PROJECT:
+			configProjectIDs = projectIDs[:1]
+		}
+		zones := resourceConfig.GetZones()
+		for _, projectID := range configProjectIDs {
+			if resourceConfig.GetResourceType() == reaperconfig.ResourceType_GCS_BUCKET || len(zones) <= 1 {
+				tasks = append(tasks, &listTask{projectID: projectID, config: resourceConfig})
+				continue
+			}
+			for _, zone := range zones {
+				zoneConfig := proto.Clone(resourceConfig).(*reaperconfig.ResourceConfig)
+				zoneConfig.Zones = []string{zone}
+				tasks = append(tasks, &listTask{projectID: projectID, config: zoneConfig})
+			}
+		}
+	}
+	return tasks
+}
+
+// runListTasks runs the given list tasks, with at most maxConcurrentListings running at
+// once, and returns once all tasks are done.
+func (reaper *Reaper) runListTasks(tasks []*listTask, resourceClients *clientCache) {
+	semaphore := make(chan struct{}, maxConcurrentListings)
+	var wg sync.WaitGroup
+	for _, task := range tasks {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(task *listTask) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			resourceClient, err := resourceClients.get(task.config.GetResourceType())
+			if err != nil {
+				task.err = err
+				return
+			}
+			task.resources, task.err = resourceClient.GetResources(task.projectID, task.config)
+		}(task)
+	}
+	wg.Wait()
+}
+
+// zoneErrors returns the errors of the task for each zone it failed to list. If the
+// client reported which zones failed, only those zones are returned, otherwise the
+// error applies to every zone of the task.
+func (task *listTask) zoneErrors() resources.ZoneErrors {
+	if task.err == nil {
+		return nil
+	}
+	if zoneErrors, isZoneErrors := task.err.(resources.ZoneErrors); isZoneErrors {
+		return zoneErrors
+	}
+	zoneErrors := make(resources.ZoneErrors)
+	for _, zone := range task.config.GetZones() {
+		zoneErrors[zone] = task.err
+	}
+	return zoneErrors
+}
+
+// A listingError is an error listing the resources of a type in a zone of a project, or
+// listing the projects under the ReaperConfig's project parent.
+type listingError struct {
+	projectID     string
+	resourceType  reaperconfig.ResourceType
+	zone          string
+	projectParent string
+	err           error
+}
+
+// key returns the key of the listing error, such as "my-project/GCE_VM/us-east1-b", or
+// the project parent, such as "folders/123".
+func (listingErr listingError) key() string {
+	if len(listingErr.projectParent) > 0 {
+		return listingErr.projectParent
+	}
+	return fmt.Sprintf("%s/%s/%s", listingErr.projectID, listingErr.resourceType.String(), listingErr.zone)
+}
+
+// ListingErrors returns the errors from the reaper's last time getting resources, keyed
+// by project, resource type and zone, such as "my-project/GCE_VM/us-east1-b". If the
+// projects under the ReaperConfig's project parent could not be listed, the error is
+// keyed by the parent, such as "folders/123".
+func (reaper *Reaper) ListingErrors() map[string]error {
+	listingErrors := make(map[string]error)
+	for key, listingErr := range reaper.listingErrors {
+		listingErrors[key] = listingErr.err
+	}
+	return listingErrors
+}
+
+// listingErrorsProto converts the reaper's listing errors into their proto representation,
+// sorted by key.
+func (reaper *Reaper) listingErrorsProto() []*reaperconfig.ListingError {
+	var keys []string
+	for key := range reaper.listingErrors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var listingErrors []*reaperconfig.ListingError
+	for _, key := range keys {
+		listingErr := reaper.listingErrors[key]
+		listingErrors = append(listingErrors, &reaperconfig.ListingError{
+			ProjectId:     listingErr.projectID,
+			ResourceType:  listingErr.resourceType,
+			Zone:          listingErr.zone,
+			ProjectParent: listingErr.projectParent,
+			Error:         listingErr.err.Error(),
+		})
+	}
+	return listingErrors
+}
+
+// logListingErrors logs the errors of a list task for each zone that failed.
+func logListingErrors(projectID string, resourceType reaperconfig.ResourceType, zoneErrors resources.ZoneErrors) {
+	for zone, err := range zoneErrors {
+		logger.Error(fmt.Errorf(
+			"%s client failed to get resources in zone %s of project %s with the following error: %s",
+			resourceType.String(), zone, projectID, err.Error(),
+		))
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reaper
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/clients"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/clients/resourcemanager"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/logger"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"google.golang.org/api/option"
+)
+
+// configuredProjects returns the projects listed in the ReaperConfig, which are the reaper's
+// project ID followed by the config's project IDs, without duplicates.
+func (reaper *Reaper) configuredProjects() []string {
+	var projectIDs []string
+	if len(reaper.ProjectID) > 0 {
+		projectIDs = append(projectIDs, reaper.ProjectID)
+	}
+	projectIDs = append(projectIDs, reaper.config.GetProjectIds()...)
+	return uniqueProjects(projectIDs)
+}
+
+// resolveProjects returns the projects the reaper watches, which are the configured projects
+// followed by the projects under the ReaperConfig's project parent. If the projects under the
+// parent can not be listed, the error is recorded in the listing errors under the parent, and
+// the projects the reaper watched before are kept.
+func (reaper *Reaper) resolveProjects(ctx context.Context, listingErrors map[string]listingError, clientOptions ...option.ClientOption) []string {
+	projectIDs := reaper.configuredProjects()
+	parent := reaper.config.GetProjectParent()
+	if len(parent) == 0 {
+		return projectIDs
+	}
+
+	resourceManagerClient := resourcemanager.NewResourceManagerClient()
+	clientOptions, err := clients.CredentialOptions(ctx, reaper.config.GetCredentials(), clientOptions...)
+	if err == nil {
+		err = resourceManagerClient.Auth(ctx, clientOptions...)
+	}
+	if err != nil {
+		err = fmt.Errorf("Resource Manager client failed to authenticate with the following error: %s", err.Error())
+	} else {
+		var parentProjectIDs []string
+		parentProjectIDs, err = resourceManagerClient.ListProjectIDs(parent)
+		if err == nil {
+			return uniqueProjects(append(projectIDs, parentProjectIDs...))
+		}
+	}
+	logger.Error(err)
+	listingErrors[parent] = listingError{projectParent: parent, err: err}
+	return uniqueProjects(append(projectIDs, reaper.ProjectIDs...))
+}
+
+// resourceProject returns the project of a resource, which is the reaper's project ID for
+// resources that do not carry their own project.
+func (reaper *Reaper) resourceProject(resource *resources.Resource) string {
+	if len(resource.ProjectID) > 0 {
+		return resource.ProjectID
+	}
+	return reaper.ProjectID
+}
+
+// uniqueProjects removes duplicate project IDs, keeping the first of each.
+func uniqueProjects(projectIDs []string) []string {
+	var uniqueProjectIDs []string
+	seen := make(map[string]bool)
+	for _, projectID := range projectIDs {
+		if !seen[projectID] {
+			seen[projectID] = true
+			uniqueProjectIDs = append(uniqueProjectIDs, projectID)
+		}
+	}
+	return uniqueProjectIDs
+}
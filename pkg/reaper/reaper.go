@@ -17,10 +17,17 @@ package reaper
 import (
 	"context"
 	"fmt"
+	"os"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/clients"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/clients/gcs"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/clients/resourcemanager"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/logger"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
@@ -28,19 +35,56 @@ import (
 	"google.golang.org/api/option"
 )
 
-// Reaper represents the resource reaper for a single GCP project. The reaper will
+// Reaper represents the resource reaper for one or more GCP projects. The reaper will
 // run on a given schedule defined in cron time format.
 type Reaper struct {
-	UUID      string
+	UUID string
+	// ProjectID is the project_id of the ReaperConfig. Resources that do not carry
+	// their own project are assumed to be in this project.
 	ProjectID string
-	Watchlist []*resources.WatchedResource
-	Schedule  cron.Schedule
-
-	config  *reaperconfig.ReaperConfig
-	lastRun time.Time
+	// ProjectIDs are all the projects the reaper watched the last time it got its
+	// resources, including the projects under the ReaperConfig's project parent.
+	ProjectIDs []string
+	Watchlist  []*resources.WatchedResource
+	Schedule   cron.Schedule
+
+	config           *reaperconfig.ReaperConfig
+	lastRun          time.Time
+	lastDryRun       *dryRun
+	lastSweep        SweepSummary
+	lastDeletions    []*reaperconfig.DeletionRecord
+	projectSweeps    map[string]SweepSummary
+	tripped          bool
+	limitsOverridden bool
+	paused           int32
+	gracePeriod      resources.TTL
+	retryPolicy      *clients.RetryPolicy
+	markedResources  map[string]bool
+	rescuedResources map[string]bool
+	listingErrors    map[string]listingError
+	lifecycleDrift   map[string]gcs.LifecycleDrift
+	lifecycleRules   map[string][]gcs.LifecycleRule
 	*Clock
 }
 
+// A SweepSummary counts what happened to the resources in the reaper's Watchlist
+// during a sweep.
+type SweepSummary struct {
+	// Listed resources were on the watchlist when the sweep started.
+	Listed  int
+	Deleted int
+	Marked  int
+	Failed  int
+	// Skipped resources were ready for deletion, but are protected from deletion.
+	Skipped int
+}
+
+// dryRun holds the resources a reaper in dry run mode would have deleted.
+type dryRun struct {
+	runTime   time.Time
+	resources []*resources.WatchedResource
+}
+
 type Clock struct {
 	instant time.Time
 }
@@ -69,115 +113,517 @@ func NewReaper() *Reaper {
 func (reaper *Reaper) RunOnSchedule(ctx context.Context, clientOptions ...option.ClientOption) bool {
 	nextRun := reaper.Schedule.Next(reaper.lastRun)
 	if reaper.lastRun.IsZero() || reaper.Clock.Now().After(nextRun) || reaper.Clock.Now().Equal(nextRun) {
-		logger.Logf("Running reaper with UUID: %s\n", reaper.UUID)
-		reaper.GetResources(ctx, clientOptions...)
-
-		logger.Logf("Reaper %s sweeping through the following resources: %s", reaper.UUID, reaper.WatchlistString())
-		reaper.SweepThroughResources(ctx, clientOptions...)
-		reaper.lastRun = reaper.Clock.Now()
+		reaper.Run(ctx, clientOptions...)
 		return true
 	}
 	return false
 }
 
+// Run updates the reaper's watchlist and runs a sweep, regardless of the reaper's schedule.
+func (reaper *Reaper) Run(ctx context.Context, clientOptions ...option.ClientOption) {
+	logger.Logf("Running reaper with UUID: %s\n", reaper.UUID)
+	reaper.GetResources(ctx, clientOptions...)
+
+	logger.Logf("Reaper %s sweeping through the following resources: %s", reaper.UUID, reaper.WatchlistString())
+	reaper.SweepThroughResources(ctx, clientOptions...)
+	reaper.lastRun = reaper.Clock.Now()
+}
+
 // SweepThroughResources goes through all the resources in the reaper's Watchlist, and for each resource
 // determines if it needs to be deleted. The necessary resources are deleted from GCP and the reaper's
-// Watchlist is updated accordingly.
+// Watchlist is updated accordingly. If the reaper is in dry run mode, the resources that would have been
+// deleted are recorded instead, and nothing is deleted. Paused reapers sweep as in dry run mode. If the
+// reaper has a grace period, resources past their TTL are first marked, and only deleted once the grace
+// period has passed since they were marked.
 func (reaper *Reaper) SweepThroughResources(ctx context.Context, clientOptions ...option.ClientOption) {
-	var updatedWatchlist []*resources.WatchedResource
+	listed := len(reaper.Watchlist)
+	reaper.lastSweep = SweepSummary{Listed: listed}
+	reaper.lastDeletions = nil
+	plan := reaper.planSweep()
+	if reaper.config.GetDryRun() || reaper.IsPaused() {
+		reaper.dryRunSweep(plan)
+		return
+	}
+	if !reaper.checkDeletionLimits(len(plan.toDelete)) {
+		return
+	}
 
-	for _, watchedResource := range reaper.Watchlist {
-		if watchedResource.IsReadyForDeletion() {
-			resourceClient, err := getAuthedClient(ctx, reaper, watchedResource.Type, clientOptions...)
-			if err != nil {
-				logger.Error(err)
-				continue
-			}
+	var tasks []*sweepTask
+	markedAt := reaper.Clock.Now()
+	for _, watchedResource := range plan.toMark {
+		tasks = append(tasks, &sweepTask{watchedResource: watchedResource, mark: true, markedAt: markedAt})
+	}
+	for _, watchedResource := range plan.toDelete {
+		tasks = append(tasks, &sweepTask{watchedResource: watchedResource})
+	}
+	reaper.runSweepTasks(ctx, tasks, newClientCache(ctx, reaper, clientOptions...))
+	if reaper.sweepStopped(ctx) {
+		logger.Logf("Reaper %s stopped its sweep before all resources were swept\n", reaper.UUID)
+	}
 
-			if err := resourceClient.DeleteResource(reaper.ProjectID, watchedResource.Resource); err != nil {
-				deleteError := fmt.Errorf(
-					"%s client failed to delete resource %s with the following error: %s",
-					watchedResource.Type.String(), watchedResource.Name, err.Error(),
-				)
-				logger.Error(deleteError)
-				continue
+	// The watchlist is only updated once all workers are done, so that it is never
+	// modified concurrently. Skipped resources, resources that failed to be deleted,
+	// and resources left over when the sweep was stopped, stay on the watchlist so
+	// that they are tried again on the next sweep.
+	// Each outcome is counted both in the summary of the sweep and in the summary
+	// of the resource's project.
+	summary := SweepSummary{Listed: listed}
+	projectSweeps := make(map[string]SweepSummary)
+	count := func(watchedResource *resources.WatchedResource, increment func(*SweepSummary)) {
+		increment(&summary)
+		projectID := reaper.resourceProject(watchedResource.Resource)
+		projectSweep := projectSweeps[projectID]
+		increment(&projectSweep)
+		projectSweeps[projectID] = projectSweep
+	}
+
+	var deletions []*reaperconfig.DeletionRecord
+	record := func(task *sweepTask, outcome reaperconfig.DeletionOutcome) {
+		deletions = append(deletions, reaper.deletionRecord(task, outcome))
+	}
+
+	updatedWatchlist := append(plan.toKeep, plan.toSkip...)
+	for _, watchedResource := range plan.toSkip {
+		count(watchedResource, func(summary *SweepSummary) { summary.Skipped++ })
+	}
+	for _, task := range tasks {
+		key := resourceKey(task.watchedResource.Resource)
+		switch {
+		case task.stopped:
+			updatedWatchlist = append(updatedWatchlist, task.watchedResource)
+		case task.skipped:
+			count(task.watchedResource, func(summary *SweepSummary) { summary.Skipped++ })
+			updatedWatchlist = append(updatedWatchlist, task.watchedResource)
+			if !task.mark {
+				record(task, reaperconfig.DeletionOutcome_SKIPPED)
 			}
+		case task.err != nil:
+			count(task.watchedResource, func(summary *SweepSummary) { summary.Failed++ })
+			updatedWatchlist = append(updatedWatchlist, task.watchedResource)
+			if !task.mark {
+				record(task, reaperconfig.DeletionOutcome_FAILED)
+			}
+		case task.mark:
+			count(task.watchedResource, func(summary *SweepSummary) { summary.Marked++ })
+			updatedWatchlist = append(updatedWatchlist, task.watchedResource)
+			reaper.markedResources[key] = true
+		default:
+			count(task.watchedResource, func(summary *SweepSummary) { summary.Deleted++ })
+			delete(reaper.markedResources, key)
+			record(task, reaperconfig.DeletionOutcome_DELETED)
+		}
+	}
+	reaper.Watchlist = updatedWatchlist
+	reaper.lastSweep = summary
+	reaper.lastDeletions = deletions
+	reaper.projectSweeps = projectSweeps
+}
+
+// LastSweep returns the summary of the reaper's last sweep.
+func (reaper *Reaper) LastSweep() SweepSummary {
+	return reaper.lastSweep
+}
+
+// LastDeletions returns a record of each deletion the reaper attempted during its last sweep.
+// Resources that were only marked for deletion are not included.
+func (reaper *Reaper) LastDeletions() []*reaperconfig.DeletionRecord {
+	return reaper.lastDeletions
+}
+
+// deletionRecord records the outcome of the given sweep task, attempted at the time the task's
+// delete finished.
+func (reaper *Reaper) deletionRecord(task *sweepTask, outcome reaperconfig.DeletionOutcome) *reaperconfig.DeletionRecord {
+	deletion := &reaperconfig.DeletionRecord{
+		ReaperUuid:    reaper.UUID,
+		Resource:      watchedResourceProto(task.watchedResource),
+		MatchedConfig: reaper.matchedConfig(task.watchedResource),
+		AttemptTime:   timestampProto(task.attemptedAt),
+		Outcome:       outcome,
+	}
+	deletion.Resource.ProjectId = reaper.resourceProject(task.watchedResource.Resource)
+	if task.err != nil {
+		deletion.Error = task.err.Error()
+	}
+	return deletion
+}
+
+// matchedConfig returns the ResourceConfig of the reaper that matched the watched resource.
+// If several configs match, the one whose TTL the resource is watched with is preferred.
+func (reaper *Reaper) matchedConfig(watchedResource *resources.WatchedResource) *reaperconfig.ResourceConfig {
+	var matched *reaperconfig.ResourceConfig
+	for _, resourceConfig := range reaper.config.GetResources() {
+		if resourceConfig.GetResourceType() != watchedResource.Type {
+			continue
+		}
+		if !resources.ShouldAddResourceToWatchlist(watchedResource.Resource, resourceConfig.GetNameFilter(), resourceConfig.GetSkipFilter()) {
+			continue
+		}
+		if !configHasZone(resourceConfig, watchedResource.Zone) {
+			continue
+		}
+		if resourceConfig.GetTtl() == watchedResource.TTL {
+			return resourceConfig
+		}
+		if matched == nil {
+			matched = resourceConfig
+		}
+	}
+	return matched
+}
+
+// configHasZone returns whether the resource config lists resources in the given zone. The
+// zones of buckets and projects are not the zones they were listed from, so they always match.
+func configHasZone(resourceConfig *reaperconfig.ResourceConfig, zone string) bool {
+	switch resourceConfig.GetResourceType() {
+	case reaperconfig.ResourceType_GCS_BUCKET, reaperconfig.ResourceType_PROJECT:
+		return true
+	}
+	for _, configZone := range resourceConfig.GetZones() {
+		if strings.EqualFold(configZone, zone) {
+			return true
+		}
+	}
+	return false
+}
+
+// LastSweepReport returns the summary of the reaper's last sweep as a proto, along with the
+// summary of each project and the errors listing the resources before the sweep.
+func (reaper *Reaper) LastSweepReport() *reaperconfig.SweepSummary {
+	report := &reaperconfig.SweepSummary{
+		Uuid:    reaper.UUID,
+		Listed:  uint32(reaper.lastSweep.Listed),
+		Deleted: uint32(reaper.lastSweep.Deleted),
+		Marked:  uint32(reaper.lastSweep.Marked),
+		Failed:  uint32(reaper.lastSweep.Failed),
+		Skipped: uint32(reaper.lastSweep.Skipped),
+		Paused:  reaper.IsPaused(),
+	}
+	if !reaper.lastRun.IsZero() {
+		report.RunTime = timestampProto(reaper.lastRun)
+	}
+	report.ListingErrors = reaper.listingErrorsProto()
+	var projectIDs []string
+	for projectID := range reaper.projectSweeps {
+		projectIDs = append(projectIDs, projectID)
+	}
+	sort.Strings(projectIDs)
+	for _, projectID := range projectIDs {
+		projectSweep := reaper.projectSweeps[projectID]
+		report.Projects = append(report.Projects, &reaperconfig.ProjectSweepSummary{
+			ProjectId: projectID,
+			Deleted:   uint32(projectSweep.Deleted),
+			Marked:    uint32(projectSweep.Marked),
+			Failed:    uint32(projectSweep.Failed),
+			Skipped:   uint32(projectSweep.Skipped),
+		})
+	}
+	return report
+}
+
+// LastSweepByProject returns the summary of the reaper's last sweep for each project that
+// had a resource deleted, marked, skipped or failed, keyed by project ID.
+func (reaper *Reaper) LastSweepByProject() map[string]SweepSummary {
+	return reaper.projectSweeps
+}
+
+// sweepPlan describes what a sweep will do with each resource in the reaper's Watchlist.
+type sweepPlan struct {
+	toKeep   []*resources.WatchedResource
+	toSkip   []*resources.WatchedResource
+	toMark   []*resources.WatchedResource
+	toDelete []*resources.WatchedResource
+}
+
+// planSweep determines which resources in the reaper's Watchlist should be kept, marked or
+// deleted. Without a grace period, every resource past its TTL is deleted. With a grace period,
+// a resource past its TTL is marked, and then deleted once the grace period has passed since it
+// was marked. A resource the reaper marked that no longer has the mark was rescued by its owner,
+// and is kept for as long as it is watched. A resource past its TTL that is protected from
+// deletion is skipped.
+func (reaper *Reaper) planSweep() *sweepPlan {
+	if reaper.markedResources == nil {
+		reaper.markedResources = make(map[string]bool)
+	}
+	if reaper.rescuedResources == nil {
+		reaper.rescuedResources = make(map[string]bool)
+	}
+	plan := &sweepPlan{}
+	watchedKeys := make(map[string]bool)
+	for _, watchedResource := range reaper.Watchlist {
+		key := resourceKey(watchedResource.Resource)
+		watchedKeys[key] = true
+		switch {
+		case !watchedResource.IsReadyForDeletion():
+			plan.toKeep = append(plan.toKeep, watchedResource)
+		case watchedResource.Protected:
 			logger.Logf(
-				"Deleted %s resource %s in zone %s\n",
+				"Skipping %s resource %s in zone %s, since it is protected from deletion\n",
 				watchedResource.Type.String(), watchedResource.Name, watchedResource.Zone,
 			)
-		} else {
-			updatedWatchlist = append(updatedWatchlist, watchedResource)
+			plan.toSkip = append(plan.toSkip, watchedResource)
+		case reaper.gracePeriod == nil:
+			plan.toDelete = append(plan.toDelete, watchedResource)
+		case watchedResource.IsPastGracePeriod(reaper.gracePeriod):
+			plan.toDelete = append(plan.toDelete, watchedResource)
+		case reaper.rescuedResources[key]:
+			plan.toKeep = append(plan.toKeep, watchedResource)
+		default:
+			_, isMarked := watchedResource.MarkedAt()
+			if !isMarked && reaper.markedResources[key] {
+				logger.Logf(
+					"%s resource %s in zone %s was rescued, and will not be deleted\n",
+					watchedResource.Type.String(), watchedResource.Name, watchedResource.Zone,
+				)
+				delete(reaper.markedResources, key)
+				reaper.rescuedResources[key] = true
+				plan.toKeep = append(plan.toKeep, watchedResource)
+			} else if !isMarked {
+				plan.toMark = append(plan.toMark, watchedResource)
+			} else {
+				plan.toKeep = append(plan.toKeep, watchedResource)
+			}
 		}
 	}
-	reaper.Watchlist = updatedWatchlist
+	// Resources that are no longer watched do not need to be remembered as marked or rescued.
+	for key := range reaper.markedResources {
+		if !watchedKeys[key] {
+			delete(reaper.markedResources, key)
+		}
+	}
+	for key := range reaper.rescuedResources {
+		if !watchedKeys[key] {
+			delete(reaper.rescuedResources, key)
+		}
+	}
+	return plan
+}
+
+// checkDeletionLimits returns whether the sweep is allowed to delete resources. If the number of
+// resources to delete exceeds the max deletions per sweep or the max deletion fraction of the
+// ReaperConfig, the reaper is tripped. A tripped reaper will not delete any resources until its
+// deletion limits are overridden, after which a single sweep is allowed to proceed regardless of
+// the limits.
+func (reaper *Reaper) checkDeletionLimits(numDeletions int) bool {
+	if reaper.limitsOverridden {
+		logger.Logf("Reaper %s deletion limits overridden, proceeding with sweep\n", reaper.UUID)
+		reaper.limitsOverridden = false
+		reaper.tripped = false
+		return true
+	}
+	if reaper.tripped {
+		logger.Logf("Reaper %s is tripped, skipping deletes until its deletion limits are overridden\n", reaper.UUID)
+		return false
+	}
+	if numDeletions == 0 {
+		return true
+	}
+
+	maxDeletions := reaper.config.GetMaxDeletionsPerSweep()
+	if maxDeletions > 0 && uint32(numDeletions) > maxDeletions {
+		reaper.trip(fmt.Errorf(
+			"reaper %s tripped: %d resources ready for deletion exceeds max deletions per sweep of %d",
+			reaper.UUID, numDeletions, maxDeletions,
+		))
+		return false
+	}
+	maxFraction := reaper.config.GetMaxDeletionFraction()
+	deletionFraction := float64(numDeletions) / float64(len(reaper.Watchlist))
+	if maxFraction > 0 && deletionFraction > maxFraction {
+		reaper.trip(fmt.Errorf(
+			"reaper %s tripped: deleting %d of %d watched resources exceeds max deletion fraction of %v",
+			reaper.UUID, numDeletions, len(reaper.Watchlist), maxFraction,
+		))
+		return false
+	}
+	return true
+}
+
+// trip marks the reaper as tripped, and logs the reason.
+func (reaper *Reaper) trip(reason error) {
+	reaper.tripped = true
+	logger.Error(reason)
+}
+
+// SetPaused pauses or resumes the reaper. A paused reaper still lists its resources, but
+// sweeps through them as in dry run mode, and does not update lifecycle rules. It is safe
+// to call while the reaper is running, in which case a sweep in progress stops before its
+// next delete.
+func (reaper *Reaper) SetPaused(paused bool) {
+	var value int32
+	if paused {
+		value = 1
+	}
+	atomic.StoreInt32(&reaper.paused, value)
+}
+
+// IsPaused returns whether the reaper is paused.
+func (reaper *Reaper) IsPaused() bool {
+	return atomic.LoadInt32(&reaper.paused) == 1
+}
+
+// IsTripped returns whether the reaper exceeded its deletion limits, and is waiting for
+// them to be overridden.
+func (reaper *Reaper) IsTripped() bool {
+	return reaper.tripped
+}
+
+// OverrideDeletionLimits allows the next sweep of a tripped reaper to delete resources
+// regardless of its deletion limits. An error is returned if the reaper is not tripped.
+func (reaper *Reaper) OverrideDeletionLimits() error {
+	if !reaper.tripped {
+		return fmt.Errorf("Reaper with UUID %s is not tripped", reaper.UUID)
+	}
+	reaper.limitsOverridden = true
+	return nil
+}
+
+// dryRunSweep records and logs the resources the sweep would delete, without deleting or
+// marking any resources.
+func (reaper *Reaper) dryRunSweep(plan *sweepPlan) {
+	for _, watchedResource := range plan.toMark {
+		logger.Logf(
+			"Dry run: reaper %s would mark %s resource %s in zone %s for deletion\n",
+			reaper.UUID, watchedResource.Type.String(), watchedResource.Name, watchedResource.Zone,
+		)
+	}
+	for _, watchedResource := range plan.toDelete {
+		logger.Logf(
+			"Dry run: reaper %s would delete %s resource %s in zone %s\n",
+			reaper.UUID, watchedResource.Type.String(), watchedResource.Name, watchedResource.Zone,
+		)
+	}
+	reaper.lastDryRun = &dryRun{runTime: reaper.Clock.Now(), resources: plan.toDelete}
 }
 
-// UpdateReaperConfig updates the reaper from a given ReaperConfig proto.
+// DryRunReport returns the resources the reaper would have deleted on its last dry run. If the
+// reaper has not done a dry run, the report will contain no resources.
+func (reaper *Reaper) DryRunReport() *reaperconfig.DryRunReport {
+	report := &reaperconfig.DryRunReport{Uuid: reaper.UUID}
+	if reaper.lastDryRun == nil {
+		return report
+	}
+	report.RunTime = timestampProto(reaper.lastDryRun.runTime)
+	for _, watchedResource := range reaper.lastDryRun.resources {
+		report.Resources = append(report.Resources, watchedResourceProto(watchedResource))
+	}
+	return report
+}
+
+// UpdateReaperConfig updates the reaper from a given ReaperConfig proto. The whole config is
+// validated first, so that the reaper is left unchanged if the config is invalid.
 func (reaper *Reaper) UpdateReaperConfig(config *reaperconfig.ReaperConfig) error {
+	parsedSchedule, err := parseSchedule(config.GetSchedule())
+	if err != nil {
+		return err
+	}
+	if err := validateResourceConfigs(config.GetResources()); err != nil {
+		return err
+	}
+	if maxFraction := config.GetMaxDeletionFraction(); maxFraction < 0 || maxFraction > 1 {
+		return fmt.Errorf("max deletion fraction %v must be between 0 and 1", maxFraction)
+	}
+	var gracePeriod resources.TTL
+	if len(config.GetGracePeriod()) > 0 {
+		var err error
+		gracePeriod, err = resources.ParseTTL(config.GetGracePeriod())
+		if err != nil {
+			return fmt.Errorf("invalid grace period: %v", err)
+		}
+	}
+	if len(config.GetProjectId()) == 0 && len(config.GetProjectIds()) == 0 && len(config.GetProjectParent()) == 0 {
+		return fmt.Errorf("reaper config must have a project ID, project IDs or a project parent")
+	}
+	if parent := config.GetProjectParent(); len(parent) > 0 {
+		if _, _, err := resourcemanager.ParseParent(parent); err != nil {
+			return err
+		}
+	}
+	if err := validateCredentials(config.GetCredentials()); err != nil {
+		return err
+	}
+	retryPolicy, err := clients.NewRetryPolicy(config.GetRetryPolicy())
+	if err != nil {
+		return fmt.Errorf("invalid retry policy: %v", err)
+	}
 	reaper.config = config
+	reaper.gracePeriod = gracePeriod
+	reaper.retryPolicy = retryPolicy
 
 	reaper.ProjectID = config.GetProjectId()
+	reaper.ProjectIDs = reaper.configuredProjects()
 	reaper.UUID = config.GetUuid()
-
-	parsedSchedule, err := parseSchedule(config.GetSchedule())
 	reaper.Schedule = parsedSchedule
-	return err
+	return nil
 }
 
 // GetResources gets all the GCP resources defined in the ReaperConfig, and adds them to the
 // reaper's Watchlist. Note, if the same resource is referenced by multiple ResourceConfigs,
-// then the TTL of that resource will be the one that deletes the resource the latest.
+// then the TTL of that resource will be the one that deletes the resource the latest. Configs
+// and zones are listed in parallel, in each of the reaper's projects. If listing a zone fails,
+// the error is reported for that zone, and the resources already watched in it are kept.
+// Configs that use lifecycle rules are not listed, and their buckets' lifecycle rules are
+// reconciled instead.
 func (reaper *Reaper) GetResources(ctx context.Context, clientOptions ...option.ClientOption) {
-	var newWatchlist []*resources.WatchedResource
-	newWatchedResources := make(map[string]map[string]*resources.WatchedResource)
+	listingErrors := make(map[string]listingError)
+	reaper.ProjectIDs = reaper.resolveProjects(ctx, listingErrors, clientOptions...)
 
-	resourceConfigs := reaper.config.GetResources()
-	for _, resourceConfig := range resourceConfigs {
-		resourceType := resourceConfig.GetResourceType()
+	tasks := newListTasks(reaper.config.GetResources(), reaper.ProjectIDs)
+	reaper.runListTasks(tasks, newClientCache(ctx, reaper, clientOptions...))
 
-		resourceClient, err := getAuthedClient(ctx, reaper, resourceType, clientOptions...)
-		if err != nil {
-			logger.Error(err)
-			continue
-		}
-
-		filteredResources, err := resourceClient.GetResources(reaper.ProjectID, resourceConfig)
-		if err != nil {
-			getResourcesError := fmt.Errorf(
-				"%s client failed to get resources with the following error: %s",
-				resourceType.String(), err.Error(),
-			)
-			logger.Error(getResourcesError)
-			continue
+	// Resources are merged in the order of the tasks, rather than the order the tasks
+	// finished in, so that the watchlist and the merged TTLs are deterministic.
+	var newWatchlist []*resources.WatchedResource
+	newWatchedResources := make(map[string]*resources.WatchedResource)
+	for _, task := range tasks {
+		resourceConfig := task.config
+		resourceType := resourceConfig.GetResourceType()
+		watchedResources := resources.CreateWatchlist(task.resources, resourceConfig.GetTtl())
+
+		zoneErrors := task.zoneErrors()
+		logListingErrors(task.projectID, resourceType, zoneErrors)
+		for zone, err := range zoneErrors {
+			listingErr := listingError{projectID: task.projectID, resourceType: resourceType, zone: zone, err: err}
+			listingErrors[listingErr.key()] = listingErr
+			// Keep watching the resources from the failed zone rather than dropping them
+			// until the zone can be listed again.
+			watchedResources = append(watchedResources, reaper.watchedResourcesInZone(task.projectID, resourceType, zone)...)
 		}
-		watchedResources := resources.CreateWatchlist(filteredResources, resourceConfig.GetTtl())
 
-		// Check for duplicates. If one exists, update the TTL by the max
+		// Check for duplicates. If one exists, update the TTL by the max, and force delete
+		// the resource if any of its configs do.
 		for _, resource := range watchedResources {
-			if _, isZoneWatched := newWatchedResources[resource.Zone]; !isZoneWatched {
-				newWatchedResources[resource.Zone] = make(map[string]*resources.WatchedResource)
-			}
-
-			if _, alreadyWatched := newWatchedResources[resource.Zone][resource.Name]; alreadyWatched {
-				newTTL, err := maxTTL(resource, newWatchedResources[resource.Zone][resource.Name])
+			key := resourceKey(resource.Resource)
+			if watchedResource, alreadyWatched := newWatchedResources[key]; alreadyWatched {
+				newTTL, err := maxTTL(resource, watchedResource)
 				if err != nil {
 					logger.Error(err)
 					continue
 				}
-				newWatchedResources[resource.Zone][resource.Name].TTL = newTTL
+				watchedResource.TTL = newTTL
+				watchedResource.ForceDelete = watchedResource.ForceDelete || resource.ForceDelete
 			} else {
-				newWatchedResources[resource.Zone][resource.Name] = resource
+				newWatchedResources[key] = resource
+				newWatchlist = append(newWatchlist, resource)
 			}
 		}
 	}
-	// Converting resources map into list
-	for zone := range newWatchedResources {
-		for _, resource := range newWatchedResources[zone] {
-			newWatchlist = append(newWatchlist, resource)
+	reaper.Watchlist = newWatchlist
+	reaper.listingErrors = listingErrors
+
+	reaper.reconcileLifecycleRules(ctx, clientOptions...)
+}
+
+// watchedResourcesInZone returns the resources of the given project, type and zone that are
+// currently in the reaper's watchlist.
+func (reaper *Reaper) watchedResourcesInZone(projectID string, resourceType reaperconfig.ResourceType, zone string) []*resources.WatchedResource {
+	var watchedResources []*resources.WatchedResource
+	for _, watchedResource := range reaper.Watchlist {
+		if watchedResource.Type == resourceType && strings.EqualFold(watchedResource.Zone, zone) &&
+			reaper.resourceProject(watchedResource.Resource) == projectID {
+			watchedResources = append(watchedResources, watchedResource)
 		}
 	}
-	reaper.Watchlist = newWatchlist
+	return watchedResources
 }
 
 // WatchlistString returns a near sting of the reaper's Watchlist.
@@ -215,6 +661,8 @@ func NewResourceConfig(resourceType reaperconfig.ResourceType, zones []string, n
 }
 
 // getAuthedClient is a helper method for getting an authenticated GCP client for a given resource type.
+// The client authenticates with the reaper's credentials, if it has any, and retries failed calls
+// according to the reaper's retry policy.
 func getAuthedClient(ctx context.Context, reaper *Reaper, resourceType reaperconfig.ResourceType, clientOptions ...option.ClientOption) (clients.Client, error) {
 	resourceClient, err := clients.NewClient(resourceType)
 	if err != nil {
@@ -225,7 +673,10 @@ func getAuthedClient(ctx context.Context, reaper *Reaper, resourceType reapercon
 		return nil, clientError
 	}
 
-	err = resourceClient.Auth(ctx, clientOptions...)
+	clientOptions, err = clients.CredentialOptions(ctx, reaper.config.GetCredentials(), clientOptions...)
+	if err == nil {
+		err = resourceClient.Auth(ctx, clientOptions...)
+	}
 	if err != nil {
 		authError := fmt.Errorf(
 			"%s client failed authenticate with the following error: %s",
@@ -234,7 +685,7 @@ func getAuthedClient(ctx context.Context, reaper *Reaper, resourceType reapercon
 		return nil, authError
 	}
 
-	return resourceClient, nil
+	return clients.WithRetries(ctx, resourceClient, reaper.retryPolicy), nil
 }
 
 // FreezeTime is a helper method for freezing the clocks of all resources in a reaper's
@@ -245,6 +696,45 @@ func (reaper *Reaper) FreezeTime(instant time.Time) {
 	}
 }
 
+// resourceKey returns a key that uniquely identifies a resource watched by the reaper.
+func resourceKey(resource *resources.Resource) string {
+	key := fmt.Sprintf("%s/%s/%s/%s", resource.ProjectID, resource.Type.String(), resource.Zone, resource.Name)
+	if resource.Generation != 0 {
+		key = fmt.Sprintf("%s#%d", key, resource.Generation)
+	}
+	return key
+}
+
+// watchedResourceProto converts a WatchedResource into its proto representation.
+func watchedResourceProto(watchedResource *resources.WatchedResource) *reaperconfig.WatchedResource {
+	resourceProto := &reaperconfig.WatchedResource{
+		Name:         watchedResource.Name,
+		Zone:         watchedResource.Zone,
+		ResourceType: watchedResource.Type,
+		TimeCreated:  timestampProto(watchedResource.TimeCreated),
+		Ttl:          watchedResource.TTL,
+		Generation:   watchedResource.Generation,
+		ProjectId:    watchedResource.ProjectID,
+		Labels:       watchedResource.Labels,
+		Protected:    watchedResource.Protected,
+		ForceDelete:  watchedResource.ForceDelete,
+	}
+	if deletionTime, err := watchedResource.GetDeletionTime(); err == nil {
+		resourceProto.DeletionTime = timestampProto(deletionTime)
+	}
+	return resourceProto
+}
+
+// timestampProto converts a time into a Timestamp proto, returning nil if the time
+// cannot be represented.
+func timestampProto(instant time.Time) *timestamp.Timestamp {
+	timestampProto, err := ptypes.TimestampProto(instant)
+	if err != nil {
+		return nil
+	}
+	return timestampProto
+}
+
 // maxTTL is a helper function to determine which watched resource will be deleted later,
 // and return its TTL.
 func maxTTL(resourceA, resourceB *resources.WatchedResource) (string, error) {
@@ -263,6 +753,61 @@ func maxTTL(resourceA, resourceB *resources.WatchedResource) (string, error) {
 	}
 }
 
+// validateResourceConfigs checks that the TTL of each ResourceConfig is either a
+// duration or a cron time string, that configs using lifecycle rules can be
+// translated into lifecycle rules, and that project configs only watch folders
+// on the allowlist.
+func validateResourceConfigs(resourceConfigs []*reaperconfig.ResourceConfig) error {
+	for _, resourceConfig := range resourceConfigs {
+		if _, err := resources.ParseTTL(resourceConfig.GetTtl()); err != nil {
+			return fmt.Errorf(
+				"invalid TTL for %s resource config with name filter %s: %v",
+				resourceConfig.GetResourceType().String(), resourceConfig.GetNameFilter(), err,
+			)
+		}
+		if resourceConfig.GetResourceType() == reaperconfig.ResourceType_PROJECT {
+			if err := validateProjectFolders(resourceConfig.GetZones()); err != nil {
+				return err
+			}
+		}
+		if !resourceConfig.GetUseLifecycleRules() {
+			continue
+		}
+		if _, err := gcs.LifecycleRulesFromConfig(resourceConfig); err != nil {
+			return fmt.Errorf("invalid lifecycle rules config: %v", err)
+		}
+	}
+	return nil
+}
+
+// validateProjectFolders checks that a project config watches at least one folder, and
+// that every folder it watches is on the allowlist of folders projects can be deleted from.
+func validateProjectFolders(folders []string) error {
+	if len(folders) == 0 {
+		return fmt.Errorf("project resource config must list the folders to watch as its zones")
+	}
+	for _, folder := range folders {
+		if !resourcemanager.IsFolderAllowed(folder) {
+			return fmt.Errorf("folder %s is not on the allowlist of folders projects can be deleted from", folder)
+		}
+	}
+	return nil
+}
+
+// validateCredentials checks that the credentials file of the reaper's credentials can be
+// read by the server, and that the service account to impersonate is an email.
+func validateCredentials(credentials *reaperconfig.Credentials) error {
+	if credentialsFile := credentials.GetCredentialsFile(); len(credentialsFile) > 0 {
+		if _, err := os.Stat(credentialsFile); err != nil {
+			return fmt.Errorf("invalid credentials file: %v", err)
+		}
+	}
+	if serviceAccount := credentials.GetImpersonateServiceAccount(); len(serviceAccount) > 0 && !strings.Contains(serviceAccount, "@") {
+		return fmt.Errorf("service account to impersonate %s must be an email", serviceAccount)
+	}
+	return nil
+}
+
 // parseSchedule parses the cron time string that defined the reaper's
 // run schedule, and either returns a Schedule struct, or nil if the
 // schedule string is malformed.
@@ -17,15 +17,24 @@ package reaper
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/golang/protobuf/ptypes"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/clients"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/clients/gcs"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/clients/resourcemanager"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/logger"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/utils"
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
 	"google.golang.org/api/option"
 )
@@ -98,6 +107,507 @@ func TestSweepThroughResources(t *testing.T) {
 	}
 }
 
+func TestDryRunSweep(t *testing.T) {
+	deleteCalled := false
+	server := createServer(func(w http.ResponseWriter, req *http.Request) {
+		deleteCalled = true
+		deleteComputeEngineResourceHandler(w, req)
+	})
+	defer server.Close()
+
+	testClientOptions := getTestClientOptions(server)
+
+	for _, testCase := range reaperRunTestCases {
+		deleteCalled = false
+		testReaper := createTestReaper("testProject", "* * * * *", testCase.Watchlist...)
+		testReaper.config = createReaperConfig("testProject", "* * * * *")
+		testReaper.config.DryRun = true
+		testReaper.FreezeClock(currentTime)
+		testReaper.FreezeTime(currentTime)
+
+		testReaper.SweepThroughResources(testContext, testClientOptions...)
+		if deleteCalled {
+			t.Error("Dry run sweep should not delete resources")
+		}
+		if len(testReaper.Watchlist) != len(testCase.Watchlist) {
+			t.Error("Dry run sweep should not update the watchlist")
+		}
+
+		report := testReaper.DryRunReport()
+		expectedDeletions := len(testCase.Watchlist) - len(testCase.Expected.Watchlist)
+		if len(report.GetResources()) != expectedDeletions {
+			t.Errorf("Expected %d resources in dry run report, got %d", expectedDeletions, len(report.GetResources()))
+		}
+		for _, resource := range report.GetResources() {
+			for _, keptResource := range testCase.Expected.Watchlist {
+				if resource.GetName() == keptResource.Name {
+					t.Errorf("Resource %s should not be in the dry run report", resource.GetName())
+				}
+			}
+		}
+	}
+}
+
+type DeletionLimitsTestCase struct {
+	MaxDeletions    uint32
+	MaxFraction     float64
+	ExpectedWatched int
+	ExpectedTripped bool
+}
+
+// Using the first reaper run test case, where 2 of the 3 watched resources are ready for deletion.
+var deletionLimitsTestCases = []DeletionLimitsTestCase{
+	DeletionLimitsTestCase{0, 0, 1, false},
+	DeletionLimitsTestCase{2, 0, 1, false},
+	DeletionLimitsTestCase{1, 0, 3, true},
+	DeletionLimitsTestCase{0, 0.7, 1, false},
+	DeletionLimitsTestCase{0, 0.5, 3, true},
+	DeletionLimitsTestCase{5, 0.5, 3, true},
+}
+
+func TestDeletionLimits(t *testing.T) {
+	server := createServer(deleteComputeEngineResourceHandler)
+	defer server.Close()
+
+	testClientOptions := getTestClientOptions(server)
+
+	for _, testCase := range deletionLimitsTestCases {
+		testReaper := createTestReaper("testProject", "* * * * *", reaperRunTestCases[0].Watchlist...)
+		testReaper.config = createReaperConfig("testProject", "* * * * *")
+		testReaper.config.MaxDeletionsPerSweep = testCase.MaxDeletions
+		testReaper.config.MaxDeletionFraction = testCase.MaxFraction
+		testReaper.FreezeTime(currentTime)
+
+		testReaper.SweepThroughResources(testContext, testClientOptions...)
+		if len(testReaper.Watchlist) != testCase.ExpectedWatched {
+			t.Errorf("Expected %d watched resources after sweep, got %d", testCase.ExpectedWatched, len(testReaper.Watchlist))
+		}
+		if testReaper.IsTripped() != testCase.ExpectedTripped {
+			t.Errorf("Expected reaper tripped: %v, got: %v", testCase.ExpectedTripped, testReaper.IsTripped())
+		}
+		if !testCase.ExpectedTripped {
+			if err := testReaper.OverrideDeletionLimits(); err == nil {
+				t.Error("Overriding deletion limits of a reaper that is not tripped should fail")
+			}
+			continue
+		}
+
+		// A tripped reaper should not delete until overridden.
+		testReaper.SweepThroughResources(testContext, testClientOptions...)
+		if len(testReaper.Watchlist) != testCase.ExpectedWatched {
+			t.Error("Tripped reaper should not delete resources")
+		}
+		if err := testReaper.OverrideDeletionLimits(); err != nil {
+			t.Errorf("Override deletion limits failed: %v", err)
+		}
+		testReaper.SweepThroughResources(testContext, testClientOptions...)
+		if len(testReaper.Watchlist) != 1 || testReaper.IsTripped() {
+			t.Error("Overridden reaper should delete resources and no longer be tripped")
+		}
+	}
+}
+
+func TestGracePeriodSweep(t *testing.T) {
+	var requests []string
+	var requestsMux sync.Mutex
+	server := createServer(func(w http.ResponseWriter, req *http.Request) {
+		requestsMux.Lock()
+		requests = append(requests, req.Method+" "+req.URL.Path)
+		requestsMux.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name": "instance", "labelFingerprint": "fingerprint", "status": "DONE"}`))
+	})
+	defer server.Close()
+
+	testClientOptions := getTestClientOptions(server)
+
+	unmarked := resources.NewResource("Unmarked", "testZone", earlyTime, reaperconfig.ResourceType_GCE_VM)
+	markedLongAgo := resources.NewResource("MarkedLongAgo", "testZone", earlyTime, reaperconfig.ResourceType_GCE_VM)
+	markedLongAgo.Labels = map[string]string{resources.MarkLabel: resources.MarkValue(currentTime.Add(-2 * time.Hour))}
+	markedRecently := resources.NewResource("MarkedRecently", "testZone", earlyTime, reaperconfig.ResourceType_GCE_VM)
+	markedRecently.Labels = map[string]string{resources.MarkLabel: resources.MarkValue(currentTime.Add(-time.Minute))}
+	rescued := resources.NewResource("Rescued", "testZone", earlyTime, reaperconfig.ResourceType_GCE_VM)
+	notExpired := resources.NewResource("NotExpired", "testZone", lateTime, reaperconfig.ResourceType_GCE_VM)
+
+	testReaper := createTestReaper("testProject", "* * * * *", resources.CreateWatchlist(
+		[]*resources.Resource{unmarked, markedLongAgo, markedRecently, rescued, notExpired}, "1h",
+	)...)
+	config := createReaperConfig("testProject", "* * * * *")
+	config.GracePeriod = "1h"
+	if err := testReaper.UpdateReaperConfig(config); err != nil {
+		t.Fatalf("Update reaper config failed: %v", err)
+	}
+	testReaper.markedResources = map[string]bool{resourceKey(rescued): true}
+	testReaper.FreezeClock(currentTime)
+	testReaper.FreezeTime(currentTime)
+
+	testReaper.SweepThroughResources(testContext, testClientOptions...)
+
+	expected := createTestReaper("testProject", "* * * * *", resources.CreateWatchlist(
+		[]*resources.Resource{unmarked, markedRecently, rescued, notExpired}, "1h",
+	)...)
+	if !areWatchlistsEqual(testReaper, expected) {
+		t.Error("Only the resource past its grace period should be removed from the watchlist")
+	}
+	expectedRequests := []string{
+		"DELETE /testProject/zones/testZone/instances/MarkedLongAgo",
+		"GET /testProject/zones/testZone/instances/Unmarked",
+		"POST /testProject/zones/testZone/instances/Unmarked/setLabels",
+	}
+	sort.Strings(requests)
+	if !reflect.DeepEqual(requests, expectedRequests) {
+		t.Errorf("Expected requests %v, got %v", expectedRequests, requests)
+	}
+	if !testReaper.markedResources[resourceKey(unmarked)] {
+		t.Error("Reaper should remember the resource it marked")
+	}
+}
+
+func TestRescueSurvivesRestart(t *testing.T) {
+	var requests []string
+	server := createServer(func(w http.ResponseWriter, req *http.Request) {
+		requests = append(requests, req.Method+" "+req.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name": "instance", "labelFingerprint": "fingerprint", "status": "DONE"}`))
+	})
+	defer server.Close()
+
+	rescued := resources.NewResource("Rescued", "testZone", earlyTime, reaperconfig.ResourceType_GCE_VM)
+	testReaper := createTestReaper("testProject", "* * * * *", resources.CreateWatchlist([]*resources.Resource{rescued}, "1h")...)
+	config := createReaperConfig("testProject", "* * * * *")
+	config.GracePeriod = "1h"
+	if err := testReaper.UpdateReaperConfig(config); err != nil {
+		t.Fatalf("Update reaper config failed: %v", err)
+	}
+	testReaper.markedResources = map[string]bool{resourceKey(rescued): true}
+	testReaper.FreezeTime(currentTime)
+
+	testReaper.SweepThroughResources(testContext, getTestClientOptions(server)...)
+	if !testReaper.rescuedResources[resourceKey(rescued)] || testReaper.markedResources[resourceKey(rescued)] {
+		t.Error("Reaper should remember the resource as rescued rather than marked")
+	}
+
+	restoredReaper, err := NewReaperFromState(testReaper.State())
+	if err != nil {
+		t.Fatal(err)
+	}
+	restoredReaper.FreezeTime(currentTime)
+	restoredReaper.SweepThroughResources(testContext, getTestClientOptions(server)...)
+	if len(requests) != 0 {
+		t.Errorf("Rescued resource should not be marked or deleted again after a restart, got requests %v", requests)
+	}
+	if summary := restoredReaper.LastSweep(); summary != (SweepSummary{Listed: 1}) {
+		t.Errorf("Expected the rescued resource to be kept, got %+v", summary)
+	}
+}
+
+func TestProtectedResourcesSkipped(t *testing.T) {
+	var deletes []string
+	var deletesMux sync.Mutex
+	server := createServer(func(w http.ResponseWriter, req *http.Request) {
+		deletesMux.Lock()
+		deletes = append(deletes, req.URL.Path)
+		deletesMux.Unlock()
+		deleteComputeEngineResourceHandler(w, req)
+	})
+	defer server.Close()
+
+	testClientOptions := getTestClientOptions(server)
+
+	unprotected := resources.NewResource("Unprotected", "testZone", earlyTime, reaperconfig.ResourceType_GCE_VM)
+	protected := resources.NewResource("Protected", "testZone", earlyTime, reaperconfig.ResourceType_GCE_VM)
+	protected.Protected = true
+	notExpired := resources.NewResource("NotExpired", "testZone", lateTime, reaperconfig.ResourceType_GCE_VM)
+
+	testReaper := createTestReaper("testProject", "* * * * *", resources.CreateWatchlist(
+		[]*resources.Resource{unprotected, protected, notExpired}, "1h",
+	)...)
+	testReaper.config = createReaperConfig("testProject", "* * * * *")
+	testReaper.FreezeTime(currentTime)
+
+	testReaper.SweepThroughResources(testContext, testClientOptions...)
+
+	expectedDeletes := []string{"/testProject/zones/testZone/instances/Unprotected"}
+	if !reflect.DeepEqual(deletes, expectedDeletes) {
+		t.Errorf("Expected deletes %v, got %v", expectedDeletes, deletes)
+	}
+	expected := createTestReaper("testProject", "* * * * *", resources.CreateWatchlist(
+		[]*resources.Resource{protected, notExpired}, "1h",
+	)...)
+	if !areWatchlistsEqual(testReaper, expected) {
+		t.Error("Protected resource should be skipped and stay on the watchlist")
+	}
+	if summary := testReaper.LastSweep(); summary != (SweepSummary{Listed: 3, Deleted: 1, Skipped: 1}) {
+		t.Errorf("Expected one deleted and one skipped resource, got %+v", summary)
+	}
+}
+
+type MatchedConfigTestCase struct {
+	Resource *resources.WatchedResource
+	Expected int
+}
+
+var matchedConfigResources = []*reaperconfig.ResourceConfig{
+	NewResourceConfig(reaperconfig.ResourceType_GCE_VM, []string{"testZone"}, "^test", "", "1h"),
+	NewResourceConfig(reaperconfig.ResourceType_GCE_VM, []string{"testZone"}, "test", "", "2h"),
+	NewResourceConfig(reaperconfig.ResourceType_GCS_BUCKET, nil, "test", "", "1h"),
+}
+
+var matchedConfigTestCases = []MatchedConfigTestCase{
+	MatchedConfigTestCase{resources.NewWatchedResource(resources.NewResource("test-vm", "testZone", earlyTime, reaperconfig.ResourceType_GCE_VM), "2h"), 1},
+	MatchedConfigTestCase{resources.NewWatchedResource(resources.NewResource("test-vm", "TESTZONE", earlyTime, reaperconfig.ResourceType_GCE_VM), "1h"), 0},
+	MatchedConfigTestCase{resources.NewWatchedResource(resources.NewResource("test-vm", "otherZone", earlyTime, reaperconfig.ResourceType_GCE_VM), "1h"), -1},
+	MatchedConfigTestCase{resources.NewWatchedResource(resources.NewResource("test-bucket", "US", earlyTime, reaperconfig.ResourceType_GCS_BUCKET), "1h"), 2},
+	MatchedConfigTestCase{resources.NewWatchedResource(resources.NewResource("other", "testZone", earlyTime, reaperconfig.ResourceType_GCE_VM), "1h"), -1},
+}
+
+func TestMatchedConfig(t *testing.T) {
+	testReaper := createTestReaper("testProject", "* * * * *")
+	testReaper.config = createReaperConfig("testProject", "* * * * *", matchedConfigResources...)
+	for _, testCase := range matchedConfigTestCases {
+		var expected *reaperconfig.ResourceConfig
+		if testCase.Expected >= 0 {
+			expected = matchedConfigResources[testCase.Expected]
+		}
+		if matched := testReaper.matchedConfig(testCase.Resource); matched != expected {
+			t.Errorf("Expected config %v to match %s, got %v", expected, testCase.Resource.Name, matched)
+		}
+	}
+}
+
+func TestBatchDeletePartialFailure(t *testing.T) {
+	var batchRequests int32
+	batchHandler := utils.BatchHandler(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasSuffix(req.URL.Path, "/Forbidden") {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		deleteComputeEngineResourceHandler(w, req)
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&batchRequests, 1)
+		batchHandler(w, req)
+	}))
+	defer server.Close()
+
+	testClientOptions := getTestClientOptions(server)
+
+	deleted := resources.NewResource("Deleted", "testZone", earlyTime, reaperconfig.ResourceType_GCE_VM)
+	forbidden := resources.NewResource("Forbidden", "testZone", earlyTime, reaperconfig.ResourceType_GCE_VM)
+	notExpired := resources.NewResource("NotExpired", "testZone", lateTime, reaperconfig.ResourceType_GCE_VM)
+
+	testReaper := createTestReaper("testProject", "* * * * *", resources.CreateWatchlist(
+		[]*resources.Resource{deleted, forbidden, notExpired}, "1h",
+	)...)
+	testReaper.config = createReaperConfig("testProject", "* * * * *")
+	testReaper.FreezeTime(currentTime)
+
+	testReaper.SweepThroughResources(testContext, testClientOptions...)
+
+	if batchRequests != 1 {
+		t.Errorf("Expected both deletes in a single batch request, got %d requests", batchRequests)
+	}
+	expected := createTestReaper("testProject", "* * * * *", resources.CreateWatchlist(
+		[]*resources.Resource{forbidden, notExpired}, "1h",
+	)...)
+	if !areWatchlistsEqual(testReaper, expected) {
+		t.Error("Resource that failed to be deleted should stay on the watchlist")
+	}
+	if summary := testReaper.LastSweep(); summary != (SweepSummary{Listed: 3, Deleted: 1, Failed: 1}) {
+		t.Errorf("Expected one deleted and one failed resource, got %+v", summary)
+	}
+	deletions := testReaper.LastDeletions()
+	if len(deletions) != 2 {
+		t.Fatalf("Expected 2 deletion records, got %d", len(deletions))
+	}
+	for _, deletion := range deletions {
+		expectedOutcome := reaperconfig.DeletionOutcome_DELETED
+		if deletion.GetResource().GetName() == "Forbidden" {
+			expectedOutcome = reaperconfig.DeletionOutcome_FAILED
+		}
+		if deletion.GetOutcome() != expectedOutcome || deletion.GetReaperUuid() != testReaper.UUID || deletion.GetResource().GetProjectId() != "testProject" {
+			t.Errorf("Expected %s record of %s in testProject, got %v", expectedOutcome, deletion.GetResource().GetName(), deletion)
+		}
+		if (expectedOutcome == reaperconfig.DeletionOutcome_FAILED) != (len(deletion.GetError()) > 0) {
+			t.Errorf("Expected only the failed deletion to have an error, got %v", deletion)
+		}
+	}
+}
+
+func TestConcurrentSweep(t *testing.T) {
+	const maxConcurrency = 4
+	var inFlight, maxInFlight, numDeletes int32
+	server := createServer(func(w http.ResponseWriter, req *http.Request) {
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			observed := atomic.LoadInt32(&maxInFlight)
+			if current <= observed || atomic.CompareAndSwapInt32(&maxInFlight, observed, current) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&numDeletes, 1)
+		deleteComputeEngineResourceHandler(w, req)
+	})
+	defer server.Close()
+
+	testClientOptions := getTestClientOptions(server)
+
+	var watchlist []*resources.WatchedResource
+	for idx := 0; idx < 20; idx++ {
+		expired := resources.NewResource(fmt.Sprintf("Expired%d", idx), "testZone", earlyTime, reaperconfig.ResourceType_GCE_VM)
+		notExpired := resources.NewResource(fmt.Sprintf("NotExpired%d", idx), "testZone", lateTime, reaperconfig.ResourceType_GCE_VM)
+		watchlist = append(watchlist, resources.NewWatchedResource(expired, "1h"), resources.NewWatchedResource(notExpired, "1h"))
+	}
+	testReaper := createTestReaper("testProject", "* * * * *", watchlist...)
+	testReaper.config = createReaperConfig("testProject", "* * * * *")
+	testReaper.config.ConcurrencyLimits = []*reaperconfig.ConcurrencyLimit{
+		&reaperconfig.ConcurrencyLimit{ResourceType: reaperconfig.ResourceType_GCE_VM, MaxConcurrency: maxConcurrency},
+	}
+	testReaper.FreezeTime(currentTime)
+
+	testReaper.SweepThroughResources(testContext, testClientOptions...)
+	if numDeletes != 20 {
+		t.Errorf("Expected 20 deletes, got %d", numDeletes)
+	}
+	if maxInFlight > maxConcurrency {
+		t.Errorf("Expected at most %d concurrent deletes, got %d", maxConcurrency, maxInFlight)
+	}
+	if len(testReaper.Watchlist) != 20 {
+		t.Errorf("Expected 20 resources left on the watchlist, got %d", len(testReaper.Watchlist))
+	}
+	for _, watchedResource := range testReaper.Watchlist {
+		if !strings.HasPrefix(watchedResource.Name, "NotExpired") {
+			t.Errorf("Resource %s should have been deleted", watchedResource.Name)
+		}
+	}
+}
+
+func TestDeletionAttemptTimes(t *testing.T) {
+	const deleteTime = 20 * time.Millisecond
+	server := createServer(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(deleteTime)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	defer server.Close()
+
+	var watchlist []*resources.WatchedResource
+	for _, name := range []string{"test-bucket-1", "test-bucket-2"} {
+		bucket := resources.NewResource(name, "US", earlyTime, reaperconfig.ResourceType_GCS_BUCKET)
+		watchlist = append(watchlist, resources.NewWatchedResource(bucket, "1h"))
+	}
+	testReaper := createTestReaper("testProject", "* * * * *", watchlist...)
+	testReaper.config = createReaperConfig("testProject", "* * * * *")
+	testReaper.config.ConcurrencyLimits = []*reaperconfig.ConcurrencyLimit{
+		&reaperconfig.ConcurrencyLimit{ResourceType: reaperconfig.ResourceType_GCS_BUCKET, MaxConcurrency: 1},
+	}
+
+	sweepStart := time.Now()
+	testReaper.SweepThroughResources(testContext, getTestClientOptions(server)...)
+	deletions := testReaper.LastDeletions()
+	if len(deletions) != 2 {
+		t.Fatalf("Expected 2 deletions, got %v", deletions)
+	}
+	var attemptTimes []time.Time
+	for _, deletion := range deletions {
+		attemptTime, err := ptypes.Timestamp(deletion.GetAttemptTime())
+		if err != nil {
+			t.Fatal(err)
+		}
+		attemptTimes = append(attemptTimes, attemptTime)
+	}
+	if attemptTimes[0].Sub(sweepStart) < deleteTime {
+		t.Errorf("Expected the first deletion to be recorded once its delete finished, got %v after the sweep started", attemptTimes[0].Sub(sweepStart))
+	}
+	if gap := attemptTimes[1].Sub(attemptTimes[0]); gap < deleteTime && -gap < deleteTime {
+		t.Errorf("Expected each deletion to be recorded at the time of its own delete, got times %v", attemptTimes)
+	}
+}
+
+func TestCancelledSweep(t *testing.T) {
+	ctx, cancel := context.WithCancel(testContext)
+	defer cancel()
+	var batchRequests int32
+	batchHandler := utils.BatchHandler(deleteComputeEngineResourceHandler)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// The sweep is cancelled while the second batch is in flight.
+		if atomic.AddInt32(&batchRequests, 1) == 2 {
+			cancel()
+			<-req.Context().Done()
+			return
+		}
+		batchHandler(w, req)
+	}))
+	defer server.Close()
+
+	var watchlist []*resources.WatchedResource
+	for idx := 0; idx < 5; idx++ {
+		expired := resources.NewResource(fmt.Sprintf("Expired%d", idx), "testZone", earlyTime, reaperconfig.ResourceType_GCE_VM)
+		expired.ProjectID = fmt.Sprintf("testProject%d", idx)
+		watchlist = append(watchlist, resources.NewWatchedResource(expired, "1h"))
+	}
+	testReaper := createTestReaper("testProject", "* * * * *", watchlist...)
+	testReaper.config = createReaperConfig("testProject", "* * * * *")
+	testReaper.config.ConcurrencyLimits = []*reaperconfig.ConcurrencyLimit{
+		&reaperconfig.ConcurrencyLimit{ResourceType: reaperconfig.ResourceType_GCE_VM, MaxConcurrency: 1},
+	}
+	testReaper.FreezeTime(currentTime)
+
+	testReaper.SweepThroughResources(ctx, getTestClientOptions(server)...)
+	if batchRequests != 2 {
+		t.Errorf("Expected no batches to be sent once the sweep is cancelled, got %d batch requests", batchRequests)
+	}
+	if summary := testReaper.LastSweep(); summary != (SweepSummary{Listed: 5, Deleted: 1}) {
+		t.Errorf("Expected one deleted resource and no failures, got %+v", summary)
+	}
+	if len(testReaper.Watchlist) != 4 {
+		t.Errorf("Expected the resources left over to stay on the watchlist, got %d resources", len(testReaper.Watchlist))
+	}
+	for _, deletion := range testReaper.LastDeletions() {
+		if deletion.GetOutcome() != reaperconfig.DeletionOutcome_DELETED {
+			t.Errorf("Expected only the deleted resource to be recorded, got %v", deletion)
+		}
+	}
+}
+
+func TestPausedSweep(t *testing.T) {
+	var testReaper *Reaper
+	var batchRequests int32
+	batchHandler := utils.BatchHandler(deleteComputeEngineResourceHandler)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// The reaper is paused while the first batch is in flight.
+		atomic.AddInt32(&batchRequests, 1)
+		testReaper.SetPaused(true)
+		batchHandler(w, req)
+	}))
+	defer server.Close()
+
+	var watchlist []*resources.WatchedResource
+	for idx := 0; idx < 5; idx++ {
+		expired := resources.NewResource(fmt.Sprintf("Expired%d", idx), "testZone", earlyTime, reaperconfig.ResourceType_GCE_VM)
+		expired.ProjectID = fmt.Sprintf("testProject%d", idx)
+		watchlist = append(watchlist, resources.NewWatchedResource(expired, "1h"))
+	}
+	testReaper = createTestReaper("testProject", "* * * * *", watchlist...)
+	testReaper.config = createReaperConfig("testProject", "* * * * *")
+	testReaper.config.ConcurrencyLimits = []*reaperconfig.ConcurrencyLimit{
+		&reaperconfig.ConcurrencyLimit{ResourceType: reaperconfig.ResourceType_GCE_VM, MaxConcurrency: 1},
+	}
+	testReaper.FreezeTime(currentTime)
+
+	testReaper.SweepThroughResources(testContext, getTestClientOptions(server)...)
+	if batchRequests != 1 {
+		t.Errorf("Expected no batches to be sent once the reaper is paused, got %d batch requests", batchRequests)
+	}
+	if summary := testReaper.LastSweep(); summary != (SweepSummary{Listed: 5, Deleted: 1}) {
+		t.Errorf("Expected one deleted resource and no failures, got %+v", summary)
+	}
+	if len(testReaper.Watchlist) != 4 {
+		t.Errorf("Expected the resources left over to stay on the watchlist, got %d resources", len(testReaper.Watchlist))
+	}
+}
+
 type UpdateReaperConfigTestCase struct {
 	ReaperConfig *reaperconfig.ReaperConfig
 	Expected     *Reaper
@@ -113,8 +623,8 @@ var updateReaperConfigTestCases = []UpdateReaperConfigTestCase{
 		createTestReaper("NewProjectID", "* * 10 * *"),
 	},
 	UpdateReaperConfigTestCase{
-		createReaperConfig("AnotherProjectID", "59 23 31 12 7"),
-		createTestReaper("AnotherProjectID", "59 23 31 12 7"),
+		createReaperConfig("AnotherProjectID", "59 23 31 12 6"),
+		createTestReaper("AnotherProjectID", "59 23 31 12 6"),
 	},
 	UpdateReaperConfigTestCase{
 		createReaperConfig("ProjectIDAgain", "@every 1h30m"),
@@ -135,6 +645,89 @@ func TestUpdateReaperConfig(t *testing.T) {
 	}
 }
 
+func TestUpdateReaperConfigInvalidTTL(t *testing.T) {
+	testReaper := createTestReaper("SampleProject", "* * * * *")
+	config := createReaperConfig(
+		"NewProjectID", "* * * * *", createResourceConfig(reaperconfig.ResourceType_GCE_VM, "Test", "", "not a ttl", "testZone1"),
+	)
+	if err := testReaper.UpdateReaperConfig(config); err == nil {
+		t.Error("Expected invalid TTL to be rejected")
+	}
+	config.Resources[0].Ttl = "0s"
+	if err := testReaper.UpdateReaperConfig(config); err == nil {
+		t.Error("Expected zero TTL to be rejected")
+	}
+	if testReaper.ProjectID != "SampleProject" {
+		t.Error("Reaper should not be updated from an invalid config")
+	}
+
+	config = createReaperConfig(
+		"NewProjectID", "* * * * *",
+		createResourceConfig(reaperconfig.ResourceType_GCE_VM, "Test", "", "6h", "testZone1"),
+		createResourceConfig(reaperconfig.ResourceType_GCE_VM, "Test", "", "P2D", "testZone1"),
+		createResourceConfig(reaperconfig.ResourceType_GCE_VM, "Test", "", "0 5 * * *", "testZone1"),
+	)
+	if err := testReaper.UpdateReaperConfig(config); err != nil {
+		t.Errorf("Expected valid TTLs to be accepted, got: %v", err)
+	}
+}
+
+func TestUpdateReaperConfigInvalidSchedule(t *testing.T) {
+	testReaper := createTestReaper("SampleProject", "* * * * *")
+	testReaper.config = createReaperConfig("SampleProject", "* * * * *")
+	expectedSchedule := testReaper.Schedule
+	config := createReaperConfig(
+		"NewProjectID", "not a schedule", createResourceConfig(reaperconfig.ResourceType_GCE_VM, "Test", "", "6h", "testZone1"),
+	)
+	if err := testReaper.UpdateReaperConfig(config); err == nil {
+		t.Error("Expected invalid schedule to be rejected")
+	}
+	if testReaper.ProjectID != "SampleProject" || len(testReaper.config.GetResources()) != 0 || !reflect.DeepEqual(testReaper.Schedule, expectedSchedule) {
+		t.Error("Reaper should not be updated from a config with an invalid schedule")
+	}
+}
+
+func TestUpdateReaperConfigInvalidCredentials(t *testing.T) {
+	testReaper := createTestReaper("SampleProject", "* * * * *")
+	invalidCredentials := []*reaperconfig.Credentials{
+		&reaperconfig.Credentials{CredentialsFile: "missing-key.json"},
+		&reaperconfig.Credentials{ImpersonateServiceAccount: "reaper"},
+	}
+	for _, credentials := range invalidCredentials {
+		config := createReaperConfig("SampleProject", "* * * * *")
+		config.Credentials = credentials
+		if err := testReaper.UpdateReaperConfig(config); err == nil {
+			t.Errorf("Expected credentials %v to be rejected", credentials)
+		}
+	}
+
+	config := createReaperConfig("SampleProject", "* * * * *")
+	config.Credentials = &reaperconfig.Credentials{ImpersonateServiceAccount: "reaper@project.iam.gserviceaccount.com"}
+	if err := testReaper.UpdateReaperConfig(config); err != nil {
+		t.Errorf("Expected valid credentials to be accepted, got: %v", err)
+	}
+}
+
+func TestUpdateReaperConfigProjectAllowlist(t *testing.T) {
+	defer resourcemanager.SetAllowedFolders(nil)
+	testReaper := createTestReaper("SampleProject", "* * * * *")
+	config := createReaperConfig(
+		"SampleProject", "* * * * *", createResourceConfig(reaperconfig.ResourceType_PROJECT, "test-", "", "1h", "folders/10"),
+	)
+	if err := testReaper.UpdateReaperConfig(config); err == nil {
+		t.Error("Expected project config to be rejected without an allowlist")
+	}
+
+	resourcemanager.SetAllowedFolders([]string{"folders/10"})
+	if err := testReaper.UpdateReaperConfig(config); err != nil {
+		t.Errorf("Expected project config in an allowed folder to be accepted, got: %v", err)
+	}
+	config.Resources[0].Zones = append(config.Resources[0].Zones, "folders/11")
+	if err := testReaper.UpdateReaperConfig(config); err == nil {
+		t.Error("Expected project config with a folder not on the allowlist to be rejected")
+	}
+}
+
 type GetResourcesTestCase struct {
 	ReaperConfig *reaperconfig.ReaperConfig
 	Expected     *Reaper
@@ -223,6 +816,316 @@ func TestGetResources(t *testing.T) {
 	}
 }
 
+func TestGetResourcesMergesDeterministically(t *testing.T) {
+	server := createServer(getComputeEngineResourcesHandler)
+	defer server.Close()
+	testClientOptions := getTestClientOptions(server)
+
+	setupTestData()
+	config := createReaperConfig(
+		"sampleProject", "* * * * *",
+		createResourceConfig(reaperconfig.ResourceType_GCE_VM, "Test", "", "1h", "testZone1", "testZone2"),
+		createResourceConfig(reaperconfig.ResourceType_GCE_VM, "Name", "", "2h", "testZone2", "testZone1"),
+		createResourceConfig(reaperconfig.ResourceType_GCE_VM, "Test", "", "30m", "testZone1"),
+	)
+	expectedNames := []string{"TestName", "TestingYetAnotherOne", "TestThis", "IsThisAnotherName", "AnotherName"}
+	expectedTTLs := map[string]string{
+		"TestName":             "2h",
+		"TestingYetAnotherOne": "1h",
+		"TestThis":             "1h",
+		"IsThisAnotherName":    "2h",
+		"AnotherName":          "2h",
+	}
+
+	for run := 0; run < 10; run++ {
+		testReaper := &Reaper{config: config, ProjectID: config.GetProjectId()}
+		testReaper.GetResources(testContext, testClientOptions...)
+
+		var names []string
+		for _, watchedResource := range testReaper.Watchlist {
+			names = append(names, watchedResource.Name)
+			if expectedTTL := expectedTTLs[watchedResource.Name]; watchedResource.TTL != expectedTTL {
+				t.Errorf("Resource %s has TTL %s; want %s", watchedResource.Name, watchedResource.TTL, expectedTTL)
+			}
+		}
+		if !reflect.DeepEqual(names, expectedNames) {
+			t.Fatalf("Watchlist order = %v; want %v", names, expectedNames)
+		}
+	}
+}
+
+func TestGetResourcesZoneFailure(t *testing.T) {
+	server := createServer(func(w http.ResponseWriter, req *http.Request) {
+		if strings.Contains(req.URL.Path, "/failingZone/") {
+			http.Error(w, "backend error", http.StatusServiceUnavailable)
+			return
+		}
+		getComputeEngineResourcesHandler(w, req)
+	})
+	defer server.Close()
+	testClientOptions := getTestClientOptions(server)
+
+	setupTestData()
+	previouslyWatched := resources.NewWatchedResource(
+		resources.NewResource("TestInFailingZone", "failingZone", currentTime, reaperconfig.ResourceType_GCE_VM), "1h",
+	)
+	testReaper := createTestReaper("sampleProject", "* * * * *", previouslyWatched)
+	testReaper.retryPolicy = &clients.RetryPolicy{MaxAttempts: 1}
+	testReaper.config = createReaperConfig(
+		"sampleProject", "* * * * *",
+		createResourceConfig(reaperconfig.ResourceType_GCE_VM, "Test", "", "1h", "testZone1", "failingZone", "testZone2"),
+	)
+	testReaper.GetResources(testContext, testClientOptions...)
+
+	expected := createTestReaper("sampleProject", "* * * * *", resources.CreateWatchlist(
+		[]*resources.Resource{
+			resources.NewResource("TestName", "testZone1", currentTime, reaperconfig.ResourceType_GCE_VM),
+			resources.NewResource("TestingYetAnotherOne", "testZone1", currentTime, reaperconfig.ResourceType_GCE_VM),
+			resources.NewResource("TestInFailingZone", "failingZone", currentTime, reaperconfig.ResourceType_GCE_VM),
+			resources.NewResource("TestThis", "testZone2", currentTime, reaperconfig.ResourceType_GCE_VM),
+		},
+		"1h",
+	)...)
+	if !areWatchlistsEqual(testReaper, expected) {
+		t.Errorf("Expected the other zones to be listed and the failed zone's resources to be kept, got: %s", testReaper.WatchlistString())
+	}
+
+	listingErrors := testReaper.ListingErrors()
+	if _, failed := listingErrors["sampleProject/GCE_VM/failingZone"]; !failed || len(listingErrors) != 1 {
+		t.Errorf("Expected only sampleProject/GCE_VM/failingZone to fail, got: %v", listingErrors)
+	}
+	reported := testReaper.Status().GetLastSweep().GetListingErrors()
+	if len(reported) != 1 || reported[0].GetProjectId() != "sampleProject" || reported[0].GetResourceType() != reaperconfig.ResourceType_GCE_VM ||
+		reported[0].GetZone() != "failingZone" || len(reported[0].GetError()) == 0 {
+		t.Errorf("Expected the failed zone to be reported in the status, got: %v", reported)
+	}
+}
+
+func TestGetResourcesInvalidProjectCreateTime(t *testing.T) {
+	resourcemanager.SetAllowedFolders([]string{"folders/10"})
+	defer resourcemanager.SetAllowedFolders(nil)
+	server := createServer(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"projects": [
+			{"projectId": "test-valid", "createTime": "2020-06-17T10:00:00Z", "lifecycleState": "ACTIVE", "parent": {"type": "folder", "id": "10"}},
+			{"projectId": "test-empty", "lifecycleState": "ACTIVE", "parent": {"type": "folder", "id": "10"}},
+			{"projectId": "test-malformed", "createTime": "not a time", "lifecycleState": "ACTIVE", "parent": {"type": "folder", "id": "10"}}
+		]}`))
+	})
+	defer server.Close()
+
+	testReaper := NewReaper()
+	config := createReaperConfig(
+		"sampleProject", "* * * * *", createResourceConfig(reaperconfig.ResourceType_PROJECT, "test-", "", "1h", "folders/10"),
+	)
+	if err := testReaper.UpdateReaperConfig(config); err != nil {
+		t.Fatalf("Update reaper config failed: %v", err)
+	}
+	testReaper.GetResources(testContext, getTestClientOptions(server)...)
+
+	if len(testReaper.Watchlist) != 1 || testReaper.Watchlist[0].Name != "test-valid" {
+		t.Errorf("Expected only the project with a valid create time to be watched, got: %s", testReaper.WatchlistString())
+	}
+	if _, failed := testReaper.ListingErrors()["sampleProject/PROJECT/folders/10"]; !failed {
+		t.Errorf("Expected the invalid create times to be reported, got: %v", testReaper.ListingErrors())
+	}
+}
+
+func TestMultiProjectReaper(t *testing.T) {
+	var deletes []string
+	var deletesMux sync.Mutex
+	server := createServer(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case req.URL.Path == "/v1/projects":
+			w.Write([]byte(`{"projects": [{"projectId": "folderProject"}, {"projectId": "sampleProject"}]}`))
+		case req.URL.Path == "/v2/folders":
+			w.Write([]byte(`{"folders": []}`))
+		case req.Method == http.MethodDelete:
+			deletesMux.Lock()
+			deletes = append(deletes, req.URL.Path)
+			deletesMux.Unlock()
+			deleteComputeEngineResourceHandler(w, req)
+		default:
+			getComputeEngineResourcesHandler(w, req)
+		}
+	})
+	defer server.Close()
+	testClientOptions := getTestClientOptions(server)
+
+	setupTestData()
+	testData["folderProject"] = map[reaperconfig.ResourceType]map[string][]TestData{
+		reaperconfig.ResourceType_GCE_VM: {
+			"testZone1": []TestData{TestData{"TestInFolder", earlyTime.Format(time.RFC3339)}},
+		},
+	}
+	config := createReaperConfig(
+		"sampleProject", "* * * * *",
+		createResourceConfig(reaperconfig.ResourceType_GCE_VM, "Test", "", "1h", "testZone1"),
+	)
+	config.ProjectParent = "folders/10"
+	testReaper := NewReaper()
+	if err := testReaper.UpdateReaperConfig(config); err != nil {
+		t.Fatalf("Update reaper config failed: %v", err)
+	}
+
+	testReaper.GetResources(testContext, testClientOptions...)
+	if expectedProjects := []string{"sampleProject", "folderProject"}; !reflect.DeepEqual(testReaper.ProjectIDs, expectedProjects) {
+		t.Errorf("Expected projects %v, got %v", expectedProjects, testReaper.ProjectIDs)
+	}
+	for _, watchedResource := range testReaper.Watchlist {
+		expectedProject := "sampleProject"
+		if watchedResource.Name == "TestInFolder" {
+			expectedProject = "folderProject"
+		}
+		if watchedResource.ProjectID != expectedProject {
+			t.Errorf("Resource %s should be in project %s, got %s", watchedResource.Name, expectedProject, watchedResource.ProjectID)
+		}
+	}
+
+	testReaper.FreezeTime(currentTime)
+	testReaper.SweepThroughResources(testContext, testClientOptions...)
+	expectedDeletes := []string{"/folderProject/zones/testZone1/instances/TestInFolder"}
+	if !reflect.DeepEqual(deletes, expectedDeletes) {
+		t.Errorf("Expected deletes %v, got %v", expectedDeletes, deletes)
+	}
+	expectedSweeps := map[string]SweepSummary{"folderProject": SweepSummary{Deleted: 1}}
+	if !reflect.DeepEqual(testReaper.LastSweepByProject(), expectedSweeps) {
+		t.Errorf("Expected sweeps by project %v, got %v", expectedSweeps, testReaper.LastSweepByProject())
+	}
+	projects := testReaper.Status().GetLastSweep().GetProjects()
+	if len(projects) != 1 || projects[0].GetProjectId() != "folderProject" || projects[0].GetDeleted() != 1 {
+		t.Errorf("Expected the status to report one deletion in folderProject, got %v", projects)
+	}
+}
+
+func TestResourceKeyIncludesGeneration(t *testing.T) {
+	liveObject := resources.NewResource("object", "bucket", currentTime, reaperconfig.ResourceType_GCS_OBJECT)
+	liveObject.Generation = 2
+	noncurrentObject := resources.NewResource("object", "bucket", earlyTime, reaperconfig.ResourceType_GCS_OBJECT)
+	noncurrentObject.Generation = 1
+	if resourceKey(liveObject) == resourceKey(noncurrentObject) {
+		t.Error("Generations of the same object should be watched separately")
+	}
+}
+
+func TestLifecycleRulesReaper(t *testing.T) {
+	var requests []string
+	bucketRules := json.RawMessage(`[]`)
+	server := createServer(func(w http.ResponseWriter, req *http.Request) {
+		requests = append(requests, req.Method+" "+req.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		if req.Method == http.MethodPatch {
+			var update struct {
+				Lifecycle struct {
+					Rule json.RawMessage `json:"rule"`
+				} `json:"lifecycle"`
+			}
+			json.NewDecoder(req.Body).Decode(&update)
+			bucketRules = update.Lifecycle.Rule
+		}
+		w.Write([]byte(fmt.Sprintf(`{"metageneration": "1", "lifecycle": {"rule": %s}}`, bucketRules)))
+	})
+	defer server.Close()
+
+	objectConfig := createResourceConfig(reaperconfig.ResourceType_GCS_OBJECT, "test", "", "P2D", "test-bucket")
+	objectConfig.UseLifecycleRules = true
+	testReaper := NewReaper()
+	if err := testReaper.UpdateReaperConfig(createReaperConfig("sampleProject", "* * * * *", objectConfig)); err == nil {
+		t.Error("Expected an unanchored name filter to be rejected for lifecycle rules")
+	}
+
+	objectConfig.NameFilter = "^test"
+	config := createReaperConfig("sampleProject", "* * * * *", objectConfig)
+	config.DryRun = true
+	if err := testReaper.UpdateReaperConfig(config); err != nil {
+		t.Fatalf("Update reaper config failed: %v", err)
+	}
+	testReaper.GetResources(testContext, getTestClientOptions(server)...)
+
+	if expected := []string{"GET /b/test-bucket"}; !reflect.DeepEqual(requests, expected) {
+		t.Errorf("Expected only the bucket's lifecycle rules to be read in dry run mode, got requests %v", requests)
+	}
+	if len(testReaper.Watchlist) != 0 {
+		t.Error("Objects managed through lifecycle rules should not be watched")
+	}
+	drift := testReaper.Status().GetLifecycleDrift()
+	if len(drift) != 1 || drift[0].GetBucket() != "test-bucket" || len(drift[0].GetMissing()) != 1 || len(drift[0].GetExtra()) != 0 {
+		t.Errorf("Expected one missing lifecycle rule to be reported, got %v", drift)
+	}
+	if len(testReaper.lifecycleRules) != 0 {
+		t.Error("Lifecycle rules should not be recorded as applied in dry run mode")
+	}
+
+	config.DryRun = false
+	if err := testReaper.UpdateReaperConfig(config); err != nil {
+		t.Fatalf("Update reaper config failed: %v", err)
+	}
+	testReaper.GetResources(testContext, getTestClientOptions(server)...)
+	expectedRules := map[string][]gcs.LifecycleRule{"test-bucket": {{AgeDays: 2, Prefixes: []string{"test"}}}}
+	if !reflect.DeepEqual(testReaper.lifecycleRules, expectedRules) {
+		t.Errorf("Expected applied lifecycle rules %v, got %v", expectedRules, testReaper.lifecycleRules)
+	}
+	restoredReaper, err := NewReaperFromState(testReaper.State())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(restoredReaper.lifecycleRules, expectedRules) {
+		t.Errorf("Expected restored lifecycle rules %v, got %v", expectedRules, restoredReaper.lifecycleRules)
+	}
+
+	// Once lifecycle rules are no longer used, the rules the reaper applied are removed.
+	objectConfig.UseLifecycleRules = false
+	if err := restoredReaper.UpdateReaperConfig(config); err != nil {
+		t.Fatalf("Update reaper config failed: %v", err)
+	}
+	restoredReaper.GetResources(testContext, getTestClientOptions(server)...)
+	if string(bucketRules) != "[]" || len(restoredReaper.lifecycleRules) != 0 {
+		t.Errorf("Expected the applied lifecycle rules to be removed, got bucket rules %s", bucketRules)
+	}
+
+	objectConfig.UseLifecycleRules = true
+	if err := restoredReaper.UpdateReaperConfig(config); err != nil {
+		t.Fatalf("Update reaper config failed: %v", err)
+	}
+	restoredReaper.GetResources(testContext, getTestClientOptions(server)...)
+	if string(bucketRules) == "[]" {
+		t.Fatal("Expected the lifecycle rules to be applied again")
+	}
+	restoredReaper.RemoveLifecycleRules(testContext, getTestClientOptions(server)...)
+	if string(bucketRules) != "[]" || len(restoredReaper.lifecycleRules) != 0 {
+		t.Errorf("Expected the applied lifecycle rules to be removed when the reaper is deleted, got bucket rules %s", bucketRules)
+	}
+}
+
+func TestReaperStateRoundTrip(t *testing.T) {
+	testReaper := NewReaper()
+	if err := testReaper.UpdateReaperConfig(createReaperConfig("sampleProject", "@every 1h")); err != nil {
+		t.Fatal(err)
+	}
+	object := resources.NewResource("test-object", "test-bucket", time.Date(2020, 6, 17, 10, 0, 0, 0, time.UTC), reaperconfig.ResourceType_GCS_OBJECT)
+	object.ProjectID = "sampleProject"
+	object.Labels = map[string]string{resources.MarkLabel: "1592388000"}
+	object.Generation = 3
+	testReaper.Watchlist = []*resources.WatchedResource{resources.NewWatchedResource(object, "6h")}
+	testReaper.lastRun = time.Date(2020, 6, 18, 10, 0, 0, 0, time.UTC)
+	testReaper.markedResources = map[string]bool{resourceKey(object): true}
+
+	restoredReaper, err := NewReaperFromState(testReaper.State())
+	if err != nil {
+		t.Fatalf("NewReaperFromState failed with the following error: %s", err.Error())
+	}
+	if restoredReaper.UUID != testReaper.UUID || !restoredReaper.lastRun.Equal(testReaper.lastRun) {
+		t.Errorf("Expected reaper %s last run at %v, got reaper %s last run at %v", testReaper.UUID, testReaper.lastRun, restoredReaper.UUID, restoredReaper.lastRun)
+	}
+	if len(restoredReaper.Watchlist) != 1 || !reflect.DeepEqual(restoredReaper.Watchlist[0], testReaper.Watchlist[0]) {
+		t.Errorf("Expected watchlist %s, got %s", testReaper.WatchlistString(), restoredReaper.WatchlistString())
+	}
+	if !reflect.DeepEqual(restoredReaper.markedResources, testReaper.markedResources) {
+		t.Errorf("Expected marked resources %v, got %v", testReaper.markedResources, restoredReaper.markedResources)
+	}
+}
+
 type RunScheduleTestCase struct {
 	Schedule string
 	LastRun  time.Time
@@ -250,11 +1153,11 @@ func TestRunOnSchedule(t *testing.T) {
 }
 
 func createServer(handler http.HandlerFunc) *httptest.Server {
-	return httptest.NewServer(http.HandlerFunc(handler))
+	return httptest.NewServer(utils.BatchHandler(handler))
 }
 
 func deleteComputeEngineResourceHandler(w http.ResponseWriter, req *http.Request) {
-	w.Write([]byte(`{"success": true}`))
+	w.Write([]byte(`{"success": true, "status": "DONE"}`))
 }
 
 type GetResourcesResponse struct {
@@ -0,0 +1,126 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reaper
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+)
+
+// State returns the reaper's config, the time it last ran, its Watchlist, the resources it
+// marked, the resources that were rescued and the lifecycle rules it applied, which are
+// persisted so that the reaper can be restored after the reaper manager restarts.
+func (reaper *Reaper) State() *reaperconfig.ReaperState {
+	state := &reaperconfig.ReaperState{
+		Config:           reaper.config,
+		LifecycleRules:   lifecycleRulesProto(reaper.lifecycleRules),
+		MarkedResources:  sortedKeys(reaper.markedResources),
+		RescuedResources: sortedKeys(reaper.rescuedResources),
+	}
+	if !reaper.lastRun.IsZero() {
+		state.LastRun = timestampProto(reaper.lastRun)
+	}
+	for _, watchedResource := range reaper.Watchlist {
+		state.Watchlist = append(state.Watchlist, watchedResourceProto(watchedResource))
+	}
+	return state
+}
+
+// Status returns the reaper's config, the time it last ran, the summary of its last sweep,
+// the size of its Watchlist, whether it is tripped and its lifecycle rule drift. The time it
+// next runs is left to be filled in with NextRun when the status is read.
+func (reaper *Reaper) Status() *reaperconfig.ReaperStatus {
+	status := &reaperconfig.ReaperStatus{
+		Config:         reaper.config,
+		LastSweep:      reaper.LastSweepReport(),
+		WatchlistSize:  uint32(len(reaper.Watchlist)),
+		Paused:         reaper.IsPaused(),
+		Tripped:        reaper.tripped,
+		LifecycleDrift: lifecycleDriftProto(reaper.lifecycleDrift),
+	}
+	if !reaper.lastRun.IsZero() {
+		status.LastRun = timestampProto(reaper.lastRun)
+	}
+	return status
+}
+
+// NextRun returns the next time the reaper's schedule runs it.
+func (reaper *Reaper) NextRun() time.Time {
+	return reaper.Schedule.Next(reaper.Clock.Now())
+}
+
+// NewReaperFromState constructs a reaper from its persisted state.
+func NewReaperFromState(state *reaperconfig.ReaperState) (*Reaper, error) {
+	reaper := NewReaper()
+	if err := reaper.UpdateReaperConfig(state.GetConfig()); err != nil {
+		return nil, fmt.Errorf("restoring reaper %s failed with the following error: %s", state.GetConfig().GetUuid(), err.Error())
+	}
+	if state.GetLastRun() != nil {
+		lastRun, err := ptypes.Timestamp(state.GetLastRun())
+		if err != nil {
+			return nil, fmt.Errorf("restoring reaper %s failed with the following error: %s", reaper.UUID, err.Error())
+		}
+		reaper.lastRun = lastRun
+	}
+	for _, resourceProto := range state.GetWatchlist() {
+		watchedResource, err := watchedResourceFromProto(resourceProto)
+		if err != nil {
+			return nil, fmt.Errorf("restoring reaper %s failed with the following error: %s", reaper.UUID, err.Error())
+		}
+		reaper.Watchlist = append(reaper.Watchlist, watchedResource)
+	}
+	reaper.lifecycleRules = lifecycleRulesFromProto(state.GetLifecycleRules())
+	reaper.markedResources = make(map[string]bool)
+	for _, key := range state.GetMarkedResources() {
+		reaper.markedResources[key] = true
+	}
+	reaper.rescuedResources = make(map[string]bool)
+	for _, key := range state.GetRescuedResources() {
+		reaper.rescuedResources[key] = true
+	}
+	return reaper, nil
+}
+
+// sortedKeys returns the keys of a set of resource keys in sorted order, so that the
+// persisted state does not depend on map iteration order.
+func sortedKeys(keySet map[string]bool) []string {
+	var keys []string
+	for key := range keySet {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// watchedResourceFromProto converts the proto representation of a WatchedResource back
+// into a WatchedResource.
+func watchedResourceFromProto(resourceProto *reaperconfig.WatchedResource) (*resources.WatchedResource, error) {
+	timeCreated, err := ptypes.Timestamp(resourceProto.GetTimeCreated())
+	if err != nil {
+		return nil, fmt.Errorf("invalid time created for %s: %v", resourceProto.GetName(), err)
+	}
+	resource := resources.NewResource(resourceProto.GetName(), resourceProto.GetZone(), timeCreated, resourceProto.GetResourceType())
+	resource.ProjectID = resourceProto.GetProjectId()
+	resource.Labels = resourceProto.GetLabels()
+	resource.Protected = resourceProto.GetProtected()
+	resource.Generation = resourceProto.GetGeneration()
+	resource.ForceDelete = resourceProto.GetForceDelete()
+	return resources.NewWatchedResource(resource, resourceProto.GetTtl()), nil
+}
@@ -0,0 +1,308 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reaper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/clients"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/clients/batch"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/logger"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/pkg/resources"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"google.golang.org/api/option"
+)
+
+// defaultMaxConcurrency is the number of workers used for a resource type that
+// has no concurrency limit set in the ReaperConfig, and no default below.
+const defaultMaxConcurrency = 10
+
+// defaultConcurrencyLimits are the number of workers used for each resource type
+// when the ReaperConfig does not set a concurrency limit for it.
+var defaultConcurrencyLimits = map[reaperconfig.ResourceType]int{
+	reaperconfig.ResourceType_GCE_VM:     10,
+	reaperconfig.ResourceType_GCS_BUCKET: 10,
+	reaperconfig.ResourceType_GCS_OBJECT: 50,
+}
+
+// deleteBatchSizes are the max number of resources of each type deleted in a single batch
+// request. Resource types without a batch size are deleted one at a time.
+var deleteBatchSizes = map[reaperconfig.ResourceType]int{
+	reaperconfig.ResourceType_GCE_VM:     batch.MaxRequests,
+	reaperconfig.ResourceType_GCS_OBJECT: batch.MaxRequests,
+}
+
+// sweepTask is a single mark or delete of a watched resource done by a sweep worker.
+// The error, or whether the resource was skipped because it is protected, is set by
+// the worker once the task is done. Tasks that were not done because the sweep was
+// stopped, by cancelling its context or pausing the reaper, are set as stopped instead.
+type sweepTask struct {
+	watchedResource *resources.WatchedResource
+	mark            bool
+	markedAt        time.Time
+	attemptedAt     time.Time
+	skipped         bool
+	stopped         bool
+	err             error
+}
+
+// runSweepTasks runs the given tasks with a bounded pool of workers for each resource
+// type, and returns once all tasks are done. Deletes of resource types that support
+// batching are grouped into batches, and each worker runs a single batch at a time.
+// Once the context is cancelled or the reaper is paused, the workers stop taking batches,
+// and the remaining tasks are set as stopped.
+func (reaper *Reaper) runSweepTasks(ctx context.Context, tasks []*sweepTask, resourceClients *clientCache) {
+	tasksByType := make(map[reaperconfig.ResourceType][]*sweepTask)
+	for _, task := range tasks {
+		resourceType := task.watchedResource.Type
+		tasksByType[resourceType] = append(tasksByType[resourceType], task)
+	}
+
+	var wg sync.WaitGroup
+	for resourceType, typeTasks := range tasksByType {
+		batches := reaper.batchSweepTasks(typeTasks, deleteBatchSizes[resourceType])
+		batchQueue := make(chan []*sweepTask, len(batches))
+		for _, taskBatch := range batches {
+			batchQueue <- taskBatch
+		}
+		close(batchQueue)
+
+		numWorkers := reaper.concurrencyLimit(resourceType)
+		if numWorkers > len(batches) {
+			numWorkers = len(batches)
+		}
+		for worker := 0; worker < numWorkers; worker++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for taskBatch := range batchQueue {
+					if reaper.sweepStopped(ctx) {
+						for _, task := range taskBatch {
+							task.stopped = true
+						}
+						continue
+					}
+					if len(taskBatch) == 1 {
+						reaper.runSweepTask(ctx, taskBatch[0], resourceClients)
+					} else {
+						reaper.runDeleteBatch(ctx, taskBatch, resourceClients)
+					}
+				}
+			}()
+		}
+	}
+	wg.Wait()
+}
+
+// sweepStopped returns whether the sweep should stop before its next mark or delete, because
+// its context was cancelled or the reaper was paused.
+func (reaper *Reaper) sweepStopped(ctx context.Context) bool {
+	return ctx.Err() != nil || reaper.IsPaused()
+}
+
+// batchSweepTasks groups the delete tasks of each project into batches of at most the given
+// size. Every mark task, and every delete task if the batch size is at most one, is a batch
+// on its own.
+func (reaper *Reaper) batchSweepTasks(tasks []*sweepTask, batchSize int) [][]*sweepTask {
+	var batches [][]*sweepTask
+	var projectIDs []string
+	deleteBatches := make(map[string][]*sweepTask)
+	for _, task := range tasks {
+		if task.mark || batchSize <= 1 {
+			batches = append(batches, []*sweepTask{task})
+			continue
+		}
+		projectID := reaper.resourceProject(task.watchedResource.Resource)
+		if _, exists := deleteBatches[projectID]; !exists {
+			projectIDs = append(projectIDs, projectID)
+		}
+		deleteBatches[projectID] = append(deleteBatches[projectID], task)
+		if len(deleteBatches[projectID]) == batchSize {
+			batches = append(batches, deleteBatches[projectID])
+			deleteBatches[projectID] = nil
+		}
+	}
+	for _, projectID := range projectIDs {
+		if len(deleteBatches[projectID]) > 0 {
+			batches = append(batches, deleteBatches[projectID])
+		}
+	}
+	return batches
+}
+
+// runDeleteBatch deletes the resources of a batch of delete tasks, which are all in the same
+// project, in a single batch request if the resource client supports it, and records the
+// result of each delete on its task.
+func (reaper *Reaper) runDeleteBatch(ctx context.Context, tasks []*sweepTask, resourceClients *clientCache) {
+	resourceClient, err := resourceClients.get(tasks[0].watchedResource.Type)
+	if err != nil {
+		logger.Error(err)
+		attemptedAt := reaper.Clock.Now()
+		for _, task := range tasks {
+			task.attemptedAt = attemptedAt
+			task.err = err
+		}
+		return
+	}
+	batchDeleter, isBatchDeleter := resourceClient.(clients.BatchDeleter)
+	if !isBatchDeleter {
+		for _, task := range tasks {
+			reaper.runSweepTask(ctx, task, resourceClients)
+		}
+		return
+	}
+
+	resourcesToDelete := make([]*resources.Resource, len(tasks))
+	for idx, task := range tasks {
+		resourcesToDelete[idx] = task.watchedResource.Resource
+	}
+	errs := batchDeleter.DeleteResources(reaper.resourceProject(resourcesToDelete[0]), resourcesToDelete)
+	for idx, task := range tasks {
+		reaper.recordDelete(ctx, task, errs[idx])
+	}
+}
+
+// runSweepTask marks or deletes the resource of a single task, and records any error on the task.
+// The task is not run if the sweep was already stopped.
+func (reaper *Reaper) runSweepTask(ctx context.Context, task *sweepTask, resourceClients *clientCache) {
+	if reaper.sweepStopped(ctx) {
+		task.stopped = true
+		return
+	}
+	watchedResource := task.watchedResource
+	resourceClient, err := resourceClients.get(watchedResource.Type)
+	if err != nil {
+		logger.Error(err)
+		task.attemptedAt = reaper.Clock.Now()
+		task.err = err
+		return
+	}
+
+	if task.mark {
+		if err := resourceClient.MarkResource(reaper.resourceProject(watchedResource.Resource), watchedResource.Resource, task.markedAt); err != nil {
+			if ctx.Err() != nil {
+				task.stopped = true
+				return
+			}
+			task.err = fmt.Errorf(
+				"%s client failed to mark resource %s with the following error: %s",
+				watchedResource.Type.String(), watchedResource.Name, err.Error(),
+			)
+			logger.Error(task.err)
+			return
+		}
+		logger.Logf(
+			"Marked %s resource %s in zone %s for deletion\n",
+			watchedResource.Type.String(), watchedResource.Name, watchedResource.Zone,
+		)
+		return
+	}
+
+	reaper.recordDelete(ctx, task, resourceClient.DeleteResource(reaper.resourceProject(watchedResource.Resource), watchedResource.Resource))
+}
+
+// recordDelete records the result of deleting the resource of a task on the task, along with
+// the time the delete finished, and logs it. A resource that is protected from deletion is
+// recorded as skipped rather than failed, and a delete that failed because the sweep was
+// stopped is recorded as stopped.
+func (reaper *Reaper) recordDelete(ctx context.Context, task *sweepTask, err error) {
+	task.attemptedAt = reaper.Clock.Now()
+	watchedResource := task.watchedResource
+	if errors.Is(err, resources.ErrUndeletable) {
+		task.skipped = true
+		logger.Logf(
+			"Skipping %s resource %s in zone %s: %s\n",
+			watchedResource.Type.String(), watchedResource.Name, watchedResource.Zone, err.Error(),
+		)
+		return
+	}
+	if err != nil && ctx.Err() != nil {
+		task.stopped = true
+		logger.Logf(
+			"Stopped deleting %s resource %s in zone %s, since the sweep was stopped\n",
+			watchedResource.Type.String(), watchedResource.Name, watchedResource.Zone,
+		)
+		return
+	}
+	if err != nil {
+		task.err = fmt.Errorf(
+			"%s client failed to delete resource %s with the following error: %s",
+			watchedResource.Type.String(), watchedResource.Name, err.Error(),
+		)
+		logger.Error(task.err)
+		return
+	}
+	logger.Logf(
+		"Deleted %s resource %s in zone %s\n",
+		watchedResource.Type.String(), watchedResource.Name, watchedResource.Zone,
+	)
+}
+
+// concurrencyLimit returns the max number of workers the reaper uses for a resource type.
+func (reaper *Reaper) concurrencyLimit(resourceType reaperconfig.ResourceType) int {
+	for _, limit := range reaper.config.GetConcurrencyLimits() {
+		if limit.GetResourceType() == resourceType && limit.GetMaxConcurrency() > 0 {
+			return int(limit.GetMaxConcurrency())
+		}
+	}
+	if limit, hasDefault := defaultConcurrencyLimits[resourceType]; hasDefault {
+		return limit
+	}
+	return defaultMaxConcurrency
+}
+
+// clientCache holds one authenticated client per resource type, so that a client is only
+// created and authenticated once per sweep. It is safe for concurrent use.
+type clientCache struct {
+	ctx           context.Context
+	reaper        *Reaper
+	clientOptions []option.ClientOption
+
+	mux     sync.Mutex
+	clients map[reaperconfig.ResourceType]*cachedClient
+}
+
+// cachedClient is the result of creating and authenticating a client.
+type cachedClient struct {
+	client clients.Client
+	err    error
+}
+
+// newClientCache creates an empty clientCache.
+func newClientCache(ctx context.Context, reaper *Reaper, clientOptions ...option.ClientOption) *clientCache {
+	return &clientCache{
+		ctx:           ctx,
+		reaper:        reaper,
+		clientOptions: clientOptions,
+		clients:       make(map[reaperconfig.ResourceType]*cachedClient),
+	}
+}
+
+// get returns the authenticated client for the given resource type, creating it if needed.
+// If creating the client failed, the same error is returned for every call.
+func (cache *clientCache) get(resourceType reaperconfig.ResourceType) (clients.Client, error) {
+	cache.mux.Lock()
+	defer cache.mux.Unlock()
+	if cached, exists := cache.clients[resourceType]; exists {
+		return cached.client, cached.err
+	}
+	resourceClient, err := getAuthedClient(cache.ctx, cache.reaper, resourceType, cache.clientOptions...)
+	cache.clients[resourceType] = &cachedClient{resourceClient, err}
+	return resourceClient, err
+}
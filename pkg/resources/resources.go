@@ -15,11 +15,15 @@
 package resources
 
 import (
+	"errors"
+	"fmt"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
-	"github.com/robfig/cron/v3"
 )
 
 // A Resource represents a single GCP resource instance of any
@@ -29,11 +33,96 @@ type Resource struct {
 	Zone        string
 	TimeCreated time.Time
 	Type        reaperconfig.ResourceType
+	// ProjectID is the GCP project the resource is in. Resources are always marked
+	// and deleted in their own project.
+	ProjectID string
+	// Labels are the labels of the resource. For GCS Objects these are the
+	// object's custom metadata.
+	Labels map[string]string
+	// Protected is set if GCP will refuse to delete the resource, such as a Compute
+	// Engine instance with deletion protection, or a GCS object under a hold. The
+	// reaper skips protected resources instead of trying to delete them.
+	Protected bool
+	// Generation is the generation of a GCS Object, which identifies a single version
+	// of the object. It is zero for other resource types.
+	Generation int64
+	// ForceDelete is set if the resource should be deleted along with everything in
+	// it, such as a GCS bucket along with all of its objects.
+	ForceDelete bool
 }
 
+// MarkLabel is the label the reaper adds to a resource that is past its TTL when
+// the reaper has a grace period. The value of the label is the time the resource
+// was marked, in seconds since the Unix epoch.
+const MarkLabel = "reaper-marked-at"
+
+// ZoneErrors is returned by a client's GetResources when listing failed in some, but
+// not necessarily all, zones of a ResourceConfig. It maps each failed zone to the
+// error listing it returned. The resources from the other zones are still returned
+// alongside it.
+type ZoneErrors map[string]error
+
+// Error returns the errors of all the failed zones, sorted by zone.
+func (zoneErrors ZoneErrors) Error() string {
+	var zones []string
+	for zone := range zoneErrors {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+
+	var errorStrings []string
+	for _, zone := range zones {
+		errorStrings = append(errorStrings, fmt.Sprintf("zone %s: %s", zone, zoneErrors[zone].Error()))
+	}
+	return fmt.Sprintf("failed to list resources in %d zones: %s", len(zones), strings.Join(errorStrings, "; "))
+}
+
+// SkipLabel is the label that opts a resource out of being reaped. Any resource with the
+// label set to "true" is never watched, regardless of the filters that match it. For GCS
+// Objects the label is a custom metadata key.
+const SkipLabel = "reaper-skip"
+
+// ErrUndeletable is returned by a client when it can not delete a resource because the
+// resource is protected. The reaper reports such resources as skipped rather than failed.
+var ErrUndeletable = errors.New("resource is protected from deletion")
+
 // NewResource constructs a Resource struct.
 func NewResource(name, zone string, timeCreated time.Time, resourceType reaperconfig.ResourceType) *Resource {
-	return &Resource{name, zone, timeCreated, resourceType}
+	return &Resource{Name: name, Zone: zone, TimeCreated: timeCreated, Type: resourceType}
+}
+
+// MarkedAt returns the time the resource was marked for deletion, and whether the
+// resource has a valid mark.
+func (resource *Resource) MarkedAt() (time.Time, bool) {
+	markValue, isMarked := resource.Labels[MarkLabel]
+	if !isMarked {
+		return time.Time{}, false
+	}
+	markSeconds, err := strconv.ParseInt(markValue, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(markSeconds, 0), true
+}
+
+// MarkValue returns the value of the MarkLabel for a resource marked at the given time.
+func MarkValue(markedAt time.Time) string {
+	return strconv.FormatInt(markedAt.Unix(), 10)
+}
+
+// HasLabels returns whether the resource has all of the given labels, with the same values.
+func (resource *Resource) HasLabels(labels map[string]string) bool {
+	for key, value := range labels {
+		if resourceValue, hasLabel := resource.Labels[key]; !hasLabel || resourceValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+// IsOptedOut returns whether the resource has opted out of being reaped with the SkipLabel.
+func (resource *Resource) IsOptedOut() bool {
+	return strings.EqualFold(resource.Labels[SkipLabel], "true")
 }
 
 // TimeAlive returns how long a resource has been running.
@@ -88,15 +177,24 @@ func (resource *WatchedResource) IsReadyForDeletion() bool {
 	return resource.clock.Now().After(deletionTime)
 }
 
+// IsPastGracePeriod returns whether a WatchedResource was marked for deletion, and the grace
+// period has passed since it was marked, based off the current time of the Clock.
+func (resource *WatchedResource) IsPastGracePeriod(gracePeriod TTL) bool {
+	markedAt, isMarked := resource.MarkedAt()
+	if !isMarked {
+		return false
+	}
+	return resource.clock.Now().After(gracePeriod.DeletionTime(markedAt))
+}
+
+// GetDeletionTime returns the time at which the WatchedResource should be deleted. See
+// ParseTTL for the accepted TTL formats.
 func (resource *WatchedResource) GetDeletionTime() (time.Time, error) {
-	// Using Cron time format doesn't give a duration, but instead a format of what the time should
-	// look like when deleting
-	schedule, err := cron.ParseStandard(resource.TTL)
+	ttl, err := ParseTTL(resource.TTL)
 	if err != nil {
 		return time.Time{}, err
 	}
-	return schedule.Next(resource.TimeCreated), nil
-
+	return ttl.DeletionTime(resource.TimeCreated), nil
 }
 
 // ShouldAddResourceToWatchlist determines whether a Resource should be watched
@@ -104,9 +202,10 @@ func (resource *WatchedResource) GetDeletionTime() (time.Time, error) {
 // ResourceConfig and ReaperConfig. If a resource matches both the skip filter
 // and name filter, then the skip filter wins and the resource will NOT be watched.
 // An empty string for the skip filter will be interpreted as unset, and therefore
-// will not match any resources.
+// will not match any resources. Resources that opted out with the SkipLabel are
+// never watched.
 func ShouldAddResourceToWatchlist(resource *Resource, nameFilter, skipFilter string) bool {
-	if len(nameFilter) == 0 {
+	if len(nameFilter) == 0 || resource.IsOptedOut() {
 		return false
 	}
 	resourceName := resource.Name
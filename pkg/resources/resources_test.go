@@ -73,6 +73,24 @@ var testShouldWatchCases = []ShouldWatchTestCase{
 		NewResource("testName", zone, currentTime, resourceType),
 		"", "", false,
 	},
+	ShouldWatchTestCase{
+		labeledResource("testName", map[string]string{SkipLabel: "true"}),
+		"test", "", false,
+	},
+	ShouldWatchTestCase{
+		labeledResource("testName", map[string]string{SkipLabel: "TRUE"}),
+		"test", "", false,
+	},
+	ShouldWatchTestCase{
+		labeledResource("testName", map[string]string{SkipLabel: "false"}),
+		"test", "", true,
+	},
+}
+
+func labeledResource(name string, labels map[string]string) *Resource {
+	resource := NewResource(name, zone, currentTime, resourceType)
+	resource.Labels = labels
+	return resource
 }
 
 // TestShouldAddResourceToWatchlist tests the ShouldAddResourceToWatchlist funcion.
@@ -101,6 +119,13 @@ var readyForDeletionTestCases = []ReadyForDeletionTestCase{
 	ReadyForDeletionTestCase{createTestWatchedResource(twoMinutesLater, "10 * * * *"), false},
 	ReadyForDeletionTestCase{createTestWatchedResource(lateTime, "* * * * *"), false},
 	ReadyForDeletionTestCase{createTestWatchedResource(lateTime, "1 5 * * *"), false},
+	ReadyForDeletionTestCase{createTestWatchedResource(twoMinutesAgo, "1m"), true},
+	ReadyForDeletionTestCase{createTestWatchedResource(twoMinutesAgo, "5m"), false},
+	ReadyForDeletionTestCase{createTestWatchedResource(earlyTime, "6h"), true},
+	ReadyForDeletionTestCase{createTestWatchedResource(twoMinutesAgo, "PT1M"), true},
+	ReadyForDeletionTestCase{createTestWatchedResource(twoMinutesAgo, "P2D"), false},
+	ReadyForDeletionTestCase{createTestWatchedResource(earlyTime, "P1Y2M3W4DT5H6M7S"), true},
+	ReadyForDeletionTestCase{createTestWatchedResource(twoMinutesAgo, "invalid TTL"), false},
 }
 
 func TestIsReadyForDeletion(t *testing.T) {
@@ -112,6 +137,85 @@ func TestIsReadyForDeletion(t *testing.T) {
 	}
 }
 
+type ParseTTLTestCase struct {
+	TTL          string
+	DeletionTime time.Time
+	ExpectError  bool
+}
+
+var parseTTLTestCases = []ParseTTLTestCase{
+	ParseTTLTestCase{"6h", currentTime.Add(6 * time.Hour), false},
+	ParseTTLTestCase{"1h30m", currentTime.Add(90 * time.Minute), false},
+	ParseTTLTestCase{"P2D", currentTime.AddDate(0, 0, 2), false},
+	ParseTTLTestCase{"PT6H", currentTime.Add(6 * time.Hour), false},
+	ParseTTLTestCase{"P1W", currentTime.AddDate(0, 0, 7), false},
+	ParseTTLTestCase{"P1M1DT1.5S", currentTime.AddDate(0, 1, 1).Add(1500 * time.Millisecond), false},
+	ParseTTLTestCase{"0 12 * * *", currentTime.Add(2 * time.Hour), false},
+	ParseTTLTestCase{"@every 1h", currentTime.Add(time.Hour), false},
+	ParseTTLTestCase{"-6h", time.Time{}, true},
+	ParseTTLTestCase{"0", time.Time{}, true},
+	ParseTTLTestCase{"0s", time.Time{}, true},
+	ParseTTLTestCase{"PT0S", time.Time{}, true},
+	ParseTTLTestCase{"P0D", time.Time{}, true},
+	ParseTTLTestCase{"P", time.Time{}, true},
+	ParseTTLTestCase{"P1DT", time.Time{}, true},
+	ParseTTLTestCase{"P2X", time.Time{}, true},
+	ParseTTLTestCase{"", time.Time{}, true},
+	ParseTTLTestCase{"not a ttl", time.Time{}, true},
+}
+
+func TestParseTTL(t *testing.T) {
+	for _, testCase := range parseTTLTestCases {
+		ttl, err := ParseTTL(testCase.TTL)
+		if testCase.ExpectError {
+			if err == nil {
+				t.Errorf("Expected TTL %q to be invalid", testCase.TTL)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parsing TTL %q failed with the following error: %v", testCase.TTL, err)
+			continue
+		}
+		if deletionTime := ttl.DeletionTime(currentTime); !deletionTime.Equal(testCase.DeletionTime) {
+			t.Errorf("TTL %q: expected deletion time %v, got %v", testCase.TTL, testCase.DeletionTime, deletionTime)
+		}
+	}
+}
+
+type TTLDaysTestCase struct {
+	TTL         string
+	Expected    int64
+	ExpectError bool
+}
+
+var ttlDaysTestCases = []TTLDaysTestCase{
+	TTLDaysTestCase{"48h", 2, false},
+	TTLDaysTestCase{"6h", 1, false},
+	TTLDaysTestCase{"P2D", 2, false},
+	TTLDaysTestCase{"P1W", 7, false},
+	TTLDaysTestCase{"P1DT1H", 2, false},
+	TTLDaysTestCase{"1s", 1, false},
+	TTLDaysTestCase{"P1M", 0, true},
+	TTLDaysTestCase{"0 5 * * *", 0, true},
+}
+
+func TestTTLDays(t *testing.T) {
+	for _, testCase := range ttlDaysTestCases {
+		ttl, err := ParseTTL(testCase.TTL)
+		if err != nil {
+			t.Fatalf("Parsing TTL %q failed with the following error: %v", testCase.TTL, err)
+		}
+		days, err := TTLDays(ttl)
+		if (err != nil) != testCase.ExpectError {
+			t.Errorf("TTL %q: returned error %v; expected error: %v", testCase.TTL, err, testCase.ExpectError)
+		}
+		if !testCase.ExpectError && days != testCase.Expected {
+			t.Errorf("TTL %q: expected %d days, got %d", testCase.TTL, testCase.Expected, days)
+		}
+	}
+}
+
 func createTestWatchedResource(creationTime time.Time, ttl string) *WatchedResource {
 	resource := NewWatchedResource(
 		NewResource("TestResource", zone, creationTime, resourceType),
@@ -120,3 +224,27 @@ func createTestWatchedResource(creationTime time.Time, ttl string) *WatchedResou
 	resource.FreezeClock(currentTime)
 	return resource
 }
+
+type GracePeriodTestCase struct {
+	Labels   map[string]string
+	Expected bool
+}
+
+var gracePeriodTestCases = []GracePeriodTestCase{
+	GracePeriodTestCase{nil, false},
+	GracePeriodTestCase{map[string]string{"owner": "tester"}, false},
+	GracePeriodTestCase{map[string]string{MarkLabel: "not a time"}, false},
+	GracePeriodTestCase{map[string]string{MarkLabel: MarkValue(twoMinutesAgo)}, true},
+	GracePeriodTestCase{map[string]string{MarkLabel: MarkValue(currentTime)}, false},
+}
+
+func TestIsPastGracePeriod(t *testing.T) {
+	gracePeriod, _ := ParseTTL("1m")
+	for _, testCase := range gracePeriodTestCases {
+		resource := createTestWatchedResource(earlyTime, "1m")
+		resource.Labels = testCase.Labels
+		if result := resource.IsPastGracePeriod(gracePeriod); result != testCase.Expected {
+			t.Errorf("Labels %v: expected %t, got %t", testCase.Labels, testCase.Expected, result)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resources
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// A TTL determines when a resource should be deleted based off of when
+// it was created. A TTL can either be a duration, in which case the
+// resource is deleted once it has been alive for that long, or a cron
+// time string, in which case the resource is deleted at the next window
+// matching the schedule after it was created.
+type TTL interface {
+	DeletionTime(timeCreated time.Time) time.Time
+}
+
+// durationTTL is a TTL that is a fixed amount of time after creation.
+// Years, months and days are kept separate from the duration so that they
+// are applied as calendar units.
+type durationTTL struct {
+	years, months, days int
+	duration            time.Duration
+}
+
+// DeletionTime returns the time created plus the duration of the TTL.
+func (ttl durationTTL) DeletionTime(timeCreated time.Time) time.Time {
+	return timeCreated.AddDate(ttl.years, ttl.months, ttl.days).Add(ttl.duration)
+}
+
+// scheduleTTL is a TTL that deletes the resource at the next window of a
+// cron schedule.
+type scheduleTTL struct {
+	schedule cron.Schedule
+}
+
+// DeletionTime returns the next time the schedule matches after the time created.
+func (ttl scheduleTTL) DeletionTime(timeCreated time.Time) time.Time {
+	return ttl.schedule.Next(timeCreated)
+}
+
+// TTLDays returns the TTL as a whole number of days, rounded up, for GCP features that only
+// support ages in days, such as GCS lifecycle rules. Only duration TTLs without years or
+// months can be converted, since cron TTLs and calendar units have no fixed length.
+func TTLDays(ttl TTL) (int64, error) {
+	duration, isDuration := ttl.(durationTTL)
+	if !isDuration || duration.years != 0 || duration.months != 0 {
+		return 0, fmt.Errorf("TTL can not be converted to a number of days")
+	}
+	const day = 24 * time.Hour
+	days := int64(duration.days) + int64(duration.duration/day)
+	if duration.duration%day != 0 {
+		days++
+	}
+	return days, nil
+}
+
+var iso8601Duration = regexp.MustCompile(
+	`^P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`,
+)
+
+// ParseTTL parses a TTL string. The following formats are accepted, and are
+// tried in order:
+//  - A Go duration string, such as "6h" or "90m".
+//  - An ISO-8601 duration, such as "P2D" or "PT6H".
+//  - A cron time string, such as "0 5 * * *", meaning the resource will be
+//    deleted at the next window matching the schedule after it was created.
+// Durations must be positive, since a zero TTL would delete resources as soon as
+// they are listed.
+func ParseTTL(ttl string) (TTL, error) {
+	if duration, err := time.ParseDuration(ttl); err == nil {
+		if duration <= 0 {
+			return nil, fmt.Errorf("TTL %s must be positive", ttl)
+		}
+		return durationTTL{duration: duration}, nil
+	}
+	if strings.HasPrefix(ttl, "P") {
+		return parseISO8601Duration(ttl)
+	}
+	schedule, err := cron.ParseStandard(ttl)
+	if err != nil {
+		return nil, fmt.Errorf("TTL %s is not a duration or a cron time string: %v", ttl, err)
+	}
+	return scheduleTTL{schedule}, nil
+}
+
+// parseISO8601Duration parses a duration of the form PnYnMnWnDTnHnMnS.
+func parseISO8601Duration(ttl string) (TTL, error) {
+	matches := iso8601Duration.FindStringSubmatch(ttl)
+	if matches == nil || ttl == "P" || strings.HasSuffix(ttl, "T") {
+		return nil, fmt.Errorf("TTL %s is not a valid ISO-8601 duration", ttl)
+	}
+
+	parsed := make([]int, 6)
+	for idx, match := range matches[1:7] {
+		if len(match) == 0 {
+			continue
+		}
+		value, err := strconv.Atoi(match)
+		if err != nil {
+			return nil, fmt.Errorf("TTL %s is not a valid ISO-8601 duration: %v", ttl, err)
+		}
+		parsed[idx] = value
+	}
+	years, months, weeks, days, hours, minutes := parsed[0], parsed[1], parsed[2], parsed[3], parsed[4], parsed[5]
+
+	var seconds time.Duration
+	if len(matches[7]) > 0 {
+		var err error
+		seconds, err = time.ParseDuration(matches[7] + "s")
+		if err != nil {
+			return nil, fmt.Errorf("TTL %s is not a valid ISO-8601 duration: %v", ttl, err)
+		}
+	}
+
+	parsedTTL := durationTTL{
+		years:    years,
+		months:   months,
+		days:     7*weeks + days,
+		duration: time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + seconds,
+	}
+	if parsedTTL == (durationTTL{}) {
+		return nil, fmt.Errorf("TTL %s must be positive", ttl)
+	}
+	return parsedTTL, nil
+}
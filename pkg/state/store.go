@@ -0,0 +1,179 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package state
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"google.golang.org/api/option"
+)
+
+// gcsPrefix is the prefix of store locations that are GCS objects.
+const gcsPrefix = "gs://"
+
+// Store persists the state of the reaper manager, so that its reapers survive restarts.
+type Store interface {
+	// Load returns the persisted state, which is empty if no state was saved yet.
+	Load(ctx context.Context) (*reaperconfig.ManagerState, error)
+	// Save persists the given state, replacing the previously saved state.
+	Save(ctx context.Context, state *reaperconfig.ManagerState) error
+}
+
+// NewStore returns the store at the given location, which is either a GCS object in the
+// form gs://bucket/object, or the path of a local file.
+func NewStore(ctx context.Context, location string, clientOptions ...option.ClientOption) (Store, error) {
+	if !strings.HasPrefix(location, gcsPrefix) {
+		return NewFileStore(location), nil
+	}
+	bucketAndObject := strings.SplitN(strings.TrimPrefix(location, gcsPrefix), "/", 2)
+	if len(bucketAndObject) != 2 || len(bucketAndObject[0]) == 0 || len(bucketAndObject[1]) == 0 {
+		return nil, fmt.Errorf("invalid GCS state location %s, expected gs://bucket/object", location)
+	}
+	return NewGCSStore(ctx, bucketAndObject[0], bucketAndObject[1], clientOptions...)
+}
+
+// FileStore is a Store that keeps the state in a local file.
+type FileStore struct {
+	path string
+}
+
+// NewFileStore creates a FileStore that keeps the state in the file at the given path.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Load reads the state from the file. If the file does not exist, the state is empty.
+func (store *FileStore) Load(ctx context.Context) (*reaperconfig.ManagerState, error) {
+	data, err := ioutil.ReadFile(store.path)
+	if os.IsNotExist(err) {
+		return &reaperconfig.ManagerState{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading state from %s failed with the following error: %s", store.path, err.Error())
+	}
+	return unmarshalState(data)
+}
+
+// Save writes the state to a temporary file, and then renames it to the store's file, so
+// that the file is never left partially written.
+func (store *FileStore) Save(ctx context.Context, state *reaperconfig.ManagerState) error {
+	data, err := marshalState(state)
+	if err != nil {
+		return err
+	}
+	tempFile, err := ioutil.TempFile(filepath.Dir(store.path), filepath.Base(store.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("writing state to %s failed with the following error: %s", store.path, err.Error())
+	}
+	defer os.Remove(tempFile.Name())
+	if _, err := tempFile.Write(data); err != nil {
+		tempFile.Close()
+		return fmt.Errorf("writing state to %s failed with the following error: %s", store.path, err.Error())
+	}
+	if err := tempFile.Close(); err != nil {
+		return fmt.Errorf("writing state to %s failed with the following error: %s", store.path, err.Error())
+	}
+	if err := os.Rename(tempFile.Name(), store.path); err != nil {
+		return fmt.Errorf("writing state to %s failed with the following error: %s", store.path, err.Error())
+	}
+	return nil
+}
+
+// GCSStore is a Store that keeps the state in a GCS object.
+type GCSStore struct {
+	client *storage.Client
+	bucket string
+	object string
+}
+
+// NewGCSStore creates a GCSStore that keeps the state in the given object.
+func NewGCSStore(ctx context.Context, bucket, object string, clientOptions ...option.ClientOption) (*GCSStore, error) {
+	client, err := storage.NewClient(ctx, clientOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("GCS state store failed to authenticate with the following error: %s", err.Error())
+	}
+	return &GCSStore{client: client, bucket: bucket, object: object}, nil
+}
+
+// Load reads the state from the object. If the object does not exist, the state is empty.
+func (store *GCSStore) Load(ctx context.Context) (*reaperconfig.ManagerState, error) {
+	reader, err := store.client.Bucket(store.bucket).Object(store.object).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return &reaperconfig.ManagerState{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading state from %s failed with the following error: %s", store.location(), err.Error())
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("reading state from %s failed with the following error: %s", store.location(), err.Error())
+	}
+	return unmarshalState(data)
+}
+
+// Save uploads the state to the object, replacing its previous contents.
+func (store *GCSStore) Save(ctx context.Context, state *reaperconfig.ManagerState) error {
+	data, err := marshalState(state)
+	if err != nil {
+		return err
+	}
+	writer := store.client.Bucket(store.bucket).Object(store.object).NewWriter(ctx)
+	writer.ContentType = "application/json"
+	if _, err := writer.Write(data); err != nil {
+		writer.Close()
+		return fmt.Errorf("writing state to %s failed with the following error: %s", store.location(), err.Error())
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("writing state to %s failed with the following error: %s", store.location(), err.Error())
+	}
+	return nil
+}
+
+// location returns the gs:// path of the store's object.
+func (store *GCSStore) location() string {
+	return gcsPrefix + store.bucket + "/" + store.object
+}
+
+// marshalState encodes the state as indented JSON, so that it can be read and edited by hand.
+func marshalState(state *reaperconfig.ManagerState) ([]byte, error) {
+	var buffer bytes.Buffer
+	marshaler := &jsonpb.Marshaler{Indent: "  "}
+	if err := marshaler.Marshal(&buffer, state); err != nil {
+		return nil, fmt.Errorf("encoding state failed with the following error: %s", err.Error())
+	}
+	return buffer.Bytes(), nil
+}
+
+// unmarshalState decodes the state from JSON. Unknown fields are ignored, so that state saved
+// by a newer version of the reaper manager can still be loaded.
+func unmarshalState(data []byte) (*reaperconfig.ManagerState, error) {
+	state := &reaperconfig.ManagerState{}
+	unmarshaler := &jsonpb.Unmarshaler{AllowUnknownFields: true}
+	if err := unmarshaler.Unmarshal(bytes.NewReader(data), state); err != nil {
+		return nil, fmt.Errorf("decoding state failed with the following error: %s", err.Error())
+	}
+	return state, nil
+}
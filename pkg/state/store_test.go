@@ -0,0 +1,123 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/googleinterns/cloudai-gcp-test-resource-reaper/reaperconfig"
+	"google.golang.org/api/option"
+	storagev1 "google.golang.org/api/storage/v1"
+)
+
+var testState = &reaperconfig.ManagerState{
+	Reapers: []*reaperconfig.ReaperState{
+		&reaperconfig.ReaperState{
+			Config: &reaperconfig.ReaperConfig{Uuid: "reaper-1", ProjectId: "sampleProject", Schedule: "@every 1h"},
+			Watchlist: []*reaperconfig.WatchedResource{
+				&reaperconfig.WatchedResource{Name: "test-instance", Zone: "us-east1-b", Ttl: "6h", Labels: map[string]string{"team": "ml"}},
+			},
+		},
+	},
+}
+
+func TestFileStore(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	store, err := NewStore(context.Background(), filepath.Join(tempDir, "state.json"))
+	if err != nil {
+		t.Fatalf("NewStore failed with the following error: %s", err.Error())
+	}
+	testStoreRoundTrip(t, store)
+}
+
+func TestGCSStore(t *testing.T) {
+	objects := make(map[string][]byte)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet {
+			data, exists := objects[req.URL.Path]
+			if !exists {
+				http.Error(w, "not found", http.StatusNotFound)
+				return
+			}
+			w.Write(data)
+			return
+		}
+		_, params, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		reader := multipart.NewReader(req.Body, params["boundary"])
+		metadata, _ := reader.NextPart()
+		var object storagev1.Object
+		json.NewDecoder(metadata).Decode(&object)
+		media, _ := reader.NextPart()
+		data, _ := ioutil.ReadAll(media)
+		objects["/"+object.Bucket+"/"+object.Name] = data
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(object)
+	}))
+	defer server.Close()
+
+	store, err := NewStore(
+		context.Background(), "gs://state-bucket/reaper/state.json",
+		option.WithHTTPClient(server.Client()), option.WithEndpoint(server.URL),
+	)
+	if err != nil {
+		t.Fatalf("NewStore failed with the following error: %s", err.Error())
+	}
+	testStoreRoundTrip(t, store)
+	if _, saved := objects["/state-bucket/reaper/state.json"]; !saved {
+		t.Errorf("Expected state to be saved to reaper/state.json in state-bucket, got %v", objects)
+	}
+}
+
+func TestNewStoreInvalidLocation(t *testing.T) {
+	if _, err := NewStore(context.Background(), "gs://bucket-only"); err == nil {
+		t.Error("Expected a GCS location without an object to be rejected")
+	}
+}
+
+// testStoreRoundTrip checks that the store is empty before any state is saved, and that
+// saved state is loaded back unchanged.
+func testStoreRoundTrip(t *testing.T, store Store) {
+	state, err := store.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load failed with the following error: %s", err.Error())
+	}
+	if len(state.GetReapers()) != 0 {
+		t.Errorf("Expected empty state before saving, got %v", state)
+	}
+	if err := store.Save(context.Background(), testState); err != nil {
+		t.Fatalf("Save failed with the following error: %s", err.Error())
+	}
+	state, err = store.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load failed with the following error: %s", err.Error())
+	}
+	if !proto.Equal(state, testState) {
+		t.Errorf("Expected state %v, got %v", testState, state)
+	}
+}
@@ -1,9 +1,15 @@
 package utils
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/textproto"
+	"strings"
 
 	"google.golang.org/api/option"
 )
@@ -11,11 +17,49 @@ import (
 // createServer is a helper function to create a fake server
 // where http requsts will be rerouted for testing
 func CreateServer(handler http.HandlerFunc) *httptest.Server {
-	return httptest.NewServer(http.HandlerFunc(handler))
+	return httptest.NewServer(BatchHandler(handler))
+}
+
+// BatchHandler serves batch requests to Google APIs by passing each request in the
+// batch to the given handler, so that fake servers only need to handle single requests.
+func BatchHandler(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !strings.HasPrefix(req.URL.Path, "/batch") {
+			handler(w, req)
+			return
+		}
+		_, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		reader := multipart.NewReader(req.Body, params["boundary"])
+		for part, err := reader.NextPart(); err == nil; part, err = reader.NextPart() {
+			itemRequest, err := http.ReadRequest(bufio.NewReader(part))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			recorder := httptest.NewRecorder()
+			handler(recorder, itemRequest)
+
+			header := make(textproto.MIMEHeader)
+			header.Set("Content-Type", "application/http")
+			header.Set("Content-ID", "<response-"+strings.Trim(part.Header.Get("Content-ID"), "<>")+">")
+			itemWriter, _ := writer.CreatePart(header)
+			recorder.Result().Write(itemWriter)
+		}
+		writer.Close()
+		w.Header().Set("Content-Type", "multipart/mixed; boundary="+writer.Boundary())
+		w.Write(body.Bytes())
+	}
 }
 
 func DefaultHandler(w http.ResponseWriter, req *http.Request) {
-	w.Write([]byte(`{"success": true}`))
+	w.Write([]byte(`{"success": true, "status": "DONE"}`))
 
 }
 